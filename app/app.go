@@ -0,0 +1,635 @@
+// Package app wires the components of the server from its configuration, so it can be started and stopped as a whole.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/NeowayLabs/wabbit/amqptest/server"
+	"github.com/casbin/casbin/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog"
+	"github.com/swaggo/echo-swagger"
+	"github.com/swaggo/swag"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/cache"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/config"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/migrate"
+	auditModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
+	idempotencyModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/idempotency"
+	outboxModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/outbox"
+	ratelimitModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/ratelimit"
+	tenantModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/tenant"
+	webhookModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/webhook"
+	docsV1 "gitlab.com/s0j0hn/go-rest-boilerplate-echo/docs/v1" // docs are generated by Swag CLI, one instance per API version.
+	docsV2 "gitlab.com/s0j0hn/go-rest-boilerplate-echo/docs/v2"
+	tenantHandler "gitlab.com/s0j0hn/go-rest-boilerplate-echo/handlers"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/health"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/idempotency"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/lifecycle"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/metrics"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/policy"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/rabbitmq"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/ratelimit"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/requestid"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/tracing"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/validation"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/versioning"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/webhook"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/websocket"
+	"gorm.io/gorm"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// App is the server, with the components it is made of.
+	App struct {
+		config          config.Config
+		logger          zerolog.Logger
+		echo            *echo.Echo
+		db              *gorm.DB
+		broker          *server.AMQPServer
+		amqpClient      *rabbitmq.AMQPClient
+		taskManager     *rabbitmq.TaskClient
+		amqpDone        chan bool
+		websocket       *websocket.Server
+		health          *health.Checker
+		lifecycle       *lifecycle.Manager
+		shutdownTracing func(context.Context) error
+		// cache holds the tenant reads, nil when disabled.
+		cache *cache.Replicated
+
+		stopConsumers  context.CancelFunc
+		consumers      sync.WaitGroup
+		stopSchedulers context.CancelFunc
+	}
+
+	// PolicyEnforcer is casbin rules policy.
+	PolicyEnforcer struct {
+		enforcer *casbin.Enforcer
+	}
+)
+
+// guestSubject is the subject of the unauthenticated requests.
+const guestSubject = "guest"
+
+func (e *PolicyEnforcer) checkPolicyAccessGuests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := guestSubject // All unauthenticated requests only
+		logging.SetSubject(c, user)
+		method := c.Request().Method
+		path := c.Request().URL.Path
+
+		// Hard deletes are a separate action so they can be restricted independently.
+		if method == http.MethodDelete && c.QueryParam("hard") == "true" {
+			method = policy.PurgeAction
+		}
+
+		isGood, err := e.enforcer.Enforce(user, path, method)
+		if err != nil {
+			c.Logger().Error(err.Error())
+			return problem.Forbidden("access denied by policy")
+		}
+
+		if isGood {
+			return next(c)
+		}
+		return problem.Forbidden("access denied by policy")
+	}
+}
+
+// createTenantPolicies is used to grant the tenant routes of a version, prefix being its route group.
+func createTenantPolicies(policyEnforcer *casbin.Enforcer, prefix string) {
+	policy.AddGetPolicy(policyEnforcer, "guest", prefix+"/tenants")
+	policy.AddCreatePolicy(policyEnforcer, "guest", prefix+"/tenants")
+	policy.AddUpdatePolicy(policyEnforcer, "guest", prefix+"/tenants")
+	// policy.AddDeletePolicy(policyEnforcer, "guest", prefix+"/tenants")
+	// policy.AddBatchPolicy(policyEnforcer, "guest", prefix+"/tenants")
+	// policy.AddImportPolicy(policyEnforcer, "guest", prefix+"/tenants")
+	// policy.AddRestorePolicy(policyEnforcer, "guest", prefix+"/tenants")
+	// policy.AddPurgePolicy(policyEnforcer, "guest", prefix+"/tenants")
+	// policy.AddStatusPolicy(policyEnforcer, "guest", prefix+"/tenants")
+}
+
+// registerTenantRoutes is used to serve the tenant routes in the route group of a version.
+func registerTenantRoutes(group *echo.Group, tenantHandlerInstance *tenantHandler.HandlerTenant, idempotencyTTL time.Duration) {
+	idempotencyMiddleware := idempotency.Middleware(idempotencyTTL, idempotencyScope)
+
+	group.GET("/tenants/search", tenantHandlerInstance.Search)
+	group.GET("/tenants/trash", tenantHandlerInstance.GetTrash)
+	group.GET("/tenants/export", tenantHandlerInstance.Export)
+	group.POST("/tenants/import", tenantHandlerInstance.Import, idempotencyMiddleware)
+	group.POST("/tenants/:id/restore", tenantHandlerInstance.Restore)
+	group.POST("/tenants/:id/suspend", tenantHandlerInstance.Suspend)
+	group.POST("/tenants/:id/activate", tenantHandlerInstance.Activate)
+	group.GET("/tenants/:id", tenantHandlerInstance.GetOneByID)
+	group.GET("/tenants", tenantHandlerInstance.GetAll)
+	group.POST("/tenants", tenantHandlerInstance.Create, idempotencyMiddleware)
+	group.POST("/tenants\\:batch", tenantHandlerInstance.Batch, idempotencyMiddleware)
+	group.PUT("/tenants/:id", tenantHandlerInstance.Update)
+	group.PATCH("/tenants/:id", tenantHandlerInstance.Patch)
+	group.DELETE("/tenants/:id", tenantHandlerInstance.DeleteByID)
+}
+
+// idempotencyScope is used to name the client an idempotency key belongs to, by its subject and the tenant checked
+// by CheckTenantStatus. Unauthenticated clients are named by IP address, as they would all share the guest keys otherwise.
+func idempotencyScope(c echo.Context) string {
+	scope := "ip:" + c.RealIP()
+	if subject := logging.Subject(c); subject != "" && subject != guestSubject {
+		scope = "subject:" + subject
+	}
+
+	if tenant := tenantHandler.CurrentTenant(c); tenant != nil {
+		scope = "tenant:" + tenant.UUID.String() + ":" + scope
+	}
+	return scope
+}
+
+// databaseMiddleware is used to carry the database client of the app in the request context, for the models.
+func databaseMiddleware(db *gorm.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.SetRequest(c.Request().WithContext(database.NewContext(c.Request().Context(), db)))
+			return next(c)
+		}
+	}
+}
+
+// cacheMiddleware is used to carry the cache of the app in the request context, for the models.
+func cacheMiddleware(readCache cache.Cache) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.SetRequest(c.Request().WithContext(cache.NewContext(c.Request().Context(), readCache)))
+			return next(c)
+		}
+	}
+}
+
+// New is used to create the app from its configuration: the database is opened and migrated,
+// and the broker connection started, but nothing is served until Start.
+func New(appConfig config.Config) (*App, error) {
+	err := logging.Configure(appConfig.IsProd(), appConfig.Log.Level, appConfig.Log.Components)
+	if err != nil {
+		return nil, err
+	}
+
+	application := &App{
+		config:    appConfig,
+		logger:    logging.Component("http"),
+		echo:      echo.New(),
+		amqpDone:  make(chan bool),
+		health:    health.New(),
+		lifecycle: lifecycle.New(appConfig.ShutdownTimeout, logging.Component("lifecycle")),
+	}
+
+	// The middleware settings are checked before anything is opened, so nothing is left running on error.
+	_, err = application.corsConfig()
+	if err != nil {
+		return nil, err
+	}
+	_, err = application.rateLimiterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	application.shutdownTracing, err = tracing.Configure(context.Background(), tracing.Config{
+		ServiceName: appConfig.Tracing.ServiceName,
+		Exporter:    appConfig.Tracing.Exporter,
+		Endpoint:    appConfig.Tracing.Endpoint,
+		File:        appConfig.Tracing.File,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Database.
+	application.db, err = database.Open(appConfig.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrate.Run(application.db)
+	if err != nil {
+		return nil, err
+	}
+
+	policyEnforcer, err := policy.InitPolicy(application.db)
+	if err != nil {
+		return nil, err
+	}
+
+	// Broker, run within the app when it is in memory.
+	amqpAccess := appConfig.RabbitMQ.Access()
+	if appConfig.RabbitMQ.InMemory {
+		application.broker = server.NewServer(amqpAccess)
+		err = application.broker.Start()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	messagesChannel := make(chan []byte)
+	application.amqpClient = rabbitmq.NewAMQPClient(appConfig.RabbitMQ.ListenQueue, appConfig.RabbitMQ.PushQueue, amqpAccess, logging.Component("amqp"), application.amqpDone, messagesChannel, !appConfig.RabbitMQ.InMemory)
+	application.taskManager = rabbitmq.NewTaskManagerClient(application.amqpClient)
+
+	// Each replica caches the tenant reads, the changes being broadcast so the others drop what they cached.
+	if appConfig.Cache.Size > 0 {
+		localCache := cache.Instrument("tenant", cache.NewLRU(appConfig.Cache.Size, appConfig.Cache.TTL))
+		application.cache = cache.NewReplicated(localCache, application.amqpClient.Exchange(appConfig.Cache.Exchange))
+	}
+
+	application.websocket = websocket.NewServer(messagesChannel)
+
+	err = application.serve(policyEnforcer, application.taskManager)
+	if err != nil {
+		return nil, err
+	}
+
+	application.health.Register("database", health.Database(application.db))
+	application.health.Register("amqp", health.AMQP(application.amqpClient))
+	application.health.Register("policy", health.Policy(policyEnforcer))
+	application.health.Register("websocket", health.Listening(application.websocket.Echo))
+
+	return application, nil
+}
+
+// serve is used to set up the middlewares and routes of the API.
+func (application *App) serve(policyEnforcer *casbin.Enforcer, taskManager *rabbitmq.TaskClient) error {
+	echoServer := application.echo
+
+	// For more customizations: https://echo.labstack.com/guide/customization
+	echoServer.Logger = logging.NewEchoLogger(application.logger)
+	echoServer.Use(requestid.Middleware())
+	echoServer.Use(tracing.Middleware())
+	echoServer.Use(metrics.Middleware())
+	echoServer.Use(logging.AccessLog())
+
+	requestValidator, err := validation.New()
+	if err != nil {
+		return err
+	}
+	echoServer.Validator = requestValidator
+	echoServer.HTTPErrorHandler = problem.NewHTTPErrorHandler(requestValidator.Translate)
+
+	echoServer.Use(middleware.Recover())
+	echoServer.Use(middleware.SecureWithConfig(application.secureConfig()))
+
+	// Preflight requests are answered here, before the policy which doesn't grant OPTIONS.
+	corsConfig, err := application.corsConfig()
+	if err != nil {
+		return err
+	}
+	echoServer.Use(middleware.CORSWithConfig(corsConfig))
+	echoServer.Use(databaseMiddleware(application.db))
+	if application.cache != nil {
+		echoServer.Use(cacheMiddleware(application.cache))
+	}
+
+	// Each version is served under its own route group, the older ones flagged as deprecated.
+	apiVersions := []versioning.Version{
+		{
+			Name:        tenantHandler.VersionV1,
+			Deprecation: application.config.API[tenantHandler.VersionV1].Deprecation,
+			Sunset:      application.config.API[tenantHandler.VersionV1].Sunset,
+			Successor:   tenantHandler.VersionV2,
+		},
+		{
+			Name:        tenantHandler.VersionV2,
+			Deprecation: application.config.API[tenantHandler.VersionV2].Deprecation,
+			Sunset:      application.config.API[tenantHandler.VersionV2].Sunset,
+		},
+	}
+
+	policy.AddGetPolicy(policyEnforcer, "guest", "/swagger/*")
+	policy.AddGetPolicy(policyEnforcer, "guest", "/metrics")
+	policy.AddGetPolicy(policyEnforcer, "guest", "/healthz")
+	policy.AddGetPolicy(policyEnforcer, "guest", "/readyz")
+	for _, apiVersion := range apiVersions {
+		createTenantPolicies(policyEnforcer, apiVersion.Prefix())
+	}
+	// The audit trail shows who changed what, grant it to the operators only.
+	// policy.AddAuditPolicy(policyEnforcer, "guest")
+	// The webhooks post to any URL with the events of every tenant, grant them to the operators only.
+	// policy.AddWebhookPolicy(policyEnforcer, "guest")
+
+	tenantInstance := tenantModel.ModelTenant{}
+	tenantHandlerInstance := tenantHandler.CreateHandlerTenant(tenantInstance, taskManager)
+
+	policyCheck := PolicyEnforcer{enforcer: policyEnforcer}
+
+	// The tenant routes predating the versions are redirected to v1, the policy applying to the redirected request.
+	echoServer.Use(versioning.Redirect("/tenants", apiVersions[0]))
+
+	// Apply the policy for all routes.
+	echoServer.Use(policyCheck.checkPolicyAccessGuests)
+	echoServer.Use(tenantHandler.AuditMiddleware)
+	echoServer.Use(tenantHandlerInstance.CheckTenantStatus)
+
+	swaggerDocs := map[string]*swag.Spec{
+		tenantHandler.VersionV1: docsV1.SwaggerInfov1,
+		tenantHandler.VersionV2: docsV2.SwaggerInfov2,
+	}
+
+	echoServer.GET("/metrics", metrics.Handler())
+
+	// Readiness checks every dependency the API needs to answer.
+	echoServer.GET("/healthz", application.health.Liveness())
+	echoServer.GET("/readyz", application.health.Readiness())
+
+	// The audit trail covers every version, its entries aren't versioned.
+	auditHandlerInstance := tenantHandler.CreateHandlerAudit(auditModel.ModelAuditEntry{})
+	echoServer.GET("/audit", auditHandlerInstance.Find)
+	echoServer.GET("/audit/export", auditHandlerInstance.Export)
+
+	// The webhooks receive the events of every version.
+	webhookHandlerInstance := tenantHandler.CreateHandlerWebhook(webhookModel.ModelSubscription{}, webhookModel.ModelDelivery{})
+	echoServer.GET("/webhooks", webhookHandlerInstance.GetAll)
+	echoServer.POST("/webhooks", webhookHandlerInstance.Create)
+	echoServer.GET("/webhooks/:id", webhookHandlerInstance.GetOne)
+	echoServer.PUT("/webhooks/:id", webhookHandlerInstance.Update)
+	echoServer.DELETE("/webhooks/:id", webhookHandlerInstance.DeleteByID)
+	echoServer.GET("/webhooks/:id/deliveries", webhookHandlerInstance.GetDeliveries)
+	echoServer.POST("/webhooks/:id/deliveries/:delivery/redeliver", webhookHandlerInstance.Redeliver)
+
+	for _, apiVersion := range apiVersions {
+		registerTenantRoutes(versioning.Group(echoServer, apiVersion), tenantHandlerInstance, application.config.IdempotencyTTL)
+
+		swaggerDoc := swaggerDocs[apiVersion.Name]
+		swaggerDoc.Host = application.config.Address
+		swaggerDoc.BasePath = apiVersion.Prefix()
+		swaggerDoc.Version = apiVersion.Name
+		echoServer.GET("/swagger/"+apiVersion.Name+"/*", echoSwagger.EchoWrapHandler(echoSwagger.InstanceName(swaggerDoc.InstanceName())))
+	}
+
+	rateLimiterConfig, err := application.rateLimiterConfig()
+	if err != nil {
+		return err
+	}
+	echoServer.Use(ratelimit.Middleware(rateLimiterConfig))
+	return nil
+}
+
+// corsConfig is used to build the cross-origin policy from the configuration of the app.
+func (application *App) corsConfig() (middleware.CORSConfig, error) {
+	cors := application.config.CORS
+	if cors.AllowCredentials && slices.Contains(cors.AllowOrigins, "*") {
+		return middleware.CORSConfig{}, errors.New("cors credentials can't be allowed to any origin, list the origins instead")
+	}
+
+	return middleware.CORSConfig{
+		AllowOrigins:     cors.AllowOrigins,
+		AllowMethods:     []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete},
+		AllowHeaders:     cors.AllowHeaders,
+		AllowCredentials: cors.AllowCredentials,
+		ExposeHeaders: []string{
+			echo.HeaderXRequestID, tenantHandler.HeaderETag, idempotency.HeaderIdempotentReplayed,
+			versioning.HeaderDeprecation, versioning.HeaderSunset, versioning.HeaderLink,
+			ratelimit.HeaderLimit, ratelimit.HeaderRemaining, ratelimit.HeaderReset, ratelimit.HeaderRetryAfter,
+		},
+		MaxAge: int(cors.MaxAge.Seconds()),
+	}, nil
+}
+
+// secureConfig is used to build the security headers from the configuration of the app.
+func (application *App) secureConfig() middleware.SecureConfig {
+	security := application.config.Security
+	return middleware.SecureConfig{
+		XSSProtection:         security.XSSProtection,
+		ContentTypeNosniff:    security.ContentTypeNosniff,
+		XFrameOptions:         security.FrameOptions,
+		ReferrerPolicy:        security.ReferrerPolicy,
+		ContentSecurityPolicy: security.ContentSecurityPolicy,
+		CSPReportOnly:         security.CSPReportOnly,
+		HSTSMaxAge:            int(security.HSTSMaxAge.Seconds()),
+		HSTSExcludeSubdomains: security.HSTSExcludeSubdomains,
+		HSTSPreloadEnabled:    security.HSTSPreload,
+	}
+}
+
+// rateLimiterConfig is used to build the rate limiter from the configuration of the app.
+// The probes and metrics are never limited, so a busy client can't get the replica restarted.
+func (application *App) rateLimiterConfig() (ratelimit.Config, error) {
+	rateLimit := application.config.RateLimit
+
+	rateLimiterConfig := ratelimit.Config{
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/healthz" || c.Path() == "/readyz" || c.Path() == "/metrics"
+		},
+		Default: ratelimit.Limit{Rate: rateLimit.Default.Rate, Burst: rateLimit.Default.Burst},
+		Plans:   map[string]ratelimit.Limit{},
+		Routes:  map[string]ratelimit.Limit{},
+		Plan: func(c echo.Context) string {
+			if tenant := tenantHandler.CurrentTenant(c); tenant != nil {
+				return tenant.Plan
+			}
+			return ""
+		},
+	}
+
+	for plan, quota := range rateLimit.Plans {
+		rateLimiterConfig.Plans[plan] = ratelimit.Limit{Rate: quota.Rate, Burst: quota.Burst}
+	}
+	for _, route := range rateLimit.Routes {
+		rateLimiterConfig.Routes[ratelimit.RouteKey(strings.ToUpper(route.Method), route.Path)] = ratelimit.Limit{Rate: route.Rate, Burst: route.Burst}
+	}
+
+	switch rateLimit.Store {
+	case config.RateLimitStoreMemory:
+		rateLimiterConfig.Store = ratelimit.NewMemoryStore(time.Minute)
+	case config.RateLimitStoreDatabase:
+		rateLimiterConfig.Store = ratelimit.NewDatabaseStore()
+	default:
+		return ratelimit.Config{}, fmt.Errorf("unknown rate limit store %q", rateLimit.Store)
+	}
+
+	switch rateLimit.Key {
+	case config.RateLimitKeyTenant, config.RateLimitKeySubject, config.RateLimitKeyIP:
+	default:
+		return ratelimit.Config{}, fmt.Errorf("unknown rate limit key %q", rateLimit.Key)
+	}
+
+	// Unauthenticated requests are counted by IP address, as they would all share the guest bucket otherwise.
+	// The tenant is the one checked by CheckTenantStatus, a client naming another tenant in its header would
+	// still be counted under its own subject or address.
+	rateLimiterConfig.Identify = func(c echo.Context) string {
+		client := "ip:" + c.RealIP()
+		if rateLimit.Key != config.RateLimitKeyIP {
+			if subject := logging.Subject(c); subject != "" && subject != guestSubject {
+				client = "subject:" + subject
+			}
+		}
+
+		if rateLimit.Key == config.RateLimitKeyTenant {
+			if tenant := tenantHandler.CurrentTenant(c); tenant != nil {
+				return "tenant:" + tenant.UUID.String() + ":" + client
+			}
+		}
+		return client
+	}
+	return rateLimiterConfig, nil
+}
+
+// Echo is used to get the echo server of the API, its listener being set once the app is started.
+func (application *App) Echo() *echo.Echo {
+	return application.echo
+}
+
+// WebSocket is used to get the server forwarding the task events, its listener being set once the app is started.
+func (application *App) WebSocket() *websocket.Server {
+	return application.websocket
+}
+
+// Start is used to listen on the configured addresses, then serve the API, the consumers and the schedulers
+// in background. It returns once the API and WebSocket listeners are open.
+func (application *App) Start(ctx context.Context) error {
+	listener, err := (&net.ListenConfig{}).Listen(ctx, "tcp", application.config.Address)
+	if err != nil {
+		return err
+	}
+	application.echo.Listener = listener
+
+	websocketListener, err := (&net.ListenConfig{}).Listen(ctx, "tcp", application.config.WebSocketAddress)
+	if err != nil {
+		return errors.Join(err, listener.Close())
+	}
+	application.websocket.Echo().Listener = websocketListener
+
+	// The broker is waited for, as the tasks can't be pushed before.
+	application.amqpDone <- true
+
+	amqpContext, stopConsumers := context.WithCancel(context.WithoutCancel(ctx))
+	application.stopConsumers = stopConsumers
+	application.consumers.Add(1)
+	go application.consume(amqpContext)
+	if application.cache != nil {
+		application.consumers.Add(1)
+		go application.subscribe(amqpContext)
+	}
+
+	// The relay stops with the consumers, once the background work wrote its last task events.
+	application.consumers.Add(1)
+	go func() {
+		defer application.consumers.Done()
+		application.taskManager.RunRelay(database.NewContext(amqpContext, application.db), application.config.Outbox.RelayInterval, application.config.Outbox.BatchSize)
+	}()
+
+	// The schedulers run their queries on the database of the app.
+	schedulersContext, stopSchedulers := context.WithCancel(database.NewContext(context.WithoutCancel(ctx), application.db))
+	application.stopSchedulers = stopSchedulers
+	go tenantModel.RunPurgeScheduler(schedulersContext, application.config.Tenant.Retention, application.config.Tenant.PurgeInterval)
+	go idempotencyModel.RunPurgeScheduler(schedulersContext, time.Hour)
+	go outboxModel.RunPurgeScheduler(schedulersContext, application.config.Outbox.Retention, application.config.Outbox.PurgeInterval)
+	if application.config.RateLimit.Store == config.RateLimitStoreDatabase {
+		go ratelimitModel.RunPurgeScheduler(schedulersContext, time.Hour, 10*time.Minute)
+	}
+
+	// The webhook deliveries are sent along with the schedulers, an attempt cut by the shutdown is retried.
+	webhookConfig := application.config.Webhook
+	dispatcher := webhook.NewDispatcher(webhookConfig.Timeout, webhookConfig.MaxAttempts, webhookConfig.Backoff, webhookConfig.MaxBackoff, webhookConfig.BatchSize, webhookConfig.AllowPrivate)
+	go dispatcher.Run(schedulersContext, webhookConfig.Interval)
+	go webhookModel.RunPurgeScheduler(schedulersContext, webhookConfig.Retention, webhookConfig.PurgeInterval)
+
+	go func() {
+		if err := application.websocket.Start(""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			application.logger.Error().Err(err).Msg("Error serving the websocket")
+		}
+	}()
+	go func() {
+		if err := application.echo.Start(""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			application.logger.Error().Err(err).Msg("Error serving the API")
+		}
+	}()
+
+	application.onShutdown()
+	return nil
+}
+
+// consume is used to handle the task events until ctx is cancelled. In memory brokers aren't consumed.
+func (application *App) consume(ctx context.Context) {
+	defer application.consumers.Done()
+	if application.config.RabbitMQ.InMemory {
+		return
+	}
+
+	logger := logging.Component("amqp")
+	for {
+		err := application.amqpClient.Stream(ctx)
+		if errors.Is(err, rabbitmq.ErrDisconnected) {
+			continue
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("Error consuming rabbitMQ events")
+		}
+		break
+	}
+}
+
+// subscribe is used to drop the cached values the other replicas invalidate, until ctx is cancelled.
+func (application *App) subscribe(ctx context.Context) {
+	defer application.consumers.Done()
+
+	logger := logging.Component("cache")
+	exchange := application.amqpClient.Exchange(application.config.Cache.Exchange)
+	for {
+		err := exchange.Subscribe(ctx, func(data []byte) {
+			if err := application.cache.Receive(ctx, data); err != nil {
+				logger.Error().Err(err).Msg("Error reading a cache invalidation")
+			}
+		})
+		if errors.Is(err, rabbitmq.ErrDisconnected) {
+			continue
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("Error subscribing to the cache invalidations")
+		}
+		break
+	}
+}
+
+// onShutdown is used to stop the components in order: no more traffic is taken in,
+// the work already accepted is drained, then the connections it used are closed.
+func (application *App) onShutdown() {
+	application.lifecycle.OnShutdown("readiness", func(context.Context) error {
+		application.health.ShutDown()
+		return nil
+	})
+	application.lifecycle.OnShutdown("http", application.echo.Shutdown)
+	application.lifecycle.OnShutdown("background work", tenantHandler.WaitBackgroundWork)
+	application.lifecycle.OnShutdown("amqp consumers", func(ctx context.Context) error {
+		application.stopConsumers()
+		return lifecycle.WaitGroup(ctx, &application.consumers)
+	})
+	application.lifecycle.OnShutdown("websocket", application.websocket.Shutdown)
+	application.lifecycle.OnShutdown("amqp", func(context.Context) error {
+		err := application.amqpClient.Close()
+		if application.broker != nil {
+			return errors.Join(err, application.broker.Stop())
+		}
+		return err
+	})
+	application.lifecycle.OnShutdown("schedulers", func(context.Context) error {
+		application.stopSchedulers()
+		return nil
+	})
+	application.lifecycle.OnShutdown("tracing", application.shutdownTracing)
+	application.lifecycle.OnShutdown("database", func(context.Context) error {
+		sqlDB, err := application.db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Close()
+	})
+}
+
+// Stop is used to shut the started app down, within its shutdown timeout or ctx, the earliest.
+func (application *App) Stop(ctx context.Context) error {
+	return application.lifecycle.Shutdown(ctx)
+}
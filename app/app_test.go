@@ -0,0 +1,252 @@
+package app
+
+import (
+	"context"
+	libUUID "github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/config"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	auditModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
+	outboxModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/outbox"
+	webhookModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/webhook"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/webhook"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// databaseFile is used to get the SQLite database of a test, a file so its transactions wait for each other's
+// locks, where those of a shared in memory database fail right away.
+func databaseFile(t *testing.T, name string) string {
+	return "file:" + filepath.Join(t.TempDir(), name+".db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
+
+// testConfig is used to configure an app on free ports, with its own SQLite database and in memory broker.
+func testConfig(t *testing.T, name string) config.Config {
+	return config.Config{
+		Address:          "127.0.0.1:0",
+		WebSocketAddress: "127.0.0.1:0",
+		Database:         config.Database{Driver: config.DriverSQLite, Name: name, DSN: databaseFile(t, name)},
+		RabbitMQ:         config.RabbitMQ{Host: name, PushQueue: "tasks", ListenQueue: "events", InMemory: true},
+		Tenant:           config.Tenant{Retention: time.Hour, PurgeInterval: time.Hour},
+		IdempotencyTTL:   time.Hour,
+		Log:              config.Log{Level: "error"},
+		Tracing:          config.Tracing{Exporter: "none"},
+		Cache:            config.Cache{Size: 100, TTL: time.Minute, Exchange: "cache.invalidation"},
+		Outbox:           config.Outbox{RelayInterval: time.Second, BatchSize: 10, Retention: time.Hour, PurgeInterval: time.Hour},
+		Webhook: config.Webhook{
+			Timeout: time.Second, MaxAttempts: 3, Backoff: 10 * time.Millisecond, MaxBackoff: time.Second,
+			Interval: 20 * time.Millisecond, BatchSize: 10, Retention: time.Hour, PurgeInterval: time.Hour,
+			AllowPrivate: true,
+		},
+		RateLimit: config.RateLimit{
+			Store:   config.RateLimitStoreMemory,
+			Key:     config.RateLimitKeyTenant,
+			Default: config.RateLimitQuota{Rate: 10, Burst: 30},
+		},
+		ShutdownTimeout: 5 * time.Second,
+	}
+}
+
+func start(t *testing.T, name string) (*App, string) {
+	return startWithConfig(t, testConfig(t, name))
+}
+
+func startWithConfig(t *testing.T, appConfig config.Config) (*App, string) {
+	application, err := New(appConfig)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.NoError(t, application.Start(context.Background()))
+	return application, "http://" + application.Echo().ListenerAddr().String()
+}
+
+// stop is used to stop the app once the idle connections of the client are closed. The server would wait for
+// the ones dialed but never used, as for requests about to be sent.
+func stop(t *testing.T, application *App) {
+	http.DefaultClient.CloseIdleConnections()
+	assert.NoError(t, application.Stop(context.Background()))
+}
+
+func get(t *testing.T, url string) int {
+	response, err := http.Get(url)
+	if !assert.NoError(t, err) {
+		return 0
+	}
+	defer response.Body.Close()
+	return response.StatusCode
+}
+
+func TestTwoApps(t *testing.T) {
+	first, firstURL := start(t, "first")
+	second, secondURL := start(t, "second")
+
+	id := libUUID.NewString()
+	response, err := http.Post(firstURL+"/v2/tenants", "application/json", strings.NewReader(`{"id":"`+id+`","name":"Acme"}`))
+	assert.NoError(t, err)
+	assert.NoError(t, response.Body.Close())
+
+	// Assertions
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	assert.Equal(t, http.StatusOK, get(t, firstURL+"/readyz"))
+	assert.Equal(t, http.StatusOK, get(t, secondURL+"/readyz"))
+	assert.Eventually(t, func() bool { return get(t, firstURL+"/v2/tenants/"+id) == http.StatusOK }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusNotFound, get(t, secondURL+"/v2/tenants/"+id))
+
+	// The unversioned routes are redirected to v1, the client following the redirect.
+	assert.Equal(t, http.StatusOK, get(t, firstURL+"/tenants/"+id))
+
+	stop(t, first)
+	assert.Equal(t, http.StatusOK, get(t, secondURL+"/healthz"))
+	stop(t, second)
+
+	_, err = http.Get(firstURL + "/healthz")
+	assert.Error(t, err)
+}
+
+func TestSharedRateLimit(t *testing.T) {
+	firstConfig := testConfig(t, "limited")
+	firstConfig.RateLimit.Store = config.RateLimitStoreDatabase
+	firstConfig.RateLimit.Routes = []config.RateLimitRoute{{Method: "get", Path: "/v2/tenants", Rate: 0.01, Burst: 2}}
+	secondConfig := firstConfig
+	secondConfig.RabbitMQ.Host = "limited-replica"
+
+	first, firstURL := startWithConfig(t, firstConfig)
+	second, secondURL := startWithConfig(t, secondConfig)
+
+	// Both replicas take their tokens from the bucket of the client in their database.
+	assert.Equal(t, http.StatusOK, get(t, firstURL+"/v2/tenants"))
+	assert.Equal(t, http.StatusOK, get(t, secondURL+"/v2/tenants"))
+	assert.Equal(t, http.StatusTooManyRequests, get(t, firstURL+"/v2/tenants"))
+	assert.Equal(t, http.StatusTooManyRequests, get(t, secondURL+"/v2/tenants"))
+	assert.Equal(t, http.StatusOK, get(t, secondURL+"/readyz"))
+
+	stop(t, first)
+	stop(t, second)
+}
+
+func TestPreflight(t *testing.T) {
+	appConfig := testConfig(t, "preflight")
+	appConfig.CORS = config.CORS{AllowOrigins: []string{"https://app.example.com"}, AllowCredentials: true, MaxAge: time.Hour}
+	appConfig.Security = config.Security{FrameOptions: "DENY", ContentSecurityPolicy: "default-src 'none'"}
+	application, url := startWithConfig(t, appConfig)
+
+	// Answered by the CORS policy, as OPTIONS isn't granted by the authorization policy.
+	request, err := http.NewRequest(http.MethodOptions, url+"/v2/tenants", nil)
+	assert.NoError(t, err)
+	request.Header.Set("Origin", "https://app.example.com")
+	request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	response, err := http.DefaultClient.Do(request)
+	if assert.NoError(t, err) {
+		assert.NoError(t, response.Body.Close())
+		assert.Equal(t, http.StatusNoContent, response.StatusCode)
+		assert.Equal(t, "https://app.example.com", response.Header.Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", response.Header.Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "3600", response.Header.Get("Access-Control-Max-Age"))
+	}
+
+	response, err = http.Get(url + "/healthz")
+	if assert.NoError(t, err) {
+		assert.NoError(t, response.Body.Close())
+		assert.Equal(t, "DENY", response.Header.Get("X-Frame-Options"))
+		assert.Equal(t, "default-src 'none'", response.Header.Get("Content-Security-Policy"))
+		assert.Empty(t, response.Header.Get("Strict-Transport-Security"))
+	}
+	stop(t, application)
+
+	appConfig.CORS.AllowOrigins = []string{"*"}
+	_, err = New(appConfig)
+	assert.Error(t, err)
+}
+
+func TestAuditTrail(t *testing.T) {
+	application, url := start(t, "audited")
+
+	id := libUUID.NewString()
+	response, err := http.Post(url+"/v2/tenants", "application/json", strings.NewReader(`{"id":"`+id+`","name":"Audited"}`))
+	if assert.NoError(t, err) {
+		assert.NoError(t, response.Body.Close())
+		assert.Equal(t, http.StatusCreated, response.StatusCode)
+	}
+
+	// Recorded in background with the subject, address and request ID of the request.
+	var entries []auditModel.ModelAuditEntry
+	assert.Eventually(t, func() bool {
+		entries = nil
+		return application.db.Where("tenant = ?", id).Order("id").Find(&entries).Error == nil && len(entries) == 2
+	}, time.Second, 10*time.Millisecond)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, auditModel.ActionTenantCreate, entries[0].Action)
+		assert.Equal(t, auditModel.ActionTenantUpdate, entries[1].Action)
+		assert.Equal(t, guestSubject, entries[0].Actor)
+		assert.Equal(t, "127.0.0.1", entries[0].IP)
+		assert.Equal(t, response.Header.Get("X-Request-ID"), entries[0].RequestID)
+	}
+
+	// Closed until granted.
+	assert.Equal(t, http.StatusForbidden, get(t, url+"/audit"))
+
+	stop(t, application)
+}
+
+func TestTaskOutbox(t *testing.T) {
+	application, url := start(t, "outbox")
+
+	response, err := http.Post(url+"/v2/tenants", "application/json", strings.NewReader(`{"id":"`+libUUID.NewString()+`","name":"Relayed"}`))
+	if assert.NoError(t, err) {
+		assert.NoError(t, response.Body.Close())
+		assert.Equal(t, http.StatusCreated, response.StatusCode)
+	}
+
+	// The completed event is committed with the tenant, then published by the relay.
+	assert.Eventually(t, func() bool {
+		var sent int64
+		err := application.db.Model(&outboxModel.ModelMessage{}).Where("sent_at IS NOT NULL").Count(&sent).Error
+		return err == nil && sent == 2
+	}, time.Second, 10*time.Millisecond)
+
+	stop(t, application)
+}
+
+func TestWebhooks(t *testing.T) {
+	application, url := start(t, "webhooks")
+
+	received := make(chan string, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, webhook.Verify("receiver-secret-0123", r.Header.Get(webhook.HeaderSignature), r.Header.Get(webhook.HeaderTimestamp), body, time.Minute))
+		received <- r.Header.Get(webhook.HeaderEvent)
+	}))
+	defer receiver.Close()
+
+	subscription := webhookModel.ModelSubscription{URL: receiver.URL, Secret: "receiver-secret-0123", Events: []string{"tenant.created", "task.*"}, Active: true}
+	_, err := subscription.WithContext(database.NewContext(context.Background(), application.db)).Save()
+	assert.NoError(t, err)
+
+	response, err := http.Post(url+"/v2/tenants", "application/json", strings.NewReader(`{"id":"`+libUUID.NewString()+`","name":"Hooked"}`))
+	if assert.NoError(t, err) {
+		assert.NoError(t, response.Body.Close())
+		assert.Equal(t, http.StatusCreated, response.StatusCode)
+	}
+
+	// Queued with the tenant and the completed task, the update of its activation being filtered out.
+	var events []string
+	for len(events) < 2 {
+		select {
+		case event := <-received:
+			events = append(events, event)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("webhooks not delivered, got %v", events)
+		}
+	}
+	assert.ElementsMatch(t, []string{"tenant.created", "task.completed"}, events)
+
+	// Closed until granted.
+	assert.Equal(t, http.StatusForbidden, get(t, url+"/webhooks"))
+
+	stop(t, application)
+}
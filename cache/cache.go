@@ -0,0 +1,139 @@
+// Package cache keeps serialized values for a while, in process or in an external store,
+// and spreads their invalidation to the other replicas.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/metrics"
+	"sync"
+	"time"
+)
+
+type (
+	// Cache holds values by key until the TTL it was created with is over.
+	// Implementations must be safe for concurrent use.
+	Cache interface {
+		// Get is used to read the value of key, false when it is missing or expired.
+		Get(ctx context.Context, key string) ([]byte, bool, error)
+		// Set is used to keep value for key.
+		Set(ctx context.Context, key string, value []byte) error
+		// Delete is used to drop the values of keys.
+		Delete(ctx context.Context, keys ...string) error
+	}
+
+	// entry is a value of the LRU cache.
+	entry struct {
+		key       string
+		value     []byte
+		expiresAt time.Time
+	}
+
+	// LRU is an in-process cache holding up to size values for ttl, the least recently used ones being evicted first.
+	LRU struct {
+		mutex   sync.Mutex
+		size    int
+		ttl     time.Duration
+		entries map[string]*list.Element
+		// order holds the entries, the most recently used first.
+		order *list.List
+	}
+
+	// instrumented counts the hits and misses of a cache.
+	instrumented struct {
+		Cache
+		name string
+	}
+)
+
+// NewLRU is used to create an in-process cache holding up to size values for ttl.
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{size: size, ttl: ttl, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// Get is used to read the value of key, false when it is missing or expired.
+func (lru *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	lru.mutex.Lock()
+	defer lru.mutex.Unlock()
+
+	element, exists := lru.entries[key]
+	if !exists {
+		return nil, false, nil
+	}
+
+	cached := element.Value.(*entry)
+	if !time.Now().Before(cached.expiresAt) {
+		lru.remove(element)
+		return nil, false, nil
+	}
+
+	lru.order.MoveToFront(element)
+	return cached.value, true, nil
+}
+
+// Set is used to keep value for key, evicting the least recently used value when the cache is full.
+func (lru *LRU) Set(_ context.Context, key string, value []byte) error {
+	lru.mutex.Lock()
+	defer lru.mutex.Unlock()
+
+	expiresAt := time.Now().Add(lru.ttl)
+	if element, exists := lru.entries[key]; exists {
+		cached := element.Value.(*entry)
+		cached.value = value
+		cached.expiresAt = expiresAt
+		lru.order.MoveToFront(element)
+		return nil
+	}
+
+	lru.entries[key] = lru.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	if lru.order.Len() > lru.size {
+		lru.remove(lru.order.Back())
+	}
+	return nil
+}
+
+// Delete is used to drop the values of keys.
+func (lru *LRU) Delete(_ context.Context, keys ...string) error {
+	lru.mutex.Lock()
+	defer lru.mutex.Unlock()
+
+	for _, key := range keys {
+		if element, exists := lru.entries[key]; exists {
+			lru.remove(element)
+		}
+	}
+	return nil
+}
+
+// Len is used to get the number of values held, expired ones included until they are read or evicted.
+func (lru *LRU) Len() int {
+	lru.mutex.Lock()
+	defer lru.mutex.Unlock()
+	return lru.order.Len()
+}
+
+// remove is used to drop an entry, the mutex being held.
+func (lru *LRU) remove(element *list.Element) {
+	lru.order.Remove(element)
+	delete(lru.entries, element.Value.(*entry).key)
+}
+
+// Instrument is used to count the hits and misses of cache under name, in the cache_requests_total metric.
+func Instrument(name string, cache Cache) Cache {
+	return &instrumented{Cache: cache, name: name}
+}
+
+// Get is used to read the value of key, counting it as a hit or a miss.
+func (cache *instrumented) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, found, err := cache.Cache.Get(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	result := "miss"
+	if found {
+		result = "hit"
+	}
+	metrics.CacheRequests.WithLabelValues(cache.name, result).Inc()
+	return value, found, nil
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/metrics"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	lru := NewLRU(2, time.Hour)
+
+	assert.NoError(t, lru.Set(ctx, "a", []byte("1")))
+	assert.NoError(t, lru.Set(ctx, "b", []byte("2")))
+
+	// Reading a makes b the least recently used value, evicted by c.
+	value, found, err := lru.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("1"), value)
+
+	assert.NoError(t, lru.Set(ctx, "c", []byte("3")))
+	assert.Equal(t, 2, lru.Len())
+	_, found, _ = lru.Get(ctx, "b")
+	assert.False(t, found)
+
+	assert.NoError(t, lru.Delete(ctx, "a", "missing"))
+	_, found, _ = lru.Get(ctx, "a")
+	assert.False(t, found)
+	_, found, _ = lru.Get(ctx, "c")
+	assert.True(t, found)
+}
+
+func TestLRUExpiry(t *testing.T) {
+	ctx := context.Background()
+	lru := NewLRU(2, -time.Second)
+
+	assert.NoError(t, lru.Set(ctx, "a", []byte("1")))
+	_, found, err := lru.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, 0, lru.Len())
+}
+
+func TestInstrument(t *testing.T) {
+	ctx := context.Background()
+	instrumented := Instrument("test", NewLRU(1, time.Hour))
+	hits := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("test", "hit"))
+	misses := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("test", "miss"))
+
+	_, _, _ = instrumented.Get(ctx, "a")
+	assert.NoError(t, instrumented.Set(ctx, "a", []byte("1")))
+	_, _, _ = instrumented.Get(ctx, "a")
+
+	assert.Equal(t, hits+1, testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("test", "hit")))
+	assert.Equal(t, misses+1, testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("test", "miss")))
+}
+
+// loopback broadcasts to every replica, the sender included, as an exchange does.
+type loopback struct {
+	replicas []*Replicated
+}
+
+func (l *loopback) Broadcast(ctx context.Context, data []byte) error {
+	for _, replica := range l.replicas {
+		if err := replica.Receive(ctx, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestReplicated(t *testing.T) {
+	ctx := context.Background()
+	broadcaster := &loopback{}
+	first := NewReplicated(NewLRU(10, time.Hour), broadcaster)
+	second := NewReplicated(NewLRU(10, time.Hour), broadcaster)
+	broadcaster.replicas = []*Replicated{first, second}
+
+	for _, replica := range broadcaster.replicas {
+		assert.NoError(t, replica.Set(ctx, "tenant:1", []byte("Acme")))
+		assert.NoError(t, replica.Set(ctx, "tenant:2", []byte("Globex")))
+	}
+
+	assert.NoError(t, first.Delete(ctx, "tenant:1"))
+	for _, replica := range broadcaster.replicas {
+		_, found, _ := replica.Get(ctx, "tenant:1")
+		assert.False(t, found)
+		_, found, _ = replica.Get(ctx, "tenant:2")
+		assert.True(t, found)
+	}
+
+	assert.Error(t, second.Receive(ctx, []byte("not json")))
+}
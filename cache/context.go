@@ -0,0 +1,20 @@
+package cache
+
+import "context"
+
+// contextKey is the context key of the cache.
+type contextKey struct{}
+
+// NewContext is used to carry cache in ctx, for the models reading through it.
+func NewContext(ctx context.Context, cache Cache) context.Context {
+	return context.WithValue(ctx, contextKey{}, cache)
+}
+
+// FromContext is used to get the cache carried by ctx, nil when there is none.
+func FromContext(ctx context.Context) Cache {
+	if ctx == nil {
+		return nil
+	}
+	cache, _ := ctx.Value(contextKey{}).(Cache)
+	return cache
+}
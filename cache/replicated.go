@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	libUUID "github.com/google/uuid"
+)
+
+type (
+	// Broadcaster sends messages to every replica, the sender included.
+	Broadcaster interface {
+		Broadcast(ctx context.Context, data []byte) error
+	}
+
+	// invalidation is the message telling the other replicas to drop keys.
+	invalidation struct {
+		Origin string   `json:"origin"`
+		Keys   []string `json:"keys"`
+	}
+
+	// Replicated is a cache local to each replica, its deletions being broadcast so the others drop the same keys.
+	Replicated struct {
+		Cache
+		broadcaster Broadcaster
+		// origin names the replica, so it ignores its own invalidations.
+		origin string
+	}
+)
+
+// NewReplicated is used to spread the deletions of the local cache to the other replicas with broadcaster.
+// The invalidations they broadcast must be handed over to Receive.
+func NewReplicated(local Cache, broadcaster Broadcaster) *Replicated {
+	return &Replicated{Cache: local, broadcaster: broadcaster, origin: libUUID.NewString()}
+}
+
+// Delete is used to drop the values of keys, here and in the other replicas.
+// The local values are dropped even if the broadcast fails.
+func (cache *Replicated) Delete(ctx context.Context, keys ...string) error {
+	err := cache.Cache.Delete(ctx, keys...)
+	if err != nil {
+		return err
+	}
+
+	message, err := json.Marshal(invalidation{Origin: cache.origin, Keys: keys})
+	if err != nil {
+		return err
+	}
+	return cache.broadcaster.Broadcast(ctx, message)
+}
+
+// Receive is used to drop the keys of an invalidation broadcast by another replica.
+func (cache *Replicated) Receive(ctx context.Context, data []byte) error {
+	var message invalidation
+	err := json.Unmarshal(data, &message)
+	if err != nil {
+		return err
+	}
+
+	if message.Origin == cache.origin {
+		return nil
+	}
+	return cache.Cache.Delete(ctx, message.Keys...)
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/config"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig is used to write a configuration using a SQLite database in a temporary directory.
+func writeConfig(t *testing.T) string {
+	directory := t.TempDir()
+	file := filepath.Join(directory, "config.yaml")
+	content := `app: test
+log:
+  level: error
+database:
+  driver: sqlite
+  name: cli
+  dsn: ` + filepath.Join(directory, "cli.db") + `
+rabbitmq:
+  host: localhost
+  password: hunter2
+`
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	return file
+}
+
+// run is used to run the command line with args, returning what it printed.
+func run(t *testing.T, configFile string, args ...string) (string, error) {
+	var output bytes.Buffer
+	root := NewRootCommand()
+	root.SetOut(&output)
+	root.SetErr(&output)
+	root.SetArgs(append(args, "--config", configFile))
+
+	err := root.Execute()
+	return output.String(), err
+}
+
+func TestMigrate(t *testing.T) {
+	configFile := writeConfig(t)
+
+	output, err := run(t, configFile, "migrate", "status")
+	assert.NoError(t, err)
+	assert.Regexp(t, `tenant\s+missing`, output)
+
+	_, err = run(t, configFile, "migrate", "up")
+	assert.NoError(t, err)
+	output, err = run(t, configFile, "migrate", "status")
+	assert.NoError(t, err)
+	assert.Regexp(t, `tenant\s+up to date`, output)
+	assert.Regexp(t, `idempotency_key\s+up to date`, output)
+
+	_, err = run(t, configFile, "migrate", "down")
+	assert.Error(t, err)
+	_, err = run(t, configFile, "migrate", "down", "--yes")
+	assert.NoError(t, err)
+	output, err = run(t, configFile, "migrate", "status")
+	assert.NoError(t, err)
+	assert.Regexp(t, `tenant\s+missing`, output)
+}
+
+func TestTenant(t *testing.T) {
+	configFile := writeConfig(t)
+	_, err := run(t, configFile, "migrate", "up")
+	assert.NoError(t, err)
+
+	output, err := run(t, configFile, "tenant", "create", "Acme Corp", "--plan", "pro", "--id", "39b0b2fc-749f-46f3-8960-453418e72b2e")
+	assert.NoError(t, err)
+	assert.Equal(t, "39b0b2fc-749f-46f3-8960-453418e72b2e\n", output)
+
+	output, err = run(t, configFile, "tenant", "list")
+	assert.NoError(t, err)
+	assert.Regexp(t, `39b0b2fc-749f-46f3-8960-453418e72b2e\s+Acme Corp\s+acme-corp\s+active\s+pro`, output)
+
+	_, err = run(t, configFile, "tenant", "delete", "39b0b2fc-749f-46f3-8960-453418e72b2e")
+	assert.NoError(t, err)
+	output, err = run(t, configFile, "tenant", "list")
+	assert.NoError(t, err)
+	assert.NotContains(t, output, "Acme Corp")
+
+	_, err = run(t, configFile, "tenant", "delete", "39b0b2fc-749f-46f3-8960-453418e72b2e")
+	assert.Error(t, err)
+	_, err = run(t, configFile, "tenant", "delete", "39b0b2fc-749f-46f3-8960-453418e72b2e", "--hard")
+	assert.NoError(t, err)
+}
+
+func TestPolicy(t *testing.T) {
+	configFile := writeConfig(t)
+
+	// The policy changes are recorded in the audit trail.
+	_, err := run(t, configFile, "migrate", "up")
+	assert.NoError(t, err)
+
+	_, err = run(t, configFile, "policy", "add", "guest", "/v2/tenants/:id", "DELETE")
+	assert.NoError(t, err)
+	_, err = run(t, configFile, "policy", "add", "guest", "/v2/tenants/:id", "DELETE")
+	assert.EqualError(t, err, "policy already exists")
+
+	output, err := run(t, configFile, "policy", "list")
+	assert.NoError(t, err)
+	assert.Regexp(t, `guest\s+/v2/tenants/:id\s+DELETE`, output)
+
+	_, err = run(t, configFile, "policy", "remove", "guest", "/v2/tenants/:id", "DELETE")
+	assert.NoError(t, err)
+	output, err = run(t, configFile, "policy", "list")
+	assert.NoError(t, err)
+	assert.NotContains(t, output, "DELETE")
+
+	appConfig, err := config.LoadFile(configFile)
+	assert.NoError(t, err)
+	db, err := database.Open(appConfig.Database)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var entries []audit.ModelAuditEntry
+	assert.NoError(t, db.Order("id").Find(&entries).Error)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, audit.ActionPolicyAdd, entries[0].Action)
+		assert.Equal(t, audit.ActionPolicyRemove, entries[1].Action)
+		assert.True(t, strings.HasPrefix(entries[0].Actor, "cli"))
+	}
+
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	assert.NoError(t, sqlDB.Close())
+}
+
+func TestConfigPrint(t *testing.T) {
+	configFile := writeConfig(t)
+
+	output, err := run(t, configFile, "config", "print")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "password: hunter2")
+
+	output, err = run(t, configFile, "config", "print", "--redacted")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "password: REDACTED")
+	assert.Contains(t, output, "dsn: REDACTED")
+	assert.Contains(t, output, "driver: sqlite")
+	assert.Contains(t, output, "timeout: 10s")
+	assert.False(t, strings.Contains(output, "hunter2"))
+}
+
+func TestInvalidDuration(t *testing.T) {
+	configFile := writeConfig(t)
+	file, err := os.OpenFile(configFile, os.O_APPEND|os.O_WRONLY, 0o600)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = file.WriteString("outbox:\n  relayinterval: 0s\n")
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	_, err = run(t, configFile, "migrate", "status")
+	assert.EqualError(t, err, `outbox.relayinterval must be a positive duration, got "0s"`)
+}
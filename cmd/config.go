@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/config"
+	"gopkg.in/yaml.v3"
+)
+
+func newConfigCommand() *cobra.Command {
+	configCommand := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+
+	printCommand := &cobra.Command{
+		Use:   "print",
+		Short: "Print the configuration read, defaults included",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			file, err := cmd.Flags().GetString(configFlag)
+			if err != nil {
+				return err
+			}
+			redacted, err := cmd.Flags().GetBool("redacted")
+			if err != nil {
+				return err
+			}
+
+			settings, err := config.Settings(file, redacted)
+			if err != nil {
+				return err
+			}
+
+			encoder := yaml.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent(2)
+			err = encoder.Encode(settings)
+			if err != nil {
+				return err
+			}
+			return encoder.Close()
+		},
+	}
+	printCommand.Flags().Bool("redacted", false, "hide the passwords and data sources")
+
+	configCommand.AddCommand(printCommand)
+	return configCommand
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/migrate"
+	"strings"
+	"text/tabwriter"
+)
+
+const confirmFlag = "yes"
+
+func newMigrateCommand() *cobra.Command {
+	migrateCommand := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the database schema",
+	}
+
+	down := &cobra.Command{
+		Use:   "down",
+		Short: "Drop the tables of the models, with their data",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			confirmed, err := cmd.Flags().GetBool(confirmFlag)
+			if err != nil {
+				return err
+			}
+			if !confirmed {
+				return errors.New("dropping the tables deletes their data, confirm with --" + confirmFlag)
+			}
+
+			_, db, closeDatabase, err := openDatabase(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeDatabase()
+
+			err = migrate.Down(db)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Tables dropped")
+			return nil
+		},
+	}
+	down.Flags().Bool(confirmFlag, false, "confirm the tables are dropped")
+
+	migrateCommand.AddCommand(
+		&cobra.Command{
+			Use:   "up",
+			Short: "Create or update the tables of the models",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				_, db, closeDatabase, err := openDatabase(cmd)
+				if err != nil {
+					return err
+				}
+				defer closeDatabase()
+
+				err = migrate.Run(db)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "Database migrated")
+				return nil
+			},
+		},
+		down,
+		&cobra.Command{
+			Use:   "status",
+			Short: "Show the tables and columns missing from the database",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				_, db, closeDatabase, err := openDatabase(cmd)
+				if err != nil {
+					return err
+				}
+				defer closeDatabase()
+
+				statuses, err := migrate.Status(db)
+				if err != nil {
+					return err
+				}
+
+				writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+				fmt.Fprintln(writer, "TABLE\tSTATUS\tMISSING COLUMNS")
+				for _, status := range statuses {
+					state := "missing"
+					if status.Exists && len(status.MissingColumns) == 0 {
+						state = "up to date"
+					} else if status.Exists {
+						state = "outdated"
+					}
+					fmt.Fprintf(writer, "%s\t%s\t%s\n", status.Table, state, strings.Join(status.MissingColumns, ", "))
+				}
+				return writer.Flush()
+			},
+		},
+	)
+	return migrateCommand
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/casbin/casbin/v2"
+	"github.com/spf13/cobra"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/policy"
+	"strings"
+	"text/tabwriter"
+)
+
+// openPolicy is used to load the policy stored in the configured database.
+// The returned context carries the database, and the returned function closes it.
+func openPolicy(cmd *cobra.Command) (context.Context, *casbin.Enforcer, func() error, error) {
+	ctx, db, closeDatabase, err := openDatabase(cmd)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	enforcer, err := policy.InitPolicy(db)
+	if err != nil {
+		return nil, nil, nil, errors.Join(err, closeDatabase())
+	}
+	return ctx, enforcer, closeDatabase, nil
+}
+
+func newPolicyCommand() *cobra.Command {
+	policyCommand := &cobra.Command{
+		Use:   "policy",
+		Short: "Manage the authorization policies",
+	}
+
+	policyCommand.AddCommand(
+		&cobra.Command{
+			Use:   "list",
+			Short: "List the policies",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				_, enforcer, closeDatabase, err := openPolicy(cmd)
+				if err != nil {
+					return err
+				}
+				defer closeDatabase()
+
+				policies, err := enforcer.GetPolicy()
+				if err != nil {
+					return err
+				}
+
+				writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+				fmt.Fprintln(writer, "SUBJECT\tOBJECT\tACTION")
+				for _, rule := range policies {
+					fmt.Fprintln(writer, strings.Join(rule, "\t"))
+				}
+				return writer.Flush()
+			},
+		},
+		&cobra.Command{
+			Use:     "add SUBJECT OBJECT ACTION",
+			Short:   "Allow a subject to run an action on an object",
+			Example: `  server policy add guest /v2/tenants "DELETE"`,
+			Args:    cobra.ExactArgs(3),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				ctx, enforcer, closeDatabase, err := openPolicy(cmd)
+				if err != nil {
+					return err
+				}
+				defer closeDatabase()
+
+				err = policy.Grant(ctx, enforcer, args[0], args[1], args[2])
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "Policy added")
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "remove SUBJECT OBJECT ACTION",
+			Short: "Revoke a policy",
+			Args:  cobra.ExactArgs(3),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				ctx, enforcer, closeDatabase, err := openPolicy(cmd)
+				if err != nil {
+					return err
+				}
+				defer closeDatabase()
+
+				err = policy.Revoke(ctx, enforcer, args[0], args[1], args[2])
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "Policy removed")
+				return nil
+			},
+		},
+	)
+	return policyCommand
+}
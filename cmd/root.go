@@ -0,0 +1,92 @@
+// Package cmd is the command line of the server: serving the API, and administering its database, policies and tasks.
+package cmd
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/config"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"gorm.io/gorm"
+	"os"
+	"os/user"
+)
+
+const configFlag = "config"
+
+// NewRootCommand is used to create the command line, serving the API when run without a subcommand.
+func NewRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:           "server",
+		Short:         "Tenants REST API server and administration",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          cobra.NoArgs,
+		RunE:          runServe,
+	}
+	root.PersistentFlags().String(configFlag, "", "configuration file (default is ./config.yaml)")
+
+	root.AddCommand(newServeCommand(), newMigrateCommand(), newPolicyCommand(), newTenantCommand(), newTaskCommand(), newConfigCommand())
+	return root
+}
+
+// Execute is used to run the command line with the arguments of the process, exiting with 1 on error.
+func Execute() {
+	err := NewRootCommand().Execute()
+	if err != nil {
+		logger := logging.Component("cli")
+		logger.Error().Err(err).Msg("Error running the command")
+		os.Exit(1)
+	}
+}
+
+// loadConfig is used to read the configuration the command was given, and configure the logs from it.
+func loadConfig(cmd *cobra.Command) (config.Config, error) {
+	file, err := cmd.Flags().GetString(configFlag)
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	appConfig, err := config.LoadFile(file)
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	err = logging.Configure(appConfig.IsProd(), appConfig.Log.Level, appConfig.Log.Components)
+	return appConfig, err
+}
+
+// openDatabase is used to open the configured database, and get a context carrying it for the models,
+// along with the user running the command as the audit actor.
+// The returned function closes the database.
+func openDatabase(cmd *cobra.Command) (context.Context, *gorm.DB, func() error, error) {
+	appConfig, err := loadConfig(cmd)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	db, err := database.Open(appConfig.Database)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	closeDatabase := func() error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Close()
+	}
+	ctx := audit.NewContext(database.NewContext(cmd.Context(), db), audit.Actor{Subject: cliSubject()})
+	return ctx, db, closeDatabase, nil
+}
+
+// cliSubject is used to name the actor of the changes made through the command line, after the user running it.
+func cliSubject() string {
+	current, err := user.Current()
+	if err != nil {
+		return "cli"
+	}
+	return "cli:" + current.Username
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/app"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/lifecycle"
+)
+
+func newServeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the API, the WebSocket events and the task consumers until SIGINT or SIGTERM",
+		Args:  cobra.NoArgs,
+		RunE:  runServe,
+	}
+}
+
+func runServe(cmd *cobra.Command, _ []string) error {
+	appConfig, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	application, err := app.New(appConfig)
+	if err != nil {
+		return err
+	}
+
+	err = application.Start(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	// On SIGINT or SIGTERM, the app is stopped within its shutdown timeout.
+	lifecycle.WaitForSignal()
+	return application.Stop(context.Background())
+}
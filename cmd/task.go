@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	libUUID "github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/rabbitmq"
+	"text/tabwriter"
+)
+
+// errTaskNotFound is returned when no event of the task is waiting in the queue.
+var errTaskNotFound = errors.New("no event of the task is waiting in the queue")
+
+func newTaskCommand() *cobra.Command {
+	taskCommand := &cobra.Command{
+		Use:   "task",
+		Short: "Inspect the tasks",
+	}
+
+	taskCommand.AddCommand(&cobra.Command{
+		Use:   "show ID",
+		Short: "Show the events of a task still waiting in the push queue, without consuming them",
+		Long: "Show the events of a task still waiting in the push queue, without consuming them.\n" +
+			"Tasks aren't stored, so the events already consumed can't be shown.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := libUUID.Parse(args[0])
+			if err != nil {
+				return err
+			}
+
+			appConfig, err := loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			tasks, err := rabbitmq.PeekTasks(appConfig.RabbitMQ.Access(), appConfig.RabbitMQ.PushQueue)
+			if err != nil {
+				return err
+			}
+
+			writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(writer, "STATUS\tPROGRESS\tDESCRIPTION\tREQUEST ID")
+			found := false
+			for _, task := range tasks {
+				if task.ID != id {
+					continue
+				}
+				found = true
+				fmt.Fprintf(writer, "%s\t%.0f%%\t%s\t%s\n", task.Status, task.Progress*100, task.Description, task.RequestID)
+			}
+			if !found {
+				return errTaskNotFound
+			}
+			return writer.Flush()
+		},
+	})
+	return taskCommand
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	libUUID "github.com/google/uuid"
+	"github.com/spf13/cobra"
+	tenantModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/tenant"
+	"text/tabwriter"
+)
+
+func newTenantCommand() *cobra.Command {
+	tenantCommand := &cobra.Command{
+		Use:   "tenant",
+		Short: "Manage the tenants",
+	}
+
+	create := &cobra.Command{
+		Use:   "create NAME",
+		Short: "Create an active tenant",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, _ := cmd.Flags().GetString("id")
+			plan, _ := cmd.Flags().GetString("plan")
+			email, _ := cmd.Flags().GetString("email")
+
+			tenant := tenantModel.ModelTenant{Name: args[0], Plan: plan, ContactEmail: email}
+			if id != "" {
+				uuid, err := libUUID.Parse(id)
+				if err != nil {
+					return err
+				}
+				tenant.UUID = uuid
+			}
+
+			ctx, _, closeDatabase, err := openDatabase(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeDatabase()
+
+			_, err = tenant.WithContext(ctx).Save()
+			if err != nil {
+				return err
+			}
+
+			_, err = tenant.Activate()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), tenant.UUID)
+			return nil
+		},
+	}
+	create.Flags().String("id", "", "ID of the tenant, generated when empty")
+	create.Flags().String("plan", "free", "plan of the tenant: free, pro or enterprise")
+	create.Flags().String("email", "", "contact email of the tenant")
+
+	deleteCommand := &cobra.Command{
+		Use:   "delete ID",
+		Short: "Move a tenant to the trash, or drop it with --hard",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hard, _ := cmd.Flags().GetBool("hard")
+			uuid, err := libUUID.Parse(args[0])
+			if err != nil {
+				return err
+			}
+
+			ctx, _, closeDatabase, err := openDatabase(cmd)
+			if err != nil {
+				return err
+			}
+			defer closeDatabase()
+
+			tenant := tenantModel.ModelTenant{UUID: uuid}
+			var isDeleted bool
+			if hard {
+				isDeleted, err = tenant.WithContext(ctx).HardDelete()
+			} else {
+				isDeleted, err = tenant.WithContext(ctx).Delete()
+			}
+			if err != nil {
+				return err
+			}
+			if !isDeleted {
+				return tenantModel.ErrNotFound
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Tenant deleted")
+			return nil
+		},
+	}
+	deleteCommand.Flags().Bool("hard", false, "drop the tenant instead of moving it to the trash")
+
+	tenantCommand.AddCommand(
+		&cobra.Command{
+			Use:   "list",
+			Short: "List the tenants, the ones in the trash excluded",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				ctx, _, closeDatabase, err := openDatabase(cmd)
+				if err != nil {
+					return err
+				}
+				defer closeDatabase()
+
+				tenants, err := (&tenantModel.ModelTenant{}).WithContext(ctx).GetAll()
+				if err != nil {
+					return err
+				}
+
+				writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+				fmt.Fprintln(writer, "ID\tNAME\tSLUG\tSTATUS\tPLAN")
+				for _, tenant := range *tenants {
+					fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", tenant.UUID, tenant.Name, tenant.Slug, tenant.Status, tenant.Plan)
+				}
+				return writer.Flush()
+			},
+		},
+		create,
+		deleteCommand,
+	)
+	return tenantCommand
+}
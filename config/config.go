@@ -3,76 +3,456 @@ package config
 import (
 	"fmt"
 	"github.com/spf13/viper"
-	"strings"
+	"time"
 )
 
-func getViper() *viper.Viper {
+const (
+	// DriverPostgres is the database driver used in production.
+	DriverPostgres = "postgres"
+	// DriverSQLite is the database driver used by tests, its DSN being the database file.
+	DriverSQLite = "sqlite"
+
+	// RateLimitStoreMemory keeps the rate limit buckets of each replica in its memory.
+	RateLimitStoreMemory = "memory"
+	// RateLimitStoreDatabase keeps the rate limit buckets in the database, shared by the replicas.
+	RateLimitStoreDatabase = "database"
+
+	// RateLimitKeyTenant counts the requests by tenant, then by subject, then by IP address.
+	RateLimitKeyTenant = "tenant"
+	// RateLimitKeySubject counts the requests by authenticated subject, then by IP address.
+	RateLimitKeySubject = "subject"
+	// RateLimitKeyIP counts the requests by IP address.
+	RateLimitKeyIP = "ip"
+
+	redactedValue = "REDACTED"
+)
+
+type (
+	// Config is the configuration of the app, read once from config.yaml by Load.
+	Config struct {
+		// App is the environment, prod or anything else.
+		App string
+		// Address is the host:port the API listens on, port 0 picking a free one.
+		Address string
+		// WebSocketAddress is the host:port the WebSocket server listens on.
+		WebSocketAddress string
+		Database         Database
+		RabbitMQ         RabbitMQ
+		Tenant           Tenant
+		// IdempotencyTTL is how long responses are kept for replay of a same Idempotency-Key.
+		IdempotencyTTL time.Duration
+		// API holds the deprecation schedule of each version of the API, by name.
+		API       map[string]APIVersion
+		Log       Log
+		Tracing   Tracing
+		RateLimit RateLimit
+		CORS      CORS
+		Security  Security
+		Cache     Cache
+		Outbox    Outbox
+		Webhook   Webhook
+		// ShutdownTimeout is how long the app is given to stop once asked to terminate.
+		ShutdownTimeout time.Duration
+	}
+
+	// Database is the database configuration.
+	Database struct {
+		// Driver is DriverPostgres or DriverSQLite.
+		Driver   string
+		Host     string
+		Name     string
+		User     string
+		Password string
+		// DSN overrides the data source built from the other fields, it is the file for DriverSQLite.
+		DSN string
+	}
+
+	// RabbitMQ is the broker configuration.
+	RabbitMQ struct {
+		Host        string
+		User        string
+		Password    string
+		PushQueue   string
+		ListenQueue string
+		// InMemory runs a fake broker within the app instead of connecting to Host, for tests.
+		InMemory bool
+	}
+
+	// Tenant is the configuration of the tenant trash.
+	Tenant struct {
+		// Retention is how long deleted tenants are kept in the trash before being purged.
+		Retention time.Duration
+		// PurgeInterval is how often the trash is checked for tenants to purge.
+		PurgeInterval time.Duration
+	}
+
+	// APIVersion is the deprecation schedule of a version of the API.
+	APIVersion struct {
+		// Deprecation is when the version was deprecated, zero while it is supported.
+		Deprecation time.Time
+		// Sunset is when the version stops being served, zero while it isn't planned.
+		Sunset time.Time
+	}
+
+	// RateLimit is the configuration of the rate limiter.
+	RateLimit struct {
+		// Store is where the buckets are kept: RateLimitStoreMemory or RateLimitStoreDatabase.
+		Store string
+		// Key is what the requests are counted by: RateLimitKeyTenant, RateLimitKeySubject or RateLimitKeyIP.
+		Key string
+		// Default is the quota of the requests with no plan nor route quota.
+		Default RateLimitQuota
+		// Plans holds the quotas of the tenants, by plan.
+		Plans map[string]RateLimitQuota
+		// Routes holds the quotas of routes, counted apart from the other routes.
+		Routes []RateLimitRoute
+	}
+
+	// RateLimitQuota is a token bucket: Burst requests at once, refilled at Rate requests per second.
+	// A zero Rate is unlimited.
+	RateLimitQuota struct {
+		Rate  float64
+		Burst int
+	}
+
+	// RateLimitRoute is the quota of a route, Path being the route path such as /v2/tenants/:id.
+	RateLimitRoute struct {
+		Method string
+		Path   string
+		Rate   float64
+		Burst  int
+	}
+
+	// CORS is the cross-origin policy of the API, answered to preflight requests before authorization.
+	CORS struct {
+		// AllowOrigins are the origins allowed to call the API, * allowing any of them.
+		AllowOrigins []string
+		// AllowHeaders are the request headers allowed, the ones asked for by the preflight when empty.
+		AllowHeaders []string
+		// AllowCredentials lets browsers send cookies and authorization headers, it requires listed origins.
+		AllowCredentials bool
+		// MaxAge is how long browsers can cache the preflight response, not cached when zero.
+		MaxAge time.Duration
+	}
+
+	// Security is the configuration of the security headers sent with every response.
+	// Empty headers aren't sent.
+	Security struct {
+		XSSProtection      string
+		ContentTypeNosniff string
+		FrameOptions       string
+		ReferrerPolicy     string
+		// ContentSecurityPolicy is sent as Content-Security-Policy-Report-Only when CSPReportOnly is set.
+		ContentSecurityPolicy string
+		CSPReportOnly         bool
+		// HSTSMaxAge is how long browsers must only use HTTPS, only sent on TLS requests and not sent when zero.
+		HSTSMaxAge            time.Duration
+		HSTSExcludeSubdomains bool
+		HSTSPreload           bool
+	}
+
+	// Cache is the configuration of the in-process cache of the tenant reads.
+	Cache struct {
+		// Size is the number of values kept by each replica, zero disabling the cache.
+		Size int
+		// TTL is how long values are kept, bounding how stale they are when changed out of the app.
+		TTL time.Duration
+		// Exchange is the RabbitMQ exchange the replicas broadcast their invalidations on.
+		Exchange string
+	}
+
+	// Outbox is the configuration of the relay publishing the task events written to the outbox.
+	Outbox struct {
+		// RelayInterval is how often the outbox is checked for the events left, such as while the broker is down.
+		RelayInterval time.Duration
+		// BatchSize is the number of events published per transaction.
+		BatchSize int
+		// Retention is how long the published events are kept.
+		Retention time.Duration
+		// PurgeInterval is how often the published events past their retention are dropped.
+		PurgeInterval time.Duration
+	}
+
+	// Webhook is the configuration of the dispatcher sending the webhook deliveries.
+	Webhook struct {
+		// Timeout is how long a subscription is given to answer a delivery.
+		Timeout time.Duration
+		// MaxAttempts is the number of attempts after which a delivery is given up.
+		MaxAttempts int
+		// Backoff is the delay before the second attempt, doubled on each of the next ones up to MaxBackoff.
+		Backoff    time.Duration
+		MaxBackoff time.Duration
+		// Interval is how often the deliveries due are checked for.
+		Interval time.Duration
+		// BatchSize is the number of deliveries claimed at once.
+		BatchSize int
+		// Retention is how long the finished deliveries are kept in the delivery log.
+		Retention time.Duration
+		// PurgeInterval is how often the finished deliveries past their retention are dropped.
+		PurgeInterval time.Duration
+		// AllowPrivate lets the deliveries reach loopback, private and link-local addresses, for development.
+		AllowPrivate bool
+	}
+
+	// Log is the configuration of the loggers.
+	Log struct {
+		// Level is the default level of the loggers.
+		Level string
+		// Components holds the levels overriding the default one, by component name.
+		Components map[string]string
+	}
+
+	// Tracing is the configuration of the trace exporter.
+	Tracing struct {
+		// Exporter is where the spans are exported: otlp, stdout or none.
+		Exporter string
+		// Endpoint is the host:port of the OTLP collector.
+		Endpoint string
+		// File is the file the stdout exporter writes to, stdout when empty.
+		File string
+		// ServiceName is the service name the spans are reported under.
+		ServiceName string
+	}
+)
+
+func getViper(file string) (*viper.Viper, error) {
 	vp := viper.New()
 	vp.SetConfigName("config")
 	vp.SetConfigType("yaml")
 	vp.AddConfigPath(".")
+	if file != "" {
+		vp.SetConfigFile(file)
+	}
+	vp.SetDefault("database.driver", DriverPostgres)
+	vp.SetDefault("tenant.retention", "720h")
+	vp.SetDefault("tenant.purgeinterval", "1h")
+	vp.SetDefault("idempotency.ttl", "24h")
+	vp.SetDefault("log.level", "info")
+	vp.SetDefault("tracing.exporter", "none")
+	vp.SetDefault("tracing.endpoint", "localhost:4318")
+	vp.SetDefault("tracing.servicename", "go-rest-boilerplate-echo")
+	vp.SetDefault("shutdown.timeout", "10s")
+	vp.SetDefault("ratelimit.store", RateLimitStoreMemory)
+	vp.SetDefault("ratelimit.key", RateLimitKeyTenant)
+	vp.SetDefault("ratelimit.rate", 10)
+	vp.SetDefault("ratelimit.burst", 30)
+	vp.SetDefault("cache.size", 1000)
+	vp.SetDefault("cache.ttl", "1m")
+	vp.SetDefault("cache.exchange", "cache.invalidation")
+	vp.SetDefault("outbox.relayinterval", "1s")
+	vp.SetDefault("outbox.batchsize", 100)
+	vp.SetDefault("outbox.retention", "24h")
+	vp.SetDefault("outbox.purgeinterval", "1h")
+	vp.SetDefault("webhook.timeout", "10s")
+	vp.SetDefault("webhook.maxattempts", 8)
+	vp.SetDefault("webhook.backoff", "10s")
+	vp.SetDefault("webhook.maxbackoff", "1h")
+	vp.SetDefault("webhook.interval", "1s")
+	vp.SetDefault("webhook.batchsize", 50)
+	vp.SetDefault("webhook.retention", "168h")
+	vp.SetDefault("webhook.purgeinterval", "1h")
+	vp.SetDefault("webhook.allowprivate", false)
+	vp.SetDefault("cors.alloworigins", []string{"*"})
+	vp.SetDefault("security.xssprotection", "1; mode=block")
+	vp.SetDefault("security.contenttypenosniff", "nosniff")
+	vp.SetDefault("security.frameoptions", "SAMEORIGIN")
 	err := vp.ReadInConfig()
 
 	if err != nil {
-		panic(fmt.Errorf("error: %s", err))
+		return nil, fmt.Errorf("error: %s", err)
 	}
-	return vp
-}
 
-// IsProd to get the env for prod or not.
-func IsProd() bool {
-	return getViper().Get("app") == "prod"
+	// Production is served over HTTPS only, and never framed.
+	if vp.GetString("app") == "prod" {
+		vp.SetDefault("security.hsts.maxage", "8760h")
+		vp.SetDefault("security.frameoptions", "DENY")
+	}
+	return vp, nil
 }
 
-// GetPort is used to get the webserver port to listen on.
-func GetPort() string {
-	address := getViper().Get("address").(string)
+// positiveDurations are the durations which must be above zero, as they set tickers, timeouts and lifetimes.
+var positiveDurations = []string{
+	"tenant.retention", "tenant.purgeinterval", "idempotency.ttl", "cache.ttl",
+	"outbox.relayinterval", "outbox.retention", "outbox.purgeinterval",
+	"webhook.timeout", "webhook.backoff", "webhook.maxbackoff", "webhook.interval", "webhook.retention", "webhook.purgeinterval",
+	"shutdown.timeout",
+}
 
-	return strings.Split(address, ":")[1]
+// Load is used to read the configuration from config.yaml, in the working directory.
+func Load() (Config, error) {
+	return LoadFile("")
 }
 
-// GetAddress is used to get the webserver host to listen on.
-func GetAddress() string {
-	return getViper().Get("address").(string)
+// LoadFile is used to read the configuration from file, config.yaml in the working directory when empty.
+func LoadFile(file string) (Config, error) {
+	v, err := getViper(file)
+	if err != nil {
+		return Config{}, err
+	}
+
+	for _, key := range positiveDurations {
+		if v.GetDuration(key) <= 0 {
+			return Config{}, fmt.Errorf("%s must be a positive duration, got %q", key, v.GetString(key))
+		}
+	}
+
+	var rateLimitRoutes []RateLimitRoute
+	err = v.UnmarshalKey("ratelimit.routes", &rateLimitRoutes)
+	if err != nil {
+		return Config{}, err
+	}
+
+	rateLimitPlans := map[string]RateLimitQuota{}
+	for plan := range v.GetStringMap("ratelimit.plans") {
+		rateLimitPlans[plan] = RateLimitQuota{
+			Rate:  v.GetFloat64("ratelimit.plans." + plan + ".rate"),
+			Burst: v.GetInt("ratelimit.plans." + plan + ".burst"),
+		}
+	}
+
+	apiVersions := map[string]APIVersion{}
+	for version := range v.GetStringMap("api") {
+		apiVersions[version] = APIVersion{
+			Deprecation: v.GetTime("api." + version + ".deprecation"),
+			Sunset:      v.GetTime("api." + version + ".sunset"),
+		}
+	}
+
+	return Config{
+		App:              v.GetString("app"),
+		Address:          v.GetString("address"),
+		WebSocketAddress: v.GetString("websocket"),
+		Database: Database{
+			Driver:   v.GetString("database.driver"),
+			Host:     v.GetString("database.host"),
+			Name:     v.GetString("database.name"),
+			User:     v.GetString("database.user"),
+			Password: v.GetString("database.password"),
+			DSN:      v.GetString("database.dsn"),
+		},
+		RabbitMQ: RabbitMQ{
+			Host:        v.GetString("rabbitmq.host"),
+			User:        v.GetString("rabbitmq.user"),
+			Password:    v.GetString("rabbitmq.password"),
+			PushQueue:   v.GetString("rabbitmq.pushqueue"),
+			ListenQueue: v.GetString("rabbitmq.listenqueue"),
+			InMemory:    v.GetBool("rabbitmq.inmemory"),
+		},
+		Tenant: Tenant{
+			Retention:     v.GetDuration("tenant.retention"),
+			PurgeInterval: v.GetDuration("tenant.purgeinterval"),
+		},
+		IdempotencyTTL: v.GetDuration("idempotency.ttl"),
+		API:            apiVersions,
+		Log: Log{
+			Level:      v.GetString("log.level"),
+			Components: v.GetStringMapString("log.components"),
+		},
+		Tracing: Tracing{
+			Exporter:    v.GetString("tracing.exporter"),
+			Endpoint:    v.GetString("tracing.endpoint"),
+			File:        v.GetString("tracing.file"),
+			ServiceName: v.GetString("tracing.servicename"),
+		},
+		RateLimit: RateLimit{
+			Store: v.GetString("ratelimit.store"),
+			Key:   v.GetString("ratelimit.key"),
+			Default: RateLimitQuota{
+				Rate:  v.GetFloat64("ratelimit.rate"),
+				Burst: v.GetInt("ratelimit.burst"),
+			},
+			Plans:  rateLimitPlans,
+			Routes: rateLimitRoutes,
+		},
+		Cache: Cache{
+			Size:     v.GetInt("cache.size"),
+			TTL:      v.GetDuration("cache.ttl"),
+			Exchange: v.GetString("cache.exchange"),
+		},
+		Outbox: Outbox{
+			RelayInterval: v.GetDuration("outbox.relayinterval"),
+			BatchSize:     v.GetInt("outbox.batchsize"),
+			Retention:     v.GetDuration("outbox.retention"),
+			PurgeInterval: v.GetDuration("outbox.purgeinterval"),
+		},
+		Webhook: Webhook{
+			Timeout:       v.GetDuration("webhook.timeout"),
+			MaxAttempts:   v.GetInt("webhook.maxattempts"),
+			Backoff:       v.GetDuration("webhook.backoff"),
+			MaxBackoff:    v.GetDuration("webhook.maxbackoff"),
+			Interval:      v.GetDuration("webhook.interval"),
+			BatchSize:     v.GetInt("webhook.batchsize"),
+			Retention:     v.GetDuration("webhook.retention"),
+			PurgeInterval: v.GetDuration("webhook.purgeinterval"),
+			AllowPrivate:  v.GetBool("webhook.allowprivate"),
+		},
+		CORS: CORS{
+			AllowOrigins:     v.GetStringSlice("cors.alloworigins"),
+			AllowHeaders:     v.GetStringSlice("cors.allowheaders"),
+			AllowCredentials: v.GetBool("cors.allowcredentials"),
+			MaxAge:           v.GetDuration("cors.maxage"),
+		},
+		Security: Security{
+			XSSProtection:         v.GetString("security.xssprotection"),
+			ContentTypeNosniff:    v.GetString("security.contenttypenosniff"),
+			FrameOptions:          v.GetString("security.frameoptions"),
+			ReferrerPolicy:        v.GetString("security.referrerpolicy"),
+			ContentSecurityPolicy: v.GetString("security.contentsecuritypolicy"),
+			CSPReportOnly:         v.GetBool("security.cspreportonly"),
+			HSTSMaxAge:            v.GetDuration("security.hsts.maxage"),
+			HSTSExcludeSubdomains: v.GetBool("security.hsts.excludesubdomains"),
+			HSTSPreload:           v.GetBool("security.hsts.preload"),
+		},
+		ShutdownTimeout: v.GetDuration("shutdown.timeout"),
+	}, nil
 }
 
-// GetWebSocketAddress is used to get the webserver host to listen on.
-func GetWebSocketAddress() string {
-	return getViper().Get("websocket").(string)
+// IsProd to get the env for prod or not.
+func (config Config) IsProd() bool {
+	return config.App == "prod"
 }
 
-// GetDatabaseAccess is used to get the database credentials.
-func GetDatabaseAccess() string {
-	v := getViper()
-	connection := fmt.Sprintf(
+// Access is used to get the data source of the database.
+func (database Database) Access() string {
+	if database.DSN != "" {
+		return database.DSN
+	}
+
+	return fmt.Sprintf(
 		"host=%s port=5432 user=%s password=%s dbname=%s sslmode=disable",
-		v.Get("database.host"),
-		v.Get("database.user"),
-		v.Get("database.password"),
-		v.Get("database.name"),
+		database.Host,
+		database.User,
+		database.Password,
+		database.Name,
 	)
-	return connection
 }
 
-// GetRabbitMQAccess is used to get the rabbitmq credentials.
-func GetRabbitMQAccess() string {
-	v := getViper()
-	connection := fmt.Sprintf("amqp://%s:%s@%s/",
-		v.Get("rabbitmq.user"),
-		v.Get("rabbitmq.password"),
-		v.Get("rabbitmq.host"),
+// Access is used to get the URL of the broker.
+func (rabbitMQ RabbitMQ) Access() string {
+	return fmt.Sprintf("amqp://%s:%s@%s/",
+		rabbitMQ.User,
+		rabbitMQ.Password,
+		rabbitMQ.Host,
 	)
-	return connection
 }
 
-// GetAMQPPushQueue is used to get the env value for queue to push events.
-func GetAMQPPushQueue() string {
-	v := getViper()
-	return fmt.Sprintf("%s", v.Get("rabbitmq.pushqueue"))
-}
+// secrets are the settings hidden by Settings when redacted.
+var secrets = []string{"database.password", "database.dsn", "rabbitmq.password"}
 
-// GetAMQPQListenQueue is used to get the env value for queue to listen to events.
-func GetAMQPQListenQueue() string {
-	v := getViper()
-	return fmt.Sprintf("%s", v.Get("rabbitmq.listenqueue"))
+// Settings is used to get every setting read from file, defaults included, by section.
+// When redacted, the secrets which are set are replaced, so the settings can be printed.
+func Settings(file string, redacted bool) (map[string]interface{}, error) {
+	v, err := getViper(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if redacted {
+		for _, secret := range secrets {
+			if v.GetString(secret) != "" {
+				v.Set(secret, redactedValue)
+			}
+		}
+	}
+	return v.AllSettings(), nil
 }
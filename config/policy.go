@@ -0,0 +1,10 @@
+package config
+
+import (
+	_ "embed" // Embeds the policy model.
+)
+
+// PolicyModel is the Casbin model the policies are checked with, embedded so the binary runs from any directory.
+//
+//go:embed keymatch_model
+var PolicyModel string
@@ -1,11 +1,15 @@
 package database
 
 import (
+	"context"
+	"fmt"
 	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/config"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/metrics"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/tracing"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"log"
 	"sync"
 )
 
@@ -14,14 +18,52 @@ var once sync.Once
 // Client is gorm database client.
 var Client *gorm.DB
 
-// Connect is used to create the database client.
+type contextKey struct{}
+
+// Open is used to create a database client, its queries being logged, timed and traced.
+// Its pool stats are collected under the name of the database, which must be unique within the process.
+func Open(databaseConfig config.Database) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch databaseConfig.Driver {
+	case config.DriverPostgres:
+		dialector = postgres.New(postgres.Config{DSN: databaseConfig.Access()})
+	case config.DriverSQLite:
+		dialector = sqlite.Open(databaseConfig.Access())
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", databaseConfig.Driver)
+	}
+
+	client, err := gorm.Open(dialector, &gorm.Config{Logger: logging.NewGormLogger(logging.Component("database"))})
+	if err != nil {
+		return nil, fmt.Errorf("GORM connect: %w", err)
+	}
+
+	err = metrics.InstrumentDB(databaseConfig.Name, client)
+	if err != nil {
+		return nil, fmt.Errorf("GORM metrics: %w", err)
+	}
+
+	err = tracing.InstrumentDB(client)
+	if err != nil {
+		return nil, fmt.Errorf("GORM tracing: %w", err)
+	}
+
+	return client, nil
+}
+
+// Connect is used to create the database client shared by the process, from config.yaml.
+// It is used by the models when their context doesn't carry a client.
 func Connect() *gorm.DB {
 	once.Do(func() {
-		connection := config.GetDatabaseAccess()
-		client, err := gorm.Open(postgres.New(postgres.Config{DSN: connection}), &gorm.Config{})
+		logger := logging.Component("database")
+		appConfig, err := config.Load()
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Error loading config")
+		}
 
+		client, err := Open(appConfig.Database)
 		if err != nil {
-			log.Fatal("Error GORM connect:", err)
+			logger.Fatal().Err(err).Msg("Error opening database")
 		}
 
 		Client = client
@@ -33,10 +75,10 @@ func Connect() *gorm.DB {
 // ConnectForTests is used to create mock database client in memory.
 func ConnectForTests() *gorm.DB {
 	once.Do(func() {
-		client, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
-
+		logger := logging.Component("database")
+		client, err := Open(config.Database{Driver: config.DriverSQLite, Name: "tenants", DSN: "file::memory:?cache=shared"})
 		if err != nil {
-			log.Fatal("Error GORM connect:", err)
+			logger.Fatal().Err(err).Msg("Error opening database")
 		}
 
 		Client = client
@@ -44,3 +86,18 @@ func ConnectForTests() *gorm.DB {
 
 	return Client
 }
+
+// NewContext is used to carry client in ctx, for the models to run their queries on it.
+func NewContext(ctx context.Context, client *gorm.DB) context.Context {
+	return context.WithValue(ctx, contextKey{}, client)
+}
+
+// FromContext is used to get the client carried by ctx, the one shared by the process when there is none.
+// Its queries run within ctx.
+func FromContext(ctx context.Context) *gorm.DB {
+	client, found := ctx.Value(contextKey{}).(*gorm.DB)
+	if !found {
+		client = Connect()
+	}
+	return client.WithContext(ctx)
+}
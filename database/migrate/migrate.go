@@ -1,16 +1,92 @@
 package migrate
 
 import (
-	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	auditModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
+	idempotencyModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/idempotency"
+	outboxModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/outbox"
+	ratelimitModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/ratelimit"
 	tenantModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/tenant"
+	webhookModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/webhook"
+	"gorm.io/gorm"
 )
 
-// RunMigrateDatabase is used to prepare for the database
-func RunMigrateDatabase() {
-	databaseClient := database.Connect()
-	err := databaseClient.AutoMigrate(&tenantModel.ModelTenant{})
+// TableStatus is whether the table of a model exists, and the columns of the model it lacks.
+type TableStatus struct {
+	Table          string
+	Exists         bool
+	MissingColumns []string
+}
+
+// models are the models migrated, in the order their tables are created.
+func models() []interface{} {
+	return []interface{}{&tenantModel.ModelTenant{}, &idempotencyModel.ModelIdempotencyKey{}, &ratelimitModel.ModelBucket{}, &auditModel.ModelAuditEntry{}, &outboxModel.ModelMessage{}, &webhookModel.ModelSubscription{}, &webhookModel.ModelDelivery{}}
+}
+
+// Run is used to prepare the database of databaseClient.
+func Run(databaseClient *gorm.DB) error {
+	err := databaseClient.AutoMigrate(models()...)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	// Idempotency keys were unique by themselves before being scoped by client.
+	migrator := databaseClient.Migrator()
+	if migrator.HasIndex(&idempotencyModel.ModelIdempotencyKey{}, "idx_idempotency_key_key") {
+		err = migrator.DropIndex(&idempotencyModel.ModelIdempotencyKey{}, "idx_idempotency_key_key")
+		if err != nil {
+			return err
+		}
+	}
+
+	// Trigram index backing the tenant name search, only available on Postgres.
+	if databaseClient.Dialector.Name() == "postgres" {
+		err = databaseClient.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error
+		if err != nil {
+			return err
+		}
+
+		err = databaseClient.Exec("CREATE INDEX IF NOT EXISTS idx_tenant_name_trgm ON tenant USING gin (name gin_trgm_ops)").Error
+		if err != nil {
+			return err
+		}
 	}
 
+	return nil
+}
+
+// Down is used to drop the tables of the models, with their data.
+func Down(databaseClient *gorm.DB) error {
+	tables := models()
+	for i := len(tables) - 1; i >= 0; i-- {
+		err := databaseClient.Migrator().DropTable(tables[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status is used to know which tables and columns of the models are missing from the database.
+func Status(databaseClient *gorm.DB) ([]TableStatus, error) {
+	migrator := databaseClient.Migrator()
+
+	var statuses []TableStatus
+	for _, model := range models() {
+		statement := &gorm.Statement{DB: databaseClient}
+		err := statement.Parse(model)
+		if err != nil {
+			return nil, err
+		}
+
+		status := TableStatus{Table: statement.Schema.Table, Exists: migrator.HasTable(model)}
+		if status.Exists {
+			for _, field := range statement.Schema.Fields {
+				if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+					status.MissingColumns = append(status.MissingColumns, field.DBName)
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
 }
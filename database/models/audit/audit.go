@@ -0,0 +1,199 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	databaseManager "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/requestid"
+	"gorm.io/gorm"
+	"reflect"
+	"time"
+)
+
+// Actions recorded in the audit trail.
+const (
+	ActionTenantCreate  = "tenant.create"
+	ActionTenantUpdate  = "tenant.update"
+	ActionTenantDelete  = "tenant.delete"
+	ActionTenantRestore = "tenant.restore"
+	ActionTenantPurge   = "tenant.purge"
+	ActionPolicyAdd     = "policy.add"
+	ActionPolicyRemove  = "policy.remove"
+)
+
+// SystemSubject is the actor of the changes made without one in their context, such as the schedulers.
+const SystemSubject = "system"
+
+// ErrAppendOnly is returned when an audit entry is changed or deleted, the trail being append-only.
+var ErrAppendOnly = errors.New("audit entries can't be changed")
+
+type (
+	// Change is the value of a field before and after a change, nil when the field didn't exist.
+	Change struct {
+		Before interface{} `json:"before,omitempty"`
+		After  interface{} `json:"after,omitempty"`
+	}
+
+	// Changes holds the changed fields, by name.
+	Changes map[string]Change
+
+	// ModelAuditEntry is a change recorded in the audit trail, with who made it from where.
+	ModelAuditEntry struct {
+		ID        uint      `gorm:"primarykey"`
+		CreatedAt time.Time `gorm:"index;not null"`
+		Actor     string    `gorm:"index;not null;type:varchar(255)"`
+		Tenant    string    `gorm:"index;type:varchar(36)"`
+		Action    string    `gorm:"index;not null;type:varchar(50)"`
+		Changes   Changes   `gorm:"serializer:json;type:text"`
+		RequestID string    `gorm:"type:varchar(128)"`
+		IP        string    `gorm:"type:varchar(45)"`
+
+		// ctx is the context the queries of the entry run within, set by WithContext.
+		ctx context.Context
+	}
+
+	// Actor is who makes the changes recorded with a context.
+	Actor struct {
+		Subject string
+		IP      string
+	}
+
+	// Filter selects audit entries, its zero fields selecting them all.
+	Filter struct {
+		Actor  string
+		Tenant string
+		Action string
+		From   time.Time
+		To     time.Time
+	}
+
+	// actorKey is the context key of the actor.
+	actorKey struct{}
+)
+
+// TableName used to set the table name.
+func (ModelAuditEntry) TableName() string {
+	return "audit_entry"
+}
+
+// BeforeUpdate used to keep the trail append-only.
+func (*ModelAuditEntry) BeforeUpdate(*gorm.DB) error {
+	return ErrAppendOnly
+}
+
+// BeforeDelete used to keep the trail append-only.
+func (*ModelAuditEntry) BeforeDelete(*gorm.DB) error {
+	return ErrAppendOnly
+}
+
+// NewContext is used to carry the actor of the changes made within ctx.
+func NewContext(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext is used to get the actor carried by ctx, SystemSubject when there is none.
+func ActorFromContext(ctx context.Context) Actor {
+	actor, exists := ctx.Value(actorKey{}).(Actor)
+	if !exists || actor.Subject == "" {
+		actor.Subject = SystemSubject
+	}
+	return actor
+}
+
+// Diff is used to get the fields whose value differs between before and after, either being nil
+// for a created or deleted record.
+func Diff(before map[string]interface{}, after map[string]interface{}) Changes {
+	changes := Changes{}
+	for field, value := range before {
+		if afterValue, exists := after[field]; !exists || !reflect.DeepEqual(value, afterValue) {
+			changes[field] = Change{Before: value, After: afterValue}
+		}
+	}
+
+	for field, value := range after {
+		if _, exists := before[field]; !exists {
+			changes[field] = Change{After: value}
+		}
+	}
+	return changes
+}
+
+// Record is used to append a change to the trail within transaction, so it is only kept if the change is.
+// The actor and request ID are taken from the context of the transaction.
+func Record(transaction *gorm.DB, action string, tenant string, changes Changes) error {
+	ctx := transaction.Statement.Context
+	actor := ActorFromContext(ctx)
+
+	return transaction.Create(&ModelAuditEntry{
+		Actor:     actor.Subject,
+		Tenant:    tenant,
+		Action:    action,
+		Changes:   changes,
+		RequestID: requestid.FromContext(ctx),
+		IP:        actor.IP,
+	}).Error
+}
+
+// WithContext is used to run the next queries of the entry within ctx, on the database client it carries.
+func (entryModel *ModelAuditEntry) WithContext(ctx context.Context) *ModelAuditEntry {
+	entryModel.ctx = ctx
+	return entryModel
+}
+
+// connect is used to get the database client, the one carried by ctx when there is one.
+func connect(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		return databaseManager.Connect()
+	}
+	return databaseManager.FromContext(ctx)
+}
+
+// Record is used to append a change to the trail on its own, for changes which aren't made through the database.
+func (entryModel *ModelAuditEntry) Record(action string, tenant string, changes Changes) error {
+	return Record(connect(entryModel.ctx), action, tenant, changes)
+}
+
+// query is used to select the entries matching filter.
+func (filter Filter) query(client *gorm.DB) *gorm.DB {
+	query := client.Model(&ModelAuditEntry{})
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Tenant != "" {
+		query = query.Where("tenant = ?", filter.Tenant)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	return query
+}
+
+// Find is used to get up to limit entries matching filter, the latest first.
+// A non zero before only selects the entries older than the entry of this ID, to get the next page.
+func (entryModel *ModelAuditEntry) Find(filter Filter, limit int, before uint) ([]ModelAuditEntry, error) {
+	query := filter.query(connect(entryModel.ctx))
+	if before != 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	var entries []ModelAuditEntry
+	err := query.Order("id DESC").Limit(limit).Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// EachInBatches is used to walk through the entries matching filter, oldest first, loading only size of them at a time.
+func (entryModel *ModelAuditEntry) EachInBatches(filter Filter, size int, fn func(entries []ModelAuditEntry) error) error {
+	var entries []ModelAuditEntry
+	return filter.query(connect(entryModel.ctx)).FindInBatches(&entries, size, func(_ *gorm.DB, _ int) error {
+		return fn(entries)
+	}).Error
+}
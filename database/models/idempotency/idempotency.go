@@ -0,0 +1,110 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	databaseManager "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the key was never used or has expired.
+	ErrNotFound = errors.New("idempotency key not found in database")
+	// ErrReserved is returned when the key is already claimed by another request.
+	ErrReserved = errors.New("idempotency key already reserved")
+)
+
+// ModelIdempotencyKey is a stored request fingerprint and its response, replayed for retried requests.
+// Keys are chosen by the clients, each client using them within its Scope. A zero StatusCode means the first
+// request is still being processed.
+type ModelIdempotencyKey struct {
+	ID          uint   `gorm:"primarykey"`
+	Scope       string `gorm:"uniqueIndex:idx_idempotency_key_scope;not null;default:'';type:varchar(255)"`
+	Key         string `gorm:"column:idempotency_key;uniqueIndex:idx_idempotency_key_scope;not null;type:varchar(255)"`
+	Fingerprint string `gorm:"not null;type:varchar(64)"`
+	StatusCode  int    `gorm:"not null;default:0"`
+	ContentType string `gorm:"type:varchar(255)"`
+	Response    []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index;not null"`
+
+	// ctx is the context the queries of the key run within, set by WithContext.
+	ctx context.Context
+}
+
+// TableName used to set the table name.
+func (ModelIdempotencyKey) TableName() string {
+	return "idempotency_key"
+}
+
+// WithContext is used to run the next queries of the key within ctx, on the database client it carries.
+func (keyModel *ModelIdempotencyKey) WithContext(ctx context.Context) *ModelIdempotencyKey {
+	keyModel.ctx = ctx
+	return keyModel
+}
+
+// connect is used to get the database client, the one carried by ctx when there is one.
+func connect(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		return databaseManager.Connect()
+	}
+	return databaseManager.FromContext(ctx)
+}
+
+// GetOne is used to retrieve an unexpired key from database, dropping it if it has expired.
+func (keyModel *ModelIdempotencyKey) GetOne() (*ModelIdempotencyKey, error) {
+	client := connect(keyModel.ctx)
+
+	err := client.Where("scope = ? AND idempotency_key = ? AND expires_at <= ?", keyModel.Scope, keyModel.Key, time.Now()).Delete(&ModelIdempotencyKey{}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Where("scope = ? AND idempotency_key = ?", keyModel.Scope, keyModel.Key).First(&keyModel).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return keyModel, nil
+}
+
+// Reserve is used to claim the key before processing the request, it fails with ErrReserved if the key is
+// already claimed.
+func (keyModel *ModelIdempotencyKey) Reserve() (*ModelIdempotencyKey, error) {
+	keyModel.StatusCode = 0
+	result := connect(keyModel.ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&keyModel)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrReserved
+	}
+	return keyModel, nil
+}
+
+// Complete is used to store the response to replay for this key.
+func (keyModel *ModelIdempotencyKey) Complete(statusCode int, contentType string, response []byte) error {
+	return connect(keyModel.ctx).Model(&keyModel).Updates(ModelIdempotencyKey{
+		StatusCode:  statusCode,
+		ContentType: contentType,
+		Response:    response,
+	}).Error
+}
+
+// Release is used to drop a reserved key, so the request can be retried.
+func (keyModel *ModelIdempotencyKey) Release() error {
+	return connect(keyModel.ctx).Where("scope = ? AND idempotency_key = ?", keyModel.Scope, keyModel.Key).Delete(&ModelIdempotencyKey{}).Error
+}
+
+// PurgeExpired is used to drop all the keys expired before the given time.
+func (keyModel *ModelIdempotencyKey) PurgeExpired(before time.Time) (int64, error) {
+	result := connect(keyModel.ctx).Where("expires_at <= ?", before).Delete(&ModelIdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
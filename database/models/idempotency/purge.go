@@ -0,0 +1,17 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	databaseManager "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"time"
+)
+
+// RunPurgeScheduler is used to periodically drop expired idempotency keys.
+// It blocks until the context is cancelled, and runs its queries on the database client the context carries.
+func RunPurgeScheduler(ctx context.Context, interval time.Duration) {
+	databaseManager.RunPurgeScheduler(ctx, interval, logging.Component("idempotency"), zerolog.InfoLevel, "expired idempotency keys", func(ctx context.Context) (int64, error) {
+		return (&ModelIdempotencyKey{}).WithContext(ctx).PurgeExpired(time.Now())
+	})
+}
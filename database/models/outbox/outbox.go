@@ -0,0 +1,161 @@
+package outbox
+
+import (
+	"context"
+	databaseManager "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// maxErrorLength is the length the error of a failed publication is truncated to.
+const maxErrorLength = 1000
+
+// ModelMessage is a message waiting to be published, written in the same transaction as the change it reports.
+// A nil SentAt means the message wasn't published yet.
+type ModelMessage struct {
+	ID            uint              `gorm:"primarykey"`
+	CreatedAt     time.Time         `gorm:"not null"`
+	Body          []byte            `gorm:"not null"`
+	CorrelationID string            `gorm:"type:varchar(128)"`
+	Headers       map[string]string `gorm:"serializer:json;type:text"`
+	Attempts      int               `gorm:"not null;default:0"`
+	LastError     string            `gorm:"type:text"`
+	// ClaimedUntil is when the relay claiming the message for publication is deemed gone, nil if unclaimed.
+	ClaimedUntil *time.Time
+	SentAt       *time.Time `gorm:"index"`
+
+	// ctx is the context the queries of the message run within, set by WithContext.
+	ctx context.Context
+}
+
+// TableName used to set the table name.
+func (ModelMessage) TableName() string {
+	return "outbox_message"
+}
+
+// WithContext is used to run the next queries of the message within ctx, on the database client it carries.
+// Messages saved with a context carrying a transaction are only published if it is committed.
+func (messageModel *ModelMessage) WithContext(ctx context.Context) *ModelMessage {
+	messageModel.ctx = ctx
+	return messageModel
+}
+
+// connect is used to get the database client, the one carried by ctx when there is one.
+func connect(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		return databaseManager.Connect()
+	}
+	return databaseManager.FromContext(ctx)
+}
+
+// Save is used to queue the message for publication.
+func (messageModel *ModelMessage) Save() (*ModelMessage, error) {
+	err := connect(messageModel.ctx).Create(messageModel).Error
+	if err != nil {
+		return nil, err
+	}
+	return messageModel, nil
+}
+
+// Relay is used to publish up to limit pending messages, oldest first, and mark the published ones as sent.
+// The messages are claimed for lease in a short transaction, other replicas skipping them, then published without
+// holding any lock. A message is published again once its lease is over if it can't be marked: they are delivered
+// at least once. Relay stops at the first message publish fails on, recording the error and releasing the next
+// ones, so the messages keep their order.
+func (messageModel *ModelMessage) Relay(limit int, lease time.Duration, publish func(message ModelMessage) error) (int, error) {
+	messages, err := messageModel.claim(limit, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	// The outcomes are recorded even if ctx is cancelled meanwhile, or the messages would wait for their lease.
+	recordContext := context.Background()
+	if messageModel.ctx != nil {
+		recordContext = context.WithoutCancel(messageModel.ctx)
+	}
+
+	client := connect(recordContext)
+	for i, message := range messages {
+		publishErr := publish(message)
+		if publishErr != nil {
+			lastError := publishErr.Error()
+			if len(lastError) > maxErrorLength {
+				lastError = lastError[:maxErrorLength]
+			}
+
+			err = client.Model(&message).Updates(map[string]interface{}{
+				"attempts":      gorm.Expr("attempts + 1"),
+				"last_error":    lastError,
+				"claimed_until": nil,
+			}).Error
+			if err != nil {
+				return i, err
+			}
+			return i, (&ModelMessage{}).WithContext(recordContext).release(messages[i+1:])
+		}
+
+		err = client.Model(&message).Updates(map[string]interface{}{
+			"attempts":      gorm.Expr("attempts + 1"),
+			"sent_at":       time.Now(),
+			"claimed_until": nil,
+		}).Error
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(messages), nil
+}
+
+// claim is used to take up to limit pending messages not claimed by another relay, oldest first, for lease.
+func (messageModel *ModelMessage) claim(limit int, lease time.Duration) ([]ModelMessage, error) {
+	var messages []ModelMessage
+	err := connect(messageModel.ctx).Transaction(func(transaction *gorm.DB) error {
+		now := time.Now()
+		err := transaction.
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("sent_at IS NULL AND (claimed_until IS NULL OR claimed_until <= ?)", now).
+			Order("id").
+			Limit(limit).
+			Find(&messages).Error
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+
+		return transaction.Model(&ModelMessage{}).Where("id IN ?", messageIDs(messages)).Update("claimed_until", now.Add(lease)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// release is used to let the other relays claim the given messages right away.
+func (messageModel *ModelMessage) release(messages []ModelMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	return connect(messageModel.ctx).Model(&ModelMessage{}).Where("id IN ?", messageIDs(messages)).Update("claimed_until", nil).Error
+}
+
+// messageIDs is used to list the IDs of the given messages.
+func messageIDs(messages []ModelMessage) []uint {
+	ids := make([]uint, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+	}
+	return ids
+}
+
+// CountPending is used to count the messages waiting to be published.
+func (messageModel *ModelMessage) CountPending() (int64, error) {
+	var count int64
+	err := connect(messageModel.ctx).Model(&ModelMessage{}).Where("sent_at IS NULL").Count(&count).Error
+	return count, err
+}
+
+// PurgeSentBefore is used to drop the messages published before the given time.
+func (messageModel *ModelMessage) PurgeSentBefore(before time.Time) (int64, error) {
+	result := connect(messageModel.ctx).Where("sent_at IS NOT NULL AND sent_at < ?", before).Delete(&ModelMessage{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,17 @@
+package outbox
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	databaseManager "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"time"
+)
+
+// RunPurgeScheduler is used to periodically drop the messages published longer than retention ago.
+// It blocks until the context is cancelled, and runs its queries on the database client the context carries.
+func RunPurgeScheduler(ctx context.Context, retention time.Duration, interval time.Duration) {
+	databaseManager.RunPurgeScheduler(ctx, interval, logging.Component("outbox"), zerolog.DebugLevel, "sent outbox messages", func(ctx context.Context) (int64, error) {
+		return (&ModelMessage{}).WithContext(ctx).PurgeSentBefore(time.Now().Add(-retention))
+	})
+}
@@ -0,0 +1,17 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	databaseManager "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"time"
+)
+
+// RunPurgeScheduler is used to periodically drop the buckets idle for longer than idle.
+// It blocks until the context is cancelled, and runs its queries on the database client the context carries.
+func RunPurgeScheduler(ctx context.Context, idle time.Duration, interval time.Duration) {
+	databaseManager.RunPurgeScheduler(ctx, interval, logging.Component("ratelimit"), zerolog.DebugLevel, "idle rate limit buckets", func(ctx context.Context) (int64, error) {
+		return (&ModelBucket{}).WithContext(ctx).PurgeIdle(time.Now().Add(-idle))
+	})
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	databaseManager "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// ModelBucket is the token bucket of a rate limited client, shared by the replicas through the database.
+type ModelBucket struct {
+	Key       string    `gorm:"column:bucket_key;primaryKey;type:varchar(255)"`
+	Tokens    float64   `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"index;not null;autoUpdateTime:false"`
+
+	// ctx is the context the queries of the bucket run within, set by WithContext.
+	ctx context.Context
+}
+
+// TableName used to set the table name.
+func (ModelBucket) TableName() string {
+	return "rate_limit_bucket"
+}
+
+// WithContext is used to run the next queries of the bucket within ctx, on the database client it carries.
+func (bucketModel *ModelBucket) WithContext(ctx context.Context) *ModelBucket {
+	bucketModel.ctx = ctx
+	return bucketModel
+}
+
+// connect is used to get the database client, the one carried by ctx when there is one.
+func connect(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		return databaseManager.Connect()
+	}
+	return databaseManager.FromContext(ctx)
+}
+
+// Update is used to count the tokens of the bucket again, its row being locked so the replicas
+// don't take the same tokens. A missing bucket is created with initial tokens first.
+// update gets the tokens and when they were last counted, and returns the tokens left at now.
+func (bucketModel *ModelBucket) Update(initial float64, now time.Time, update func(tokens float64, updatedAt time.Time) float64) error {
+	return connect(bucketModel.ctx).Transaction(func(transaction *gorm.DB) error {
+		err := transaction.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&ModelBucket{Key: bucketModel.Key, Tokens: initial, UpdatedAt: now}).Error
+		if err != nil {
+			return err
+		}
+
+		err = transaction.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("bucket_key = ?", bucketModel.Key).First(&bucketModel).Error
+		if err != nil {
+			return err
+		}
+
+		bucketModel.Tokens = update(bucketModel.Tokens, bucketModel.UpdatedAt)
+		bucketModel.UpdatedAt = now
+		return transaction.Model(&ModelBucket{}).Where("bucket_key = ?", bucketModel.Key).
+			Updates(map[string]interface{}{"tokens": bucketModel.Tokens, "updated_at": bucketModel.UpdatedAt}).Error
+	})
+}
+
+// PurgeIdle is used to drop the buckets left untouched since before, they are full again by then.
+func (bucketModel *ModelBucket) PurgeIdle(before time.Time) (int64, error) {
+	result := connect(bucketModel.ctx).Where("updated_at <= ?", before).Delete(&ModelBucket{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,44 @@
+package tenant
+
+import (
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
+	"gorm.io/gorm"
+)
+
+// state is used to get the audited fields of the tenant, nil for a tenant which doesn't exist.
+func (tenantModel *ModelTenant) state() map[string]interface{} {
+	if tenantModel == nil {
+		return nil
+	}
+
+	var settings interface{}
+	if len(tenantModel.Settings) > 0 {
+		settings = map[string]interface{}(tenantModel.Settings)
+	}
+
+	return map[string]interface{}{
+		"name":         tenantModel.Name,
+		"slug":         tenantModel.Slug,
+		"status":       string(tenantModel.Status),
+		"contactEmail": tenantModel.ContactEmail,
+		"plan":         tenantModel.Plan,
+		"settings":     settings,
+		"version":      tenantModel.Version,
+	}
+}
+
+// record is used to append the change from before to after to the audit trail within transaction,
+// either being nil for a created or deleted tenant, and to queue the webhook event of the action.
+func record(transaction *gorm.DB, action string, before *ModelTenant, after *ModelTenant) error {
+	tenant := after
+	if tenant == nil {
+		tenant = before
+	}
+
+	err := audit.Record(transaction, action, tenant.UUID.String(), audit.Diff(before.state(), after.state()))
+	if err != nil {
+		return err
+	}
+
+	return notify(transaction, action, tenant)
+}
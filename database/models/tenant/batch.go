@@ -0,0 +1,154 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	libUuid "github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BatchAction is the change a batch operation makes to a tenant.
+type BatchAction string
+
+const (
+	// BatchCreate creates and activates the tenant.
+	BatchCreate BatchAction = "create"
+	// BatchUpdate replaces the editable fields of the tenant.
+	BatchUpdate BatchAction = "update"
+	// BatchDelete moves the tenant to the trash.
+	BatchDelete BatchAction = "delete"
+)
+
+// ErrBatchRolledBack is reported for the operations undone because another one of a transactional batch failed.
+var ErrBatchRolledBack = errors.New("batch rolled back")
+
+// BatchOperation is one change of a batch, the tenant Version is checked as on a single change.
+type BatchOperation struct {
+	Action BatchAction
+	Tenant ModelTenant
+}
+
+// BatchResult is the outcome of one batch operation, Tenant is nil when it failed.
+type BatchResult struct {
+	Action BatchAction
+	Tenant *ModelTenant
+	Err    error
+}
+
+// ApplyBatch is used to run the operations in order and report the outcome of each one.
+// When transactional is set every operation runs in one transaction, the first failure rolls back the whole batch.
+// Otherwise each operation runs in a transaction of its own and a failure doesn't stop the following ones.
+// The transactions are nested in the one ctx carries, if any, being committed along with it.
+// progress, if not nil, is called after each operation with the number of operations done.
+func ApplyBatch(ctx context.Context, operations []BatchOperation, transactional bool, progress func(done int)) []BatchResult {
+	results := make([]BatchResult, len(operations))
+	for i, operation := range operations {
+		results[i].Action = operation.Action
+	}
+
+	if !transactional {
+		for i := range operations {
+			results[i].Tenant, results[i].Err = applyInTransaction(ctx, operations[i])
+			if progress != nil {
+				progress(i + 1)
+			}
+		}
+
+		invalidateBatch(ctx, results)
+		return results
+	}
+
+	failed := -1
+	err := inTransaction(ctx, func(transaction *gorm.DB) error {
+		for i := range operations {
+			tenant, err := applyOperation(transaction, operations[i])
+			if err != nil {
+				failed = i
+				return err
+			}
+
+			results[i].Tenant = tenant
+			if progress != nil {
+				progress(i + 1)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		for i := range results {
+			results[i].Tenant = nil
+			results[i].Err = ErrBatchRolledBack
+		}
+
+		if failed >= 0 {
+			results[failed].Err = err
+		}
+	}
+
+	invalidateBatch(ctx, results)
+	return results
+}
+
+// invalidateBatch is used to drop the cached tenants changed by a batch.
+func invalidateBatch(ctx context.Context, results []BatchResult) {
+	var uuids []libUuid.UUID
+	for _, result := range results {
+		if result.Tenant != nil {
+			uuids = append(uuids, result.Tenant.UUID)
+		}
+	}
+
+	if len(uuids) > 0 {
+		invalidate(ctx, uuids...)
+	}
+}
+
+// applyInTransaction is used to run a single operation in its own transaction.
+func applyInTransaction(ctx context.Context, operation BatchOperation) (*ModelTenant, error) {
+	var tenant *ModelTenant
+	err := inTransaction(ctx, func(transaction *gorm.DB) (err error) {
+		tenant, err = applyOperation(transaction, operation)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tenant, nil
+}
+
+// applyOperation is used to run a single operation within the given transaction.
+func applyOperation(transaction *gorm.DB, operation BatchOperation) (*ModelTenant, error) {
+	tenant := operation.Tenant
+
+	switch operation.Action {
+	case BatchCreate:
+		err := tenant.create(transaction)
+		if err == nil {
+			err = tenant.transitionIn(transaction, StatusActive)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	case BatchUpdate:
+		if err := tenant.replace(transaction); err != nil {
+			return nil, err
+		}
+	case BatchDelete:
+		isDeleted, err := tenant.softDelete(transaction)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isDeleted {
+			return nil, ErrNotFound
+		}
+	default:
+		return nil, fmt.Errorf("unknown batch action: %s", operation.Action)
+	}
+
+	return &tenant, nil
+}
@@ -0,0 +1,85 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	libUuid "github.com/google/uuid"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/cache"
+	databaseManager "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+)
+
+// listCacheKey is the cache key of the tenants listed by GetAll.
+const listCacheKey = "tenants"
+
+// cacheKey is used to get the cache key of a tenant.
+func cacheKey(uuid libUuid.UUID) string {
+	return "tenant:" + uuid.String()
+}
+
+// readThrough is used to read the value of key from the cache carried by ctx into target,
+// or to load it and keep it. Cache failures are logged and the value is loaded instead.
+func readThrough[T any](ctx context.Context, key string, target *T, load func() (*T, error)) (*T, error) {
+	readCache := cache.FromContext(ctx)
+	if readCache == nil {
+		return load()
+	}
+
+	cached, found, err := readCache.Get(ctx, key)
+	if err == nil && found && json.Unmarshal(cached, target) == nil {
+		return target, nil
+	}
+	if err != nil {
+		logger := logging.Component("cache")
+		logger.Warn().Err(err).Str("key", key).Msg("Error reading the tenant cache")
+	}
+
+	loaded, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := json.Marshal(loaded)
+	if err == nil {
+		err = readCache.Set(ctx, key, value)
+	}
+	if err != nil {
+		logger := logging.Component("cache")
+		logger.Warn().Err(err).Str("key", key).Msg("Error writing the tenant cache")
+	}
+	return loaded, nil
+}
+
+// GetOneCached is used to retrieve element from the cache carried by the context, or from database.
+// The cached tenant is dropped when the tenant is changed, it is meant for reads which can be a TTL stale
+// if the change is made out of the app.
+func (tenantModel *ModelTenant) GetOneCached() (*ModelTenant, error) {
+	return readThrough(tenantModel.ctx, cacheKey(tenantModel.UUID), &ModelTenant{}, tenantModel.GetOne)
+}
+
+// GetAllCached is used to get all elements from the cache carried by the context, or from database.
+func (tenantModel *ModelTenant) GetAllCached() (*[]ModelTenant, error) {
+	return readThrough(tenantModel.ctx, listCacheKey, &[]ModelTenant{}, tenantModel.GetAll)
+}
+
+// invalidate is used to drop the cached tenants and list once they were changed, after the transaction ctx
+// carries is committed if there is one. Failures are logged, the cached values expiring anyway.
+func invalidate(ctx context.Context, uuids ...libUuid.UUID) {
+	readCache := cache.FromContext(ctx)
+	if readCache == nil {
+		return
+	}
+
+	keys := []string{listCacheKey}
+	for _, uuid := range uuids {
+		keys = append(keys, cacheKey(uuid))
+	}
+
+	databaseManager.AfterCommit(ctx, func() {
+		err := readCache.Delete(ctx, keys...)
+		if err != nil {
+			logger := logging.Component("cache")
+			logger.Warn().Err(err).Strs("keys", keys).Msg("Error invalidating the tenant cache")
+		}
+	})
+}
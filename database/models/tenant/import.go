@@ -0,0 +1,156 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	libUuid "github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ConflictStrategy is what an import does with a tenant whose UUID or name already exists.
+type ConflictStrategy string
+
+const (
+	// ConflictSkip leaves the existing tenant untouched.
+	ConflictSkip ConflictStrategy = "skip"
+	// ConflictOverwrite replaces the editable fields of the existing tenant.
+	ConflictOverwrite ConflictStrategy = "overwrite"
+	// ConflictFail stops the import and rolls it back.
+	ConflictFail ConflictStrategy = "fail"
+)
+
+// ImportOutcome is what happened to one imported tenant.
+type ImportOutcome string
+
+const (
+	// ImportCreated is a tenant which didn't exist yet.
+	ImportCreated ImportOutcome = "created"
+	// ImportUpdated is an existing tenant overwritten by the import.
+	ImportUpdated ImportOutcome = "updated"
+	// ImportSkipped is an existing tenant left untouched, or a tenant rolled back because the import failed.
+	ImportSkipped ImportOutcome = "skipped"
+	// ImportFailed is a tenant which couldn't be written.
+	ImportFailed ImportOutcome = "failed"
+)
+
+// ErrImportConflict is returned when an imported tenant already exists with the fail strategy.
+var ErrImportConflict = errors.New("tenant already exists")
+
+// errDryRun is used to roll back the import transaction once a dry run is done.
+var errDryRun = errors.New("dry run")
+
+// ImportResult is the outcome of one imported tenant.
+type ImportResult struct {
+	Outcome ImportOutcome
+	Tenant  *ModelTenant
+	Err     error
+}
+
+// Import is used to write the tenants, matching existing ones by UUID or name according to strategy.
+// The whole import runs in one transaction: a dry run rolls it back once every tenant has been tried,
+// and with ConflictFail the first conflict rolls it back and is returned.
+// progress, if not nil, is called after each tenant with the number of tenants done.
+func Import(ctx context.Context, tenants []ModelTenant, strategy ConflictStrategy, dryRun bool, progress func(done int)) ([]ImportResult, error) {
+	results := make([]ImportResult, len(tenants))
+	for i := range results {
+		results[i].Outcome = ImportSkipped
+	}
+
+	failed := -1
+	err := inTransaction(ctx, func(transaction *gorm.DB) error {
+		for i := range tenants {
+			results[i] = importOne(transaction, tenants[i], strategy)
+			if errors.Is(results[i].Err, ErrImportConflict) && strategy == ConflictFail {
+				failed = i
+				return fmt.Errorf("tenant %d: %w", i, results[i].Err)
+			}
+
+			if progress != nil {
+				progress(i + 1)
+			}
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+
+	if errors.Is(err, errDryRun) {
+		return results, nil
+	}
+
+	if err != nil {
+		for i := range results {
+			if i != failed {
+				results[i] = ImportResult{Outcome: ImportSkipped}
+			}
+		}
+		return results, err
+	}
+
+	var uuids []libUuid.UUID
+	for _, result := range results {
+		if result.Tenant != nil && (result.Outcome == ImportCreated || result.Outcome == ImportUpdated) {
+			uuids = append(uuids, result.Tenant.UUID)
+		}
+	}
+	if len(uuids) > 0 {
+		invalidate(ctx, uuids...)
+	}
+
+	return results, nil
+}
+
+// importOne is used to write one tenant, a failure only rolls back this tenant.
+func importOne(transaction *gorm.DB, tenant ModelTenant, strategy ConflictStrategy) ImportResult {
+	var existingTenant ModelTenant
+	err := transaction.Where("uuid = ? OR name = ?", tenant.UUID, tenant.Name).First(&existingTenant).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return ImportResult{Outcome: ImportFailed, Err: err}
+	}
+
+	exists := err == nil
+	if exists && strategy != ConflictOverwrite {
+		if strategy == ConflictFail {
+			return ImportResult{Outcome: ImportFailed, Err: ErrImportConflict}
+		}
+		return ImportResult{Outcome: ImportSkipped, Tenant: &existingTenant}
+	}
+
+	err = transaction.SavePoint("import_tenant").Error
+	if err != nil {
+		return ImportResult{Outcome: ImportFailed, Err: err}
+	}
+
+	outcome := ImportCreated
+	if exists {
+		outcome = ImportUpdated
+		tenant.UUID = existingTenant.UUID
+		tenant.Version = 0
+		err = tenant.replace(transaction)
+	} else {
+		// Tenants exported without a status are activated, as on creation through the API.
+		activate := tenant.Status == ""
+		err = tenant.create(transaction)
+		if err == nil && activate {
+			err = tenant.transitionIn(transaction, StatusActive)
+		}
+	}
+
+	if err != nil {
+		transaction.RollbackTo("import_tenant")
+		return ImportResult{Outcome: ImportFailed, Err: err}
+	}
+
+	return ImportResult{Outcome: outcome, Tenant: &tenant}
+}
+
+// EachInBatches is used to walk through all the tenants, loading only size of them at a time.
+func (tenantModel *ModelTenant) EachInBatches(size int, fn func(tenants []ModelTenant) error) error {
+	var tenants []ModelTenant
+	return connect(tenantModel.ctx).FindInBatches(&tenants, size, func(_ *gorm.DB, _ int) error {
+		return fn(tenants)
+	}).Error
+}
@@ -0,0 +1,18 @@
+package tenant
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	databaseManager "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"time"
+)
+
+// RunPurgeScheduler is used to periodically drop tenants kept in the trash longer than retention.
+// It blocks until the context is cancelled, and runs its queries on the database client the context carries.
+func RunPurgeScheduler(ctx context.Context, retention time.Duration, interval time.Duration) {
+	logger := logging.Component("tenant").With().Dur("retention", retention).Logger()
+	databaseManager.RunPurgeScheduler(ctx, interval, logger, zerolog.InfoLevel, "deleted tenants", func(ctx context.Context) (int64, error) {
+		return (&ModelTenant{}).WithContext(ctx).PurgeDeletedBefore(time.Now().Add(-retention))
+	})
+}
@@ -0,0 +1,104 @@
+package tenant
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"sort"
+)
+
+// Settings is a free-form JSON document attached to a tenant.
+type Settings map[string]interface{}
+
+// settingsSchema describes the allowed settings keys and their JSON types.
+var settingsSchema = map[string]string{
+	"timezone":      "string",
+	"locale":        "string",
+	"maxUsers":      "number",
+	"notifications": "boolean",
+	"features":      "array",
+	"branding":      "object",
+}
+
+// Validate is used to check the settings document against the settings schema.
+func (settings Settings) Validate() error {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		expectedType, ok := settingsSchema[key]
+		if !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+
+		if actualType := jsonType(settings[key]); actualType != expectedType {
+			return fmt.Errorf("setting %q must be of type %s, got %s", key, expectedType, actualType)
+		}
+	}
+	return nil
+}
+
+// jsonType is used to get the JSON type name of a decoded JSON value.
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, float32, int, int32, int64, json.Number:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// Value is used to store the settings as JSON.
+func (settings Settings) Value() (driver.Value, error) {
+	if settings == nil {
+		return "{}", nil
+	}
+
+	bytes, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan is used to read the settings from JSON.
+func (settings *Settings) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*settings = Settings{}
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("unsupported settings value type")
+	}
+
+	return json.Unmarshal(bytes, settings)
+}
+
+// GormDBDataType is used to store the settings as jsonb on Postgres.
+func (Settings) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "jsonb"
+	}
+	return "text"
+}
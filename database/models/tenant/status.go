@@ -0,0 +1,50 @@
+package tenant
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Status is the lifecycle state of a tenant.
+type Status string
+
+const (
+	// StatusProvisioning is the state of a tenant being created.
+	StatusProvisioning Status = "provisioning"
+	// StatusActive is the state of a tenant allowed to use the API.
+	StatusActive Status = "active"
+	// StatusSuspended is the state of a tenant temporarily blocked from the API.
+	StatusSuspended Status = "suspended"
+	// StatusArchived is the final state of a tenant no longer in use.
+	StatusArchived Status = "archived"
+)
+
+// ErrInvalidTransition is returned when a tenant can't move to the requested status.
+var ErrInvalidTransition = errors.New("invalid tenant status transition")
+
+// transitions lists the statuses reachable from each status.
+var transitions = map[Status][]Status{
+	StatusProvisioning: {StatusActive, StatusArchived},
+	StatusActive:       {StatusSuspended, StatusArchived},
+	StatusSuspended:    {StatusActive, StatusArchived},
+	StatusArchived:     {},
+}
+
+// CanTransitionTo is used to check if the status can move to the given one.
+func (status Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[status] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBlocked is used to check if a tenant in this status must be denied API access.
+func (status Status) IsBlocked() bool {
+	return status == StatusSuspended || status == StatusArchived
+}
+
+func transitionError(from Status, to Status) error {
+	return fmt.Errorf("%w: from %s to %s", ErrInvalidTransition, from, to)
+}
@@ -1,17 +1,47 @@
 package tenant
 
 import (
+	"context"
 	"errors"
 	libUuid "github.com/google/uuid"
 	databaseManager "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
 	"gorm.io/gorm"
+	"html"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the tenant doesn't exist in database.
+	ErrNotFound = errors.New("tenant not found in database")
+	// ErrVersionConflict is returned when the tenant changed since the expected version was read.
+	ErrVersionConflict = errors.New("tenant version mismatch")
+	// ErrNotInTrash is returned when restoring a tenant which isn't soft deleted.
+	ErrNotInTrash = errors.New("tenant not found in trash")
 )
 
 // ModelTenant is a tenant model description.
 type ModelTenant struct {
 	gorm.Model
-	UUID libUuid.UUID `gorm:"unique_index;not null"`
-	Name string       `gorm:"unique;not null;type:varchar(100);default:null"`
+	UUID         libUuid.UUID `gorm:"unique_index;not null"`
+	Name         string       `gorm:"unique;not null;type:varchar(100);default:null"`
+	Slug         string       `gorm:"unique;type:varchar(100);default:null"`
+	Status       Status       `gorm:"not null;type:varchar(20);default:'provisioning'"`
+	ContactEmail string       `gorm:"type:varchar(255)"`
+	Plan         string       `gorm:"not null;type:varchar(50);default:'free'"`
+	Settings     Settings
+	Version      uint `gorm:"not null;default:1"`
+
+	// ctx is the context the queries of the tenant run within, set by WithContext.
+	ctx context.Context
+}
+
+// SearchResult is a tenant matching a search query, with its rank and highlighted name.
+type SearchResult struct {
+	ModelTenant
+	Rank      float64
+	Highlight string `gorm:"-"`
 }
 
 // TableName used to set the table name.
@@ -22,19 +52,56 @@ func (ModelTenant) TableName() string {
 // BeforeCreate used to transform some params before saving to database.
 func (tenantModel *ModelTenant) BeforeCreate(ctx *gorm.DB) (err error) {
 	if tenantModel.UUID.String() == "00000000-0000-0000-0000-000000000000" {
-		err = ctx.Statement.Set("UUID", libUuid.New()).Error
-		if err != nil {
-			return err
-		}
-		return
+		tenantModel.UUID = libUuid.New()
+	}
+
+	if tenantModel.Slug == "" {
+		tenantModel.Slug = Slugify(tenantModel.Name)
 	}
 	return
 }
 
+// BeforeSave used to validate the settings document before writing it.
+func (tenantModel *ModelTenant) BeforeSave(ctx *gorm.DB) (err error) {
+	return tenantModel.Settings.Validate()
+}
+
+// Slugify is used to build a URL friendly identifier from a tenant name.
+func Slugify(name string) string {
+	var builder strings.Builder
+	previousDash := true
+	for _, character := range strings.ToLower(name) {
+		if (character >= 'a' && character <= 'z') || (character >= '0' && character <= '9') {
+			builder.WriteRune(character)
+			previousDash = false
+		} else if !previousDash {
+			builder.WriteRune('-')
+			previousDash = true
+		}
+	}
+
+	return strings.TrimSuffix(builder.String(), "-")
+}
+
+// WithContext is used to run the next queries of the tenant within ctx, so they are traced and cancelled with it.
+// They run on the database client carried by ctx, if any.
+func (tenantModel *ModelTenant) WithContext(ctx context.Context) *ModelTenant {
+	tenantModel.ctx = ctx
+	return tenantModel
+}
+
+// connect is used to get the database client, running its queries within ctx when there is one.
+func connect(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		return databaseManager.Connect()
+	}
+	return databaseManager.FromContext(ctx)
+}
+
 // GetAll is used to get all elements for database.
 func (tenantModel *ModelTenant) GetAll() (*[]ModelTenant, error) {
 	var tenants []ModelTenant
-	err := databaseManager.Connect().Find(&tenants).Error
+	err := connect(tenantModel.ctx).Find(&tenants).Error
 	if err != nil {
 		return nil, err
 	}
@@ -43,78 +110,485 @@ func (tenantModel *ModelTenant) GetAll() (*[]ModelTenant, error) {
 
 // Save is used to write data into database.
 func (tenantModel *ModelTenant) Save() (*ModelTenant, error) {
-	transaction := databaseManager.Connect().Begin()
+	err := inTransaction(tenantModel.ctx, tenantModel.create)
+	if err != nil {
+		return nil, err
+	}
 
-	if transaction.Error != nil {
-		return nil, transaction.Error
+	invalidate(tenantModel.ctx, tenantModel.UUID)
+	return tenantModel, nil
+}
+
+// create is used to insert the tenant within the given transaction.
+func (tenantModel *ModelTenant) create(transaction *gorm.DB) error {
+	err := transaction.Create(tenantModel).Error
+	if err != nil {
+		return err
 	}
 
-	err := transaction.Create(&tenantModel).Error
+	return record(transaction, audit.ActionTenantCreate, nil, tenantModel)
+}
+
+// Update is used to write data into database.
+// A non zero Version is the version the caller expects to be stored, ErrVersionConflict is returned otherwise.
+func (tenantModel *ModelTenant) Update() (*ModelTenant, error) {
+	err := inTransaction(tenantModel.ctx, tenantModel.update)
 	if err != nil {
-		transaction.Rollback()
 		return nil, err
 	}
 
-	transaction.Commit()
+	invalidate(tenantModel.ctx, tenantModel.UUID)
 	return tenantModel, nil
 }
 
-// Update is used to write data into database.
-func (tenantModel *ModelTenant) Update() (*ModelTenant, error) {
-	transaction := databaseManager.Connect().Begin()
+// update is used to write the non zero fields within the given transaction.
+func (tenantModel *ModelTenant) update(transaction *gorm.DB) error {
+	existingTenant, err := tenantModel.checkVersion(transaction)
+	if err != nil {
+		return err
+	}
+
+	tenantModel.Version = existingTenant.Version + 1
+
+	result := transaction.Model(&tenantModel).
+		Where(ModelTenant{UUID: tenantModel.UUID}).
+		Where("version = ?", existingTenant.Version).
+		Updates(&tenantModel)
+	if result.Error != nil {
+		return result.Error
+	}
 
-	if transaction.Error != nil {
-		return nil, transaction.Error
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
 	}
 
-	err := transaction.Model(&tenantModel).Where(ModelTenant{UUID: tenantModel.UUID}).Updates(&tenantModel).Error
+	// Reload to return the fields which weren't part of the update.
+	err = transaction.Where(ModelTenant{UUID: tenantModel.UUID}).First(&tenantModel).Error
+	if err != nil {
+		return err
+	}
+
+	return record(transaction, audit.ActionTenantUpdate, existingTenant, tenantModel)
+}
+
+// replaceableFields are the columns overwritten by a full replacement.
+var replaceableFields = []string{"name", "slug", "contact_email", "plan", "settings", "version"}
+
+// Replace is used to overwrite all the editable fields, including zero values.
+// Omitted slug and plan fall back to their defaults, as on creation.
+// A non zero Version is the version the caller expects to be stored, ErrVersionConflict is returned otherwise.
+func (tenantModel *ModelTenant) Replace() (*ModelTenant, error) {
+	err := inTransaction(tenantModel.ctx, tenantModel.replace)
 	if err != nil {
-		transaction.Rollback()
 		return nil, err
 	}
 
-	transaction.Commit()
+	invalidate(tenantModel.ctx, tenantModel.UUID)
 	return tenantModel, nil
 }
 
+// replace is used to overwrite the editable fields within the given transaction.
+func (tenantModel *ModelTenant) replace(transaction *gorm.DB) error {
+	if tenantModel.Slug == "" {
+		tenantModel.Slug = Slugify(tenantModel.Name)
+	}
+
+	if tenantModel.Plan == "" {
+		tenantModel.Plan = "free"
+	}
+
+	existingTenant, err := tenantModel.checkVersion(transaction)
+	if err != nil {
+		return err
+	}
+
+	tenantModel.Model = existingTenant.Model
+	tenantModel.Status = existingTenant.Status
+	tenantModel.Version = existingTenant.Version + 1
+
+	result := transaction.Model(tenantModel).
+		Where("version = ?", existingTenant.Version).
+		Select(replaceableFields).
+		Updates(tenantModel)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	err = transaction.Where(ModelTenant{UUID: tenantModel.UUID}).First(tenantModel).Error
+	if err != nil {
+		return err
+	}
+
+	return record(transaction, audit.ActionTenantUpdate, existingTenant, tenantModel)
+}
+
+// checkVersion is used to load the stored tenant and compare its version to the expected one, if any.
+func (tenantModel *ModelTenant) checkVersion(transaction *gorm.DB) (*ModelTenant, error) {
+	var existingTenant ModelTenant
+	err := transaction.Where(ModelTenant{UUID: tenantModel.UUID}).First(&existingTenant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if tenantModel.Version != 0 && tenantModel.Version != existingTenant.Version {
+		return nil, ErrVersionConflict
+	}
+
+	return &existingTenant, nil
+}
+
 // GetOne is used to retrieve element from database.
 func (tenantModel *ModelTenant) GetOne() (*ModelTenant, error) {
-	err := databaseManager.Connect().Where(&ModelTenant{UUID: tenantModel.UUID}).First(&tenantModel).Error
+	err := connect(tenantModel.ctx).Where(&ModelTenant{UUID: tenantModel.UUID}).First(&tenantModel).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, errors.New("tenant not found in database")
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return tenantModel, nil
+}
+
+// Activate is used to move a tenant to the active status.
+func (tenantModel *ModelTenant) Activate() (*ModelTenant, error) {
+	return tenantModel.transition(StatusActive)
+}
+
+// Suspend is used to move a tenant to the suspended status, blocking its API access.
+func (tenantModel *ModelTenant) Suspend() (*ModelTenant, error) {
+	return tenantModel.transition(StatusSuspended)
+}
+
+// Archive is used to move a tenant to the archived status, it can't be reactivated afterwards.
+func (tenantModel *ModelTenant) Archive() (*ModelTenant, error) {
+	return tenantModel.transition(StatusArchived)
+}
+
+// transition is used to move a tenant to a new status if the lifecycle allows it.
+func (tenantModel *ModelTenant) transition(status Status) (*ModelTenant, error) {
+	err := inTransaction(tenantModel.ctx, func(transaction *gorm.DB) error {
+		return tenantModel.transitionIn(transaction, status)
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	invalidate(tenantModel.ctx, tenantModel.UUID)
 	return tenantModel, nil
 }
 
-// Delete is used to drop data from database.
+// transitionIn is used to change the tenant status within the given transaction.
+func (tenantModel *ModelTenant) transitionIn(transaction *gorm.DB, status Status) error {
+	err := transaction.Where(&ModelTenant{UUID: tenantModel.UUID}).First(tenantModel).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !tenantModel.Status.CanTransitionTo(status) {
+		return transitionError(tenantModel.Status, status)
+	}
+
+	existingTenant := *tenantModel
+
+	version := tenantModel.Version + 1
+	result := transaction.Model(tenantModel).
+		Where("version = ?", tenantModel.Version).
+		Updates(map[string]interface{}{"status": status, "version": version})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	tenantModel.Status = status
+	tenantModel.Version = version
+	return record(transaction, audit.ActionTenantUpdate, &existingTenant, tenantModel)
+}
+
+// Delete is used to soft delete data, the row is kept in the trash until restored or purged.
+// A non zero Version is the version the caller expects to be stored, ErrVersionConflict is returned otherwise.
 func (tenantModel *ModelTenant) Delete() (bool, error) {
-	libUuid.MustParse(tenantModel.UUID.String())
+	var isDeleted bool
+	err := inTransaction(tenantModel.ctx, func(transaction *gorm.DB) (err error) {
+		isDeleted, err = tenantModel.softDelete(transaction)
+		return err
+	})
+
+	if isDeleted && err == nil {
+		invalidate(tenantModel.ctx, tenantModel.UUID)
+	}
+	return isDeleted, err
+}
 
+// softDelete is used to move the tenant to the trash within the given transaction.
+func (tenantModel *ModelTenant) softDelete(transaction *gorm.DB) (bool, error) {
 	if tenantModel.UUID.String() == "00000000-0000-0000-0000-000000000000" {
 		return false, errors.New("no uuid specified")
 	}
 
-	err := databaseManager.Connect().First(&tenantModel).Where(&ModelTenant{UUID: tenantModel.UUID}).Error
+	expectedVersion := tenantModel.Version
+	err := transaction.Where(&ModelTenant{UUID: tenantModel.UUID}).First(tenantModel).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return false, nil
 	}
 
-	transaction := databaseManager.Connect().Begin()
+	if err != nil {
+		return false, err
+	}
+
+	if expectedVersion != 0 && expectedVersion != tenantModel.Version {
+		return false, ErrVersionConflict
+	}
+
+	result := transaction.Model(tenantModel).Where("version = ?", tenantModel.Version).Delete(tenantModel)
+	if result.Error != nil {
+		return false, result.Error
+	}
 
-	if transaction.Error != nil {
-		return false, transaction.Error
+	if result.RowsAffected == 0 {
+		return false, ErrVersionConflict
 	}
 
-	err = transaction.Unscoped().Model(&tenantModel).Delete(&tenantModel).Error
+	err = record(transaction, audit.ActionTenantDelete, tenantModel, nil)
 	if err != nil {
-		transaction.Rollback()
 		return false, err
 	}
 
-	transaction.Commit()
+	return true, nil
+}
+
+// HardDelete is used to drop data from database, including rows already in the trash.
+// A non zero Version is the version the caller expects to be stored, ErrVersionConflict is returned otherwise.
+func (tenantModel *ModelTenant) HardDelete() (bool, error) {
+	if tenantModel.UUID.String() == "00000000-0000-0000-0000-000000000000" {
+		return false, errors.New("no uuid specified")
+	}
+
+	expectedVersion := tenantModel.Version
+	err := connect(tenantModel.ctx).Unscoped().Where(&ModelTenant{UUID: tenantModel.UUID}).First(&tenantModel).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if expectedVersion != 0 && expectedVersion != tenantModel.Version {
+		return false, ErrVersionConflict
+	}
+
+	err = inTransaction(tenantModel.ctx, func(transaction *gorm.DB) error {
+		result := transaction.Unscoped().Model(&tenantModel).Where("version = ?", tenantModel.Version).Delete(&tenantModel)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		return record(transaction, audit.ActionTenantPurge, tenantModel, nil)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	invalidate(tenantModel.ctx, tenantModel.UUID)
 
 	return true, nil
 }
+
+// inTransaction is used to run fn in a new transaction within ctx, committed only when fn succeeds.
+// It is nested in the transaction ctx carries, if any.
+func inTransaction(ctx context.Context, fn func(transaction *gorm.DB) error) error {
+	if ctx == nil {
+		ctx = databaseManager.NewContext(context.Background(), databaseManager.Connect())
+	}
+
+	return databaseManager.Transaction(ctx, func(ctx context.Context) error {
+		return fn(databaseManager.FromContext(ctx))
+	})
+}
+
+// GetTrash is used to get all soft deleted elements from database.
+func (tenantModel *ModelTenant) GetTrash() (*[]ModelTenant, error) {
+	var tenants []ModelTenant
+	err := connect(tenantModel.ctx).Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&tenants).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tenants, nil
+}
+
+// Restore is used to bring back a soft deleted element.
+// A non zero Version is the version the caller expects to be stored, ErrVersionConflict is returned otherwise.
+func (tenantModel *ModelTenant) Restore() (*ModelTenant, error) {
+	expectedVersion := tenantModel.Version
+	err := connect(tenantModel.ctx).Unscoped().
+		Where(&ModelTenant{UUID: tenantModel.UUID}).
+		Where("deleted_at IS NOT NULL").
+		First(&tenantModel).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotInTrash
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedVersion != 0 && expectedVersion != tenantModel.Version {
+		return nil, ErrVersionConflict
+	}
+
+	version := tenantModel.Version + 1
+	err = inTransaction(tenantModel.ctx, func(transaction *gorm.DB) error {
+		result := transaction.Unscoped().Model(&tenantModel).
+			Where("version = ?", tenantModel.Version).
+			Updates(map[string]interface{}{"deleted_at": nil, "version": version})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		err := audit.Record(transaction, audit.ActionTenantRestore, tenantModel.UUID.String(), audit.Changes{
+			"deletedAt": audit.Change{Before: tenantModel.DeletedAt.Time},
+		})
+		if err != nil {
+			return err
+		}
+
+		return notify(transaction, audit.ActionTenantRestore, tenantModel)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invalidate(tenantModel.ctx, tenantModel.UUID)
+	tenantModel.DeletedAt = gorm.DeletedAt{}
+	tenantModel.Version = version
+	return tenantModel, nil
+}
+
+// PurgeDeletedBefore is used to permanently drop elements soft deleted before the given time.
+func (tenantModel *ModelTenant) PurgeDeletedBefore(before time.Time) (int64, error) {
+	var purged int64
+	err := inTransaction(tenantModel.ctx, func(transaction *gorm.DB) error {
+		var tenants []ModelTenant
+		err := transaction.Unscoped().
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+			Find(&tenants).Error
+		if err != nil || len(tenants) == 0 {
+			return err
+		}
+
+		result := transaction.Unscoped().Delete(&tenants)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		for i := range tenants {
+			err = record(transaction, audit.ActionTenantPurge, &tenants[i], nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		purged = result.RowsAffected
+		return nil
+	})
+
+	return purged, err
+}
+
+// Search is used to find tenants by partial name, best matches first.
+// On Postgres the ranking uses pg_trgm similarity, elsewhere a LIKE based fallback.
+func (tenantModel *ModelTenant) Search(query string, limit int) (*[]SearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.New("empty search query")
+	}
+
+	client := connect(tenantModel.ctx)
+	contains := "%" + escapeLike(query) + "%"
+	prefix := escapeLike(query) + "%"
+
+	var statement *gorm.DB
+	if client.Dialector.Name() == "postgres" {
+		statement = client.Model(&ModelTenant{}).
+			Select("*, similarity(name, ?) AS rank", query).
+			Where("name % ? OR name ILIKE ? ESCAPE '\\'", query, contains)
+	} else {
+		statement = client.Model(&ModelTenant{}).
+			Select(
+				"*, CASE WHEN lower(name) = lower(?) THEN 1.0 WHEN lower(name) LIKE lower(?) ESCAPE '\\' THEN 0.75 ELSE 0.5 END AS rank",
+				query, prefix,
+			).
+			Where("lower(name) LIKE lower(?) ESCAPE '\\'", contains)
+	}
+
+	var results []SearchResult
+	err := statement.Order("rank DESC").Order("name ASC").Limit(limit).Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].Highlight = highlight(results[i].Name, query)
+	}
+
+	return &results, nil
+}
+
+// escapeLike is used to make the LIKE wildcards of user input match literally.
+func escapeLike(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
+}
+
+// highlight is used to wrap every case-insensitive occurrence of query into <b> tags.
+// The name is HTML escaped, so the highlight can be rendered as is.
+func highlight(name string, query string) string {
+	lowerName := strings.ToLower(name)
+	lowerQuery := strings.ToLower(query)
+	if len(lowerName) != len(name) || len(lowerQuery) != len(query) {
+		// Lowercasing changed byte offsets, offsets can't be mapped back safely.
+		return html.EscapeString(name)
+	}
+
+	var builder strings.Builder
+	for {
+		index := strings.Index(lowerName, lowerQuery)
+		if index < 0 {
+			builder.WriteString(html.EscapeString(name))
+			return builder.String()
+		}
+
+		builder.WriteString(html.EscapeString(name[:index]))
+		builder.WriteString("<b>" + html.EscapeString(name[index:index+len(query)]) + "</b>")
+		name = name[index+len(query):]
+		lowerName = lowerName[index+len(query):]
+	}
+}
@@ -1,13 +1,20 @@
 package tenant
 
 import (
+	"context"
+	"errors"
 	libUuid "github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/cache"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/config"
 	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/webhook"
 	"gorm.io/gorm"
 	"log"
 	"os"
 	"testing"
+	"time"
 )
 
 var DbClient *gorm.DB
@@ -26,12 +33,16 @@ func TestMain(m *testing.M) {
 
 func refreshTenantTable() (err error) {
 	err = DbClient.Exec("DROP TABLE IF EXISTS tenant").Error
+	if err == nil {
+		err = DbClient.Exec("DROP TABLE IF EXISTS audit_entry").Error
+	}
+
 	if err != nil {
 		log.Fatalf("Cannot refresh tenant table: %v", err)
 		return err
 	}
 
-	err = DbClient.AutoMigrate(&ModelTenant{})
+	err = DbClient.AutoMigrate(&ModelTenant{}, &audit.ModelAuditEntry{}, &webhook.ModelSubscription{}, &webhook.ModelDelivery{})
 	if err != nil {
 		return err
 	}
@@ -176,8 +187,26 @@ func TestGetWrongTenantByID(t *testing.T) {
 
 	if assert.Nil(t, foundTenant) {
 		assert.Equal(t, "tenant not found in database", err.Error())
-		t.Log("End TestTenantGetById")
 	}
+
+	// Other lookup errors are returned as is.
+	failingClient, err := database.Open(config.Database{Driver: config.DriverSQLite, Name: "tenant-failing", DSN: t.TempDir() + "/tenant.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookupErr := errors.New("database is down")
+	err = failingClient.Callback().Query().Before("gorm:query").Register("fail", func(tx *gorm.DB) {
+		_ = tx.AddError(lookupErr)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := database.NewContext(context.Background(), failingClient)
+	foundTenant, err = (&ModelTenant{UUID: libUuid.MustParse(validTenantID)}).WithContext(ctx).GetOne()
+	assert.ErrorIs(t, err, lookupErr)
+	assert.Nil(t, foundTenant)
+	t.Log("End TestTenantGetById")
 }
 
 func TestUpdateTenant(t *testing.T) {
@@ -249,3 +278,593 @@ func TestDeleteTenant(t *testing.T) {
 	//	t.Log("End TestDeleteTenant")
 	//}
 }
+
+func TestSearchTenants(t *testing.T) {
+	err := refreshTenantTable()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	tenants := []ModelTenant{{Name: "Acme"}, {Name: "Acme Corp"}, {Name: "Big Acme"}, {Name: "Globex"}, {Name: "100%_off"}}
+	for i := range tenants {
+		_, err = tenants[i].Save()
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+	}
+
+	tenantInstance := ModelTenant{}
+
+	results, err := tenantInstance.Search("acme", 10)
+	if assert.NoError(t, err) && assert.Len(t, *results, 3) {
+		assert.Equal(t, "Acme", (*results)[0].Name)
+		assert.Equal(t, "<b>Acme</b>", (*results)[0].Highlight)
+		assert.Equal(t, "Acme Corp", (*results)[1].Name)
+		assert.Equal(t, "Big <b>Acme</b>", (*results)[2].Highlight)
+		assert.Greater(t, (*results)[0].Rank, (*results)[1].Rank)
+		assert.Greater(t, (*results)[1].Rank, (*results)[2].Rank)
+	}
+
+	results, err = tenantInstance.Search("acme", 1)
+	if assert.NoError(t, err) {
+		assert.Len(t, *results, 1)
+	}
+
+	results, err = tenantInstance.Search("%_", 10)
+	if assert.NoError(t, err) && assert.Len(t, *results, 1) {
+		assert.Equal(t, "100<b>%_</b>off", (*results)[0].Highlight)
+	}
+
+	assert.Equal(t, "&lt;script&gt;<b>Acme</b>&lt;/script&gt;", highlight("<script>Acme</script>", "acme"))
+	assert.Equal(t, "Ben &amp; <b>Jerry&#39;s</b>", highlight("Ben & Jerry's", "jerry's"))
+
+	results, err = tenantInstance.Search(" ", 10)
+	if assert.Error(t, err) {
+		assert.Nil(t, results)
+	}
+	t.Log("End TestSearchTenants")
+}
+
+func TestSoftDeleteAndRestoreTenant(t *testing.T) {
+	err := refreshTenantTable()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	seedOneTenant()
+	tenantInstance := ModelTenant{UUID: libUuid.MustParse(validTenantID)}
+
+	isDeleted, err := tenantInstance.Delete()
+	if assert.NoError(t, err) {
+		assert.True(t, isDeleted)
+	}
+
+	_, err = (&ModelTenant{UUID: libUuid.MustParse(validTenantID)}).GetOne()
+	assert.Error(t, err)
+
+	trash, err := tenantInstance.GetTrash()
+	if assert.NoError(t, err) && assert.Len(t, *trash, 1) {
+		assert.Equal(t, validTenantID, (*trash)[0].UUID.String())
+		assert.True(t, (*trash)[0].DeletedAt.Valid)
+	}
+
+	restoredTenant, err := (&ModelTenant{UUID: libUuid.MustParse(validTenantID), Version: 2}).Restore()
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.Nil(t, restoredTenant)
+
+	restoredTenant, err = (&ModelTenant{UUID: libUuid.MustParse(validTenantID), Version: 1}).Restore()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Greg", restoredTenant.Name)
+		assert.False(t, restoredTenant.DeletedAt.Valid)
+		assert.Equal(t, uint(2), restoredTenant.Version)
+	}
+
+	foundTenant, err := (&ModelTenant{UUID: libUuid.MustParse(validTenantID)}).GetOne()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Greg", foundTenant.Name)
+	}
+
+	restoredTenant, err = (&ModelTenant{UUID: libUuid.MustParse(validTenantID)}).Restore()
+	if assert.Error(t, err) {
+		assert.Nil(t, restoredTenant)
+		assert.Equal(t, "tenant not found in trash", err.Error())
+	}
+	t.Log("End TestSoftDeleteAndRestoreTenant")
+}
+
+func TestHardDeleteTenant(t *testing.T) {
+	err := refreshTenantTable()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	seedOneTenant()
+
+	isDeleted, err := (&ModelTenant{UUID: libUuid.MustParse(validTenantID)}).Delete()
+	if assert.NoError(t, err) {
+		assert.True(t, isDeleted)
+	}
+
+	// Hard deletes also reach tenants already in the trash.
+	isDeleted, err = (&ModelTenant{UUID: libUuid.MustParse(validTenantID)}).HardDelete()
+	if assert.NoError(t, err) {
+		assert.True(t, isDeleted)
+	}
+
+	trash, err := (&ModelTenant{}).GetTrash()
+	if assert.NoError(t, err) {
+		assert.Len(t, *trash, 0)
+	}
+
+	isDeleted, err = (&ModelTenant{UUID: libUuid.MustParse(validTenantID)}).HardDelete()
+	if assert.NoError(t, err) {
+		assert.False(t, isDeleted)
+	}
+
+	// A failed lookup is returned, nothing being deleted.
+	failingClient, err := database.Open(config.Database{Driver: config.DriverSQLite, Name: "tenant-failing", DSN: t.TempDir() + "/tenant.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookupErr := errors.New("database is down")
+	err = failingClient.Callback().Query().Before("gorm:query").Register("fail", func(tx *gorm.DB) {
+		_ = tx.AddError(lookupErr)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := database.NewContext(context.Background(), failingClient)
+	isDeleted, err = (&ModelTenant{UUID: libUuid.MustParse(validTenantID)}).WithContext(ctx).HardDelete()
+	assert.ErrorIs(t, err, lookupErr)
+	assert.False(t, isDeleted)
+	t.Log("End TestHardDeleteTenant")
+}
+
+func TestPurgeDeletedTenants(t *testing.T) {
+	err := refreshTenantTable()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	err = seedTenants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tenantInstance := ModelTenant{}
+	tenants, err := tenantInstance.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range *tenants {
+		_, err = (&ModelTenant{UUID: (*tenants)[i].UUID}).Delete()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Age one of the deleted tenants past the retention window.
+	err = DbClient.Unscoped().Model(&ModelTenant{}).Where("name = ?", "Bob").
+		Update("deleted_at", time.Now().Add(-48*time.Hour)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := tenantInstance.PurgeDeletedBefore(time.Now().Add(-24 * time.Hour))
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), purged)
+	}
+
+	trash, err := tenantInstance.GetTrash()
+	if assert.NoError(t, err) && assert.Len(t, *trash, 1) {
+		assert.Equal(t, "Alice", (*trash)[0].Name)
+	}
+	t.Log("End TestPurgeDeletedTenants")
+}
+
+func TestTenantStatusTransitions(t *testing.T) {
+	err := refreshTenantTable()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	seedOneTenant()
+	tenantInstance := ModelTenant{UUID: libUuid.MustParse(validTenantID)}
+
+	foundTenant, err := tenantInstance.GetOne()
+	if assert.NoError(t, err) {
+		assert.Equal(t, StatusProvisioning, foundTenant.Status)
+	}
+
+	for _, move := range []func(*ModelTenant) (*ModelTenant, error){
+		(*ModelTenant).Activate,
+		(*ModelTenant).Suspend,
+		(*ModelTenant).Activate,
+		(*ModelTenant).Archive,
+	} {
+		_, err = move(&ModelTenant{UUID: libUuid.MustParse(validTenantID)})
+		assert.NoError(t, err)
+	}
+
+	archivedTenant, err := (&ModelTenant{UUID: libUuid.MustParse(validTenantID)}).Activate()
+	if assert.ErrorIs(t, err, ErrInvalidTransition) {
+		assert.Nil(t, archivedTenant)
+		assert.Equal(t, "invalid tenant status transition: from archived to active", err.Error())
+	}
+
+	_, err = (&ModelTenant{UUID: libUuid.New()}).Suspend()
+	if assert.Error(t, err) {
+		assert.Equal(t, "tenant not found in database", err.Error())
+	}
+	t.Log("End TestTenantStatusTransitions")
+}
+
+func TestSaveTenantMetadata(t *testing.T) {
+	err := refreshTenantTable()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	newTenant := ModelTenant{
+		Name:         "Acme Corp. (EU)",
+		ContactEmail: "admin@acme.test",
+		Plan:         "pro",
+		Settings:     Settings{"timezone": "Europe/Paris", "maxUsers": 10, "features": []interface{}{"sso"}},
+	}
+
+	_, err = newTenant.Save()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	foundTenant, err := (&ModelTenant{UUID: newTenant.UUID}).GetOne()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "acme-corp-eu", foundTenant.Slug)
+		assert.Equal(t, "admin@acme.test", foundTenant.ContactEmail)
+		assert.Equal(t, "pro", foundTenant.Plan)
+		assert.Equal(t, "Europe/Paris", foundTenant.Settings["timezone"])
+		assert.Equal(t, float64(10), foundTenant.Settings["maxUsers"])
+	}
+
+	wrongTenant := ModelTenant{Name: "Wrong", Settings: Settings{"maxUsers": "ten"}}
+	_, err = wrongTenant.Save()
+	if assert.Error(t, err) {
+		assert.Equal(t, `setting "maxUsers" must be of type number, got string`, err.Error())
+	}
+
+	wrongTenant = ModelTenant{Name: "Wrong", Settings: Settings{"color": "red"}}
+	_, err = wrongTenant.Save()
+	if assert.Error(t, err) {
+		assert.Equal(t, `unknown setting "color"`, err.Error())
+	}
+	t.Log("End TestSaveTenantMetadata")
+}
+
+func TestReplaceTenant(t *testing.T) {
+	err := refreshTenantTable()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	seedOneTenant()
+
+	existingTenant := ModelTenant{UUID: libUuid.MustParse(validTenantID), ContactEmail: "greg@test.test", Plan: "pro"}
+	_, err = existingTenant.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Zero values are written, unlike with Update.
+	replacement := ModelTenant{UUID: libUuid.MustParse(validTenantID), Name: "Gregory"}
+	replacedTenant, err := replacement.Replace()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Gregory", replacedTenant.Name)
+		assert.Equal(t, "gregory", replacedTenant.Slug)
+		assert.Equal(t, "", replacedTenant.ContactEmail)
+		assert.Equal(t, "free", replacedTenant.Plan)
+		assert.Equal(t, StatusProvisioning, replacedTenant.Status)
+		assert.NotZero(t, replacedTenant.ID)
+	}
+
+	replacement = ModelTenant{UUID: libUuid.New(), Name: "Nobody"}
+	replacedTenant, err = replacement.Replace()
+	if assert.ErrorIs(t, err, ErrNotFound) {
+		assert.Nil(t, replacedTenant)
+	}
+	t.Log("End TestReplaceTenant")
+}
+
+func TestTenantVersionConflict(t *testing.T) {
+	err := refreshTenantTable()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	seedOneTenant()
+
+	foundTenant, err := (&ModelTenant{UUID: libUuid.MustParse(validTenantID)}).GetOne()
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint(1), foundTenant.Version)
+	}
+
+	updatedTenant, err := (&ModelTenant{UUID: libUuid.MustParse(validTenantID), Name: "Gregory", Version: 1}).Update()
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint(2), updatedTenant.Version)
+	}
+
+	// A second writer still holding version 1 must not overwrite the first one.
+	staleTenant, err := (&ModelTenant{UUID: libUuid.MustParse(validTenantID), Name: "Greg", Version: 1}).Replace()
+	if assert.ErrorIs(t, err, ErrVersionConflict) {
+		assert.Nil(t, staleTenant)
+	}
+
+	isDeleted, err := (&ModelTenant{UUID: libUuid.MustParse(validTenantID), Version: 1}).Delete()
+	if assert.ErrorIs(t, err, ErrVersionConflict) {
+		assert.False(t, isDeleted)
+	}
+
+	activatedTenant, err := (&ModelTenant{UUID: libUuid.MustParse(validTenantID)}).Activate()
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint(3), activatedTenant.Version)
+	}
+
+	isDeleted, err = (&ModelTenant{UUID: libUuid.MustParse(validTenantID), Version: 3}).Delete()
+	if assert.NoError(t, err) {
+		assert.True(t, isDeleted)
+	}
+	t.Log("End TestTenantVersionConflict")
+}
+
+func TestApplyBatch(t *testing.T) {
+	seedOneTenant()
+
+	operations := []BatchOperation{
+		{Action: BatchCreate, Tenant: ModelTenant{Name: "Alice"}},
+		{Action: BatchUpdate, Tenant: ModelTenant{UUID: libUuid.MustParse(validTenantID), Name: "Gregory", Version: 1}},
+		{Action: BatchDelete, Tenant: ModelTenant{UUID: libUuid.New()}},
+	}
+
+	var progress []int
+	results := ApplyBatch(context.Background(), operations, false, func(done int) {
+		progress = append(progress, done)
+	})
+
+	assert.Equal(t, []int{1, 2, 3}, progress)
+	if assert.Len(t, results, 3) {
+		if assert.NoError(t, results[0].Err) {
+			assert.Equal(t, StatusActive, results[0].Tenant.Status)
+		}
+		if assert.NoError(t, results[1].Err) {
+			assert.Equal(t, "Gregory", results[1].Tenant.Name)
+		}
+		assert.ErrorIs(t, results[2].Err, ErrNotFound)
+		assert.Nil(t, results[2].Tenant)
+	}
+
+	// The missing tenant fails the transactional batch, the create before it is rolled back.
+	operations = []BatchOperation{
+		{Action: BatchCreate, Tenant: ModelTenant{Name: "Bob"}},
+		{Action: BatchDelete, Tenant: ModelTenant{UUID: libUuid.New()}},
+		{Action: BatchDelete, Tenant: ModelTenant{UUID: libUuid.MustParse(validTenantID)}},
+	}
+
+	results = ApplyBatch(context.Background(), operations, true, nil)
+	if assert.Len(t, results, 3) {
+		assert.ErrorIs(t, results[0].Err, ErrBatchRolledBack)
+		assert.ErrorIs(t, results[1].Err, ErrNotFound)
+		assert.ErrorIs(t, results[2].Err, ErrBatchRolledBack)
+	}
+
+	tenants, err := (&ModelTenant{}).GetAll()
+	if assert.NoError(t, err) {
+		assert.Len(t, *tenants, 2)
+	}
+
+	operations = []BatchOperation{
+		{Action: BatchCreate, Tenant: ModelTenant{Name: "Bob"}},
+		{Action: BatchDelete, Tenant: ModelTenant{UUID: libUuid.MustParse(validTenantID), Version: 2}},
+	}
+
+	results = ApplyBatch(context.Background(), operations, true, nil)
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+	}
+
+	tenants, err = (&ModelTenant{}).GetAll()
+	if assert.NoError(t, err) {
+		assert.Len(t, *tenants, 2)
+	}
+	t.Log("End TestApplyBatch")
+}
+
+func TestImportTenants(t *testing.T) {
+	seedOneTenant()
+
+	tenants := []ModelTenant{
+		{UUID: libUuid.New(), Name: "Alice"},
+		{UUID: libUuid.MustParse(validTenantID), Name: "Gregory"},
+		{UUID: libUuid.New(), Name: "Greg"},
+		{UUID: libUuid.New(), Name: "Suspended", Status: StatusSuspended},
+	}
+
+	// A dry run reports what would happen without writing anything.
+	results, err := Import(context.Background(), tenants, ConflictOverwrite, true, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ImportCreated, results[0].Outcome)
+		assert.Equal(t, ImportUpdated, results[1].Outcome)
+		assert.Equal(t, ImportCreated, results[3].Outcome)
+	}
+
+	all, err := (&ModelTenant{}).GetAll()
+	if assert.NoError(t, err) {
+		assert.Len(t, *all, 1)
+	}
+
+	var progress []int
+	results, err = Import(context.Background(), tenants, ConflictSkip, false, func(done int) {
+		progress = append(progress, done)
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int{1, 2, 3, 4}, progress)
+		assert.Equal(t, ImportCreated, results[0].Outcome)
+		assert.Equal(t, StatusActive, results[0].Tenant.Status)
+		assert.Equal(t, ImportSkipped, results[1].Outcome)
+		assert.Equal(t, ImportSkipped, results[2].Outcome)
+		assert.Equal(t, ImportCreated, results[3].Outcome)
+		assert.Equal(t, StatusSuspended, results[3].Tenant.Status)
+	}
+
+	results, err = Import(context.Background(), tenants[1:2], ConflictOverwrite, false, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ImportUpdated, results[0].Outcome)
+		assert.Equal(t, "Gregory", results[0].Tenant.Name)
+	}
+
+	// The name is already taken by another tenant, only this tenant fails.
+	results, err = Import(context.Background(), []ModelTenant{{UUID: libUuid.New(), Name: "Bob"}, {UUID: libUuid.MustParse(validTenantID), Name: "Alice"}}, ConflictOverwrite, false, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ImportCreated, results[0].Outcome)
+		assert.Equal(t, ImportFailed, results[1].Outcome)
+		assert.Error(t, results[1].Err)
+	}
+
+	results, err = Import(context.Background(), []ModelTenant{{UUID: libUuid.New(), Name: "Carol"}, {UUID: libUuid.New(), Name: "Bob"}}, ConflictFail, false, nil)
+	if assert.ErrorIs(t, err, ErrImportConflict) {
+		assert.Equal(t, ImportSkipped, results[0].Outcome)
+		assert.Equal(t, ImportFailed, results[1].Outcome)
+	}
+
+	count := 0
+	err = (&ModelTenant{}).EachInBatches(2, func(tenants []ModelTenant) error {
+		assert.LessOrEqual(t, len(tenants), 2)
+		count += len(tenants)
+		return nil
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 4, count)
+	}
+	t.Log("End TestImportTenants")
+}
+
+func TestCachedReads(t *testing.T) {
+	err := refreshTenantTable()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	seedOneTenant()
+
+	ctx := cache.NewContext(context.Background(), cache.NewLRU(10, time.Hour))
+	tenantID := libUuid.MustParse(validTenantID)
+
+	cachedTenant, err := (&ModelTenant{UUID: tenantID}).WithContext(ctx).GetOneCached()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Greg", cachedTenant.Name)
+	}
+	tenants, err := (&ModelTenant{}).WithContext(ctx).GetAllCached()
+	if assert.NoError(t, err) {
+		assert.Len(t, *tenants, 1)
+	}
+
+	// Changes made out of the cache aren't seen until the values expire.
+	err = DbClient.Model(&ModelTenant{}).Where("uuid = ?", tenantID).Update("plan", "pro").Error
+	assert.NoError(t, err)
+	cachedTenant, err = (&ModelTenant{UUID: tenantID}).WithContext(ctx).GetOneCached()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "free", cachedTenant.Plan)
+	}
+
+	// Changes made through the models drop the cached values.
+	_, err = (&ModelTenant{UUID: tenantID, Name: "Gregory"}).WithContext(ctx).Update()
+	assert.NoError(t, err)
+	cachedTenant, err = (&ModelTenant{UUID: tenantID}).WithContext(ctx).GetOneCached()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Gregory", cachedTenant.Name)
+		assert.Equal(t, "pro", cachedTenant.Plan)
+	}
+
+	_, err = (&ModelTenant{Name: "Alice"}).WithContext(ctx).Save()
+	assert.NoError(t, err)
+	tenants, err = (&ModelTenant{}).WithContext(ctx).GetAllCached()
+	if assert.NoError(t, err) {
+		assert.Len(t, *tenants, 2)
+	}
+
+	_, err = (&ModelTenant{UUID: tenantID}).WithContext(ctx).Delete()
+	assert.NoError(t, err)
+	_, err = (&ModelTenant{UUID: tenantID}).WithContext(ctx).GetOneCached()
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestAuditTrail(t *testing.T) {
+	err := refreshTenantTable()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	ctx := audit.NewContext(context.Background(), audit.Actor{Subject: "alice", IP: "192.0.2.1"})
+	tenantID := libUuid.New()
+
+	tenant := &ModelTenant{UUID: tenantID, Name: "Audited"}
+	_, err = tenant.WithContext(ctx).Save()
+	assert.NoError(t, err)
+	_, err = (&ModelTenant{UUID: tenantID, Plan: "pro"}).WithContext(ctx).Update()
+	assert.NoError(t, err)
+	_, err = (&ModelTenant{UUID: tenantID}).WithContext(ctx).Delete()
+	assert.NoError(t, err)
+	_, err = (&ModelTenant{UUID: tenantID}).WithContext(ctx).Restore()
+	assert.NoError(t, err)
+
+	// A failed change isn't recorded, as it is rolled back with the entry.
+	_, err = (&ModelTenant{UUID: tenantID, Name: "Audited", Version: 1}).WithContext(ctx).Replace()
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	entries, err := (&audit.ModelAuditEntry{}).Find(audit.Filter{Tenant: tenantID.String()}, 10, 0)
+	if !assert.NoError(t, err) || !assert.Len(t, entries, 4) {
+		return
+	}
+
+	// The latest first.
+	assert.Equal(t, audit.ActionTenantRestore, entries[0].Action)
+	assert.Equal(t, audit.ActionTenantDelete, entries[1].Action)
+	assert.Equal(t, audit.ActionTenantUpdate, entries[2].Action)
+	assert.Equal(t, audit.ActionTenantCreate, entries[3].Action)
+	for _, entry := range entries {
+		assert.Equal(t, "alice", entry.Actor)
+		assert.Equal(t, "192.0.2.1", entry.IP)
+	}
+
+	// Only the changed fields are kept, numbers being read back from JSON.
+	assert.Equal(t, audit.Changes{
+		"plan":    {Before: "free", After: "pro"},
+		"version": {Before: float64(1), After: float64(2)},
+	}, entries[2].Changes)
+	assert.Equal(t, "Audited", entries[3].Changes["name"].After)
+	assert.Nil(t, entries[3].Changes["name"].Before)
+	assert.Equal(t, "Audited", entries[1].Changes["name"].Before)
+
+	// Changes without an actor are made by the system.
+	_, err = (&ModelTenant{UUID: tenantID}).HardDelete()
+	assert.NoError(t, err)
+	entries, err = (&audit.ModelAuditEntry{}).Find(audit.Filter{Tenant: tenantID.String(), Action: audit.ActionTenantPurge}, 10, 0)
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, audit.SystemSubject, entries[0].Actor)
+	}
+
+	// The trail is append-only.
+	assert.ErrorIs(t, DbClient.Delete(&entries[0]).Error, audit.ErrAppendOnly)
+	assert.ErrorIs(t, DbClient.Model(&entries[0]).Update("actor", "mallory").Error, audit.ErrAppendOnly)
+}
@@ -0,0 +1,24 @@
+package tenant
+
+import (
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/webhook"
+	"gorm.io/gorm"
+)
+
+// events are the webhook events sent for the audited actions.
+var events = map[string]string{
+	audit.ActionTenantCreate:  webhook.EventTenantCreated,
+	audit.ActionTenantUpdate:  webhook.EventTenantUpdated,
+	audit.ActionTenantDelete:  webhook.EventTenantDeleted,
+	audit.ActionTenantRestore: webhook.EventTenantRestored,
+	audit.ActionTenantPurge:   webhook.EventTenantPurged,
+}
+
+// notify is used to queue the webhook event of the action within transaction, with the tenant state as data.
+func notify(transaction *gorm.DB, action string, tenant *ModelTenant) error {
+	data := tenant.state()
+	data["uuid"] = tenant.UUID
+
+	return webhook.Enqueue(transaction, events[action], data)
+}
@@ -0,0 +1,393 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	libUuid "github.com/google/uuid"
+	databaseManager "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+)
+
+// Events sent to the subscriptions.
+const (
+	EventTenantCreated  = "tenant.created"
+	EventTenantUpdated  = "tenant.updated"
+	EventTenantDeleted  = "tenant.deleted"
+	EventTenantRestored = "tenant.restored"
+	EventTenantPurged   = "tenant.purged"
+	EventTaskCompleted  = "task.completed"
+	EventTaskFailed     = "task.failed"
+)
+
+// Statuses of a delivery.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// maxErrorLength is the length the error of a failed attempt is truncated to.
+const maxErrorLength = 1000
+
+var (
+	// ErrNotFound is returned when the subscription doesn't exist in database.
+	ErrNotFound = errors.New("webhook subscription not found in database")
+	// ErrDeliveryNotFound is returned when the delivery doesn't exist for the subscription.
+	ErrDeliveryNotFound = errors.New("webhook delivery not found in database")
+)
+
+type (
+	// ModelSubscription is an endpoint the events matching its filters are posted to, signed with its secret.
+	ModelSubscription struct {
+		ID        uint         `gorm:"primarykey"`
+		UUID      libUuid.UUID `gorm:"uniqueIndex;not null"`
+		URL       string       `gorm:"not null;type:varchar(2048)"`
+		Secret    string       `gorm:"not null;type:varchar(255)"`
+		Events    []string     `gorm:"serializer:json;type:text"`
+		Active    bool         `gorm:"not null;default:true"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+
+		// ctx is the context the queries of the subscription run within, set by WithContext.
+		ctx context.Context
+	}
+
+	// ModelDelivery is an event sent to a subscription, with the outcome of its last attempt.
+	ModelDelivery struct {
+		ID             uint              `gorm:"primarykey"`
+		UUID           libUuid.UUID      `gorm:"uniqueIndex;not null"`
+		SubscriptionID uint              `gorm:"index;not null"`
+		Subscription   ModelSubscription `gorm:"foreignKey:SubscriptionID"`
+		Event          string            `gorm:"not null;type:varchar(50)"`
+		Payload        []byte            `gorm:"not null"`
+		Status         string            `gorm:"index;not null;type:varchar(20);default:'pending'"`
+		Attempts       int               `gorm:"not null;default:0"`
+		ResponseCode   int
+		LastError      string    `gorm:"type:text"`
+		NextAttemptAt  time.Time `gorm:"index;not null"`
+		DeliveredAt    *time.Time
+		CreatedAt      time.Time
+		UpdatedAt      time.Time
+
+		// ctx is the context the queries of the delivery run within, set by WithContext.
+		ctx context.Context
+	}
+
+	// envelope is the body posted for an event, its ID being shared by the deliveries of the event.
+	envelope struct {
+		ID        libUuid.UUID `json:"id"`
+		Event     string       `json:"event"`
+		CreatedAt time.Time    `json:"createdAt"`
+		Data      interface{}  `json:"data"`
+	}
+)
+
+// TableName used to set the table name.
+func (ModelSubscription) TableName() string {
+	return "webhook_subscription"
+}
+
+// TableName used to set the table name.
+func (ModelDelivery) TableName() string {
+	return "webhook_delivery"
+}
+
+// BeforeCreate used to generate the UUID of new subscriptions.
+func (subscriptionModel *ModelSubscription) BeforeCreate(*gorm.DB) error {
+	if subscriptionModel.UUID == libUuid.Nil {
+		subscriptionModel.UUID = libUuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate used to generate the UUID of new deliveries.
+func (deliveryModel *ModelDelivery) BeforeCreate(*gorm.DB) error {
+	if deliveryModel.UUID == libUuid.Nil {
+		deliveryModel.UUID = libUuid.New()
+	}
+	return nil
+}
+
+// Matches is used to know if event passes the filters of the subscription: an event name,
+// a prefix such as "tenant.*", or "*" for every event.
+func (subscriptionModel *ModelSubscription) Matches(event string) bool {
+	for _, filter := range subscriptionModel.Events {
+		if filter == "*" || filter == event {
+			return true
+		}
+
+		if prefix, found := strings.CutSuffix(filter, "*"); found && strings.HasPrefix(event, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithContext is used to run the next queries of the subscription within ctx, on the database client it carries.
+func (subscriptionModel *ModelSubscription) WithContext(ctx context.Context) *ModelSubscription {
+	subscriptionModel.ctx = ctx
+	return subscriptionModel
+}
+
+// WithContext is used to run the next queries of the delivery within ctx, on the database client it carries.
+func (deliveryModel *ModelDelivery) WithContext(ctx context.Context) *ModelDelivery {
+	deliveryModel.ctx = ctx
+	return deliveryModel
+}
+
+// connect is used to get the database client, the one carried by ctx when there is one.
+func connect(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		return databaseManager.Connect()
+	}
+	return databaseManager.FromContext(ctx)
+}
+
+// GetAll is used to get all the subscriptions.
+func (subscriptionModel *ModelSubscription) GetAll() (*[]ModelSubscription, error) {
+	var subscriptions []ModelSubscription
+	err := connect(subscriptionModel.ctx).Order("id").Find(&subscriptions).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscriptions, nil
+}
+
+// GetOne is used to get the subscription of the UUID.
+func (subscriptionModel *ModelSubscription) GetOne() (*ModelSubscription, error) {
+	err := connect(subscriptionModel.ctx).Where("uuid = ?", subscriptionModel.UUID).First(subscriptionModel).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return subscriptionModel, nil
+}
+
+// Save is used to create the subscription.
+func (subscriptionModel *ModelSubscription) Save() (*ModelSubscription, error) {
+	err := connect(subscriptionModel.ctx).Create(subscriptionModel).Error
+	if err != nil {
+		return nil, err
+	}
+	return subscriptionModel, nil
+}
+
+// Update is used to overwrite the URL, events and active flag of the subscription, and its secret unless empty.
+func (subscriptionModel *ModelSubscription) Update() (*ModelSubscription, error) {
+	fields := []string{"url", "events", "active"}
+	if subscriptionModel.Secret != "" {
+		fields = append(fields, "secret")
+	}
+
+	result := connect(subscriptionModel.ctx).Model(&ModelSubscription{}).
+		Where("uuid = ?", subscriptionModel.UUID).
+		Select(fields).
+		Updates(subscriptionModel)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+
+	return subscriptionModel.GetOne()
+}
+
+// Delete is used to drop the subscription along with its deliveries.
+func (subscriptionModel *ModelSubscription) Delete() (bool, error) {
+	var isDeleted bool
+	err := connect(subscriptionModel.ctx).Transaction(func(transaction *gorm.DB) error {
+		err := transaction.Where("uuid = ?", subscriptionModel.UUID).First(subscriptionModel).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = transaction.Where("subscription_id = ?", subscriptionModel.ID).Delete(&ModelDelivery{}).Error
+		if err != nil {
+			return err
+		}
+
+		isDeleted = true
+		return transaction.Delete(subscriptionModel).Error
+	})
+	return isDeleted, err
+}
+
+// Enqueue is used to queue a delivery of the event to each active subscription it matches, within transaction,
+// so the event is only sent if the change it reports is committed. data is the JSON payload of the event.
+func Enqueue(transaction *gorm.DB, event string, data interface{}) error {
+	var subscriptions []ModelSubscription
+	err := transaction.Where("active = ?", true).Find(&subscriptions).Error
+	if err != nil {
+		return err
+	}
+
+	var deliveries []ModelDelivery
+	var payload []byte
+	for i := range subscriptions {
+		if !subscriptions[i].Matches(event) {
+			continue
+		}
+
+		if payload == nil {
+			payload, err = json.Marshal(envelope{ID: libUuid.New(), Event: event, CreatedAt: time.Now().UTC(), Data: data})
+			if err != nil {
+				return err
+			}
+		}
+
+		deliveries = append(deliveries, ModelDelivery{
+			SubscriptionID: subscriptions[i].ID,
+			Event:          event,
+			Payload:        payload,
+			Status:         StatusPending,
+			NextAttemptAt:  time.Now(),
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return transaction.Omit("Subscription").Create(&deliveries).Error
+}
+
+// Enqueue is used to queue the event on the database client of the delivery context,
+// in the transaction it carries if any.
+func (deliveryModel *ModelDelivery) Enqueue(event string, data interface{}) error {
+	return Enqueue(connect(deliveryModel.ctx), event, data)
+}
+
+// Find is used to get up to limit deliveries of the subscription, the latest first.
+// A non zero before only selects the deliveries older than the delivery of this ID, to get the next page.
+func (deliveryModel *ModelDelivery) Find(subscriptionID uint, limit int, before uint) ([]ModelDelivery, error) {
+	query := connect(deliveryModel.ctx).Where("subscription_id = ?", subscriptionID)
+	if before != 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	var deliveries []ModelDelivery
+	err := query.Order("id DESC").Limit(limit).Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// GetOne is used to get the delivery of the UUID, if it belongs to its subscription.
+func (deliveryModel *ModelDelivery) GetOne() (*ModelDelivery, error) {
+	err := connect(deliveryModel.ctx).
+		Where("uuid = ? AND subscription_id = ?", deliveryModel.UUID, deliveryModel.SubscriptionID).
+		First(deliveryModel).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDeliveryNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return deliveryModel, nil
+}
+
+// Redeliver is used to queue the event of the delivery again, as a new delivery sent right away.
+// The event keeps its ID, for the receivers to recognize it.
+func (deliveryModel *ModelDelivery) Redeliver() (*ModelDelivery, error) {
+	redelivery := ModelDelivery{
+		SubscriptionID: deliveryModel.SubscriptionID,
+		Event:          deliveryModel.Event,
+		Payload:        deliveryModel.Payload,
+		Status:         StatusPending,
+		NextAttemptAt:  time.Now(),
+	}
+
+	err := connect(deliveryModel.ctx).Omit("Subscription").Create(&redelivery).Error
+	if err != nil {
+		return nil, err
+	}
+	return &redelivery, nil
+}
+
+// Claim is used to take up to limit pending deliveries due for an attempt, the most overdue first, with their
+// subscription. They are postponed by lease, so other replicas skip them, and attempted again after it if the
+// outcome of the attempt isn't recorded: the events are delivered at least once.
+func (deliveryModel *ModelDelivery) Claim(limit int, lease time.Duration) ([]ModelDelivery, error) {
+	var deliveries []ModelDelivery
+	err := connect(deliveryModel.ctx).Transaction(func(transaction *gorm.DB) error {
+		now := time.Now()
+		err := transaction.
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&deliveries).Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(deliveries))
+		for i := range deliveries {
+			ids[i] = deliveries[i].ID
+		}
+
+		err = transaction.Model(&ModelDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+		if err != nil {
+			return err
+		}
+
+		return transaction.Preload("Subscription").Where("id IN ?", ids).Order("next_attempt_at, id").Find(&deliveries).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt is used to store the outcome of an attempt: the response code, zero if no response was received,
+// and the error. A nil nextAttempt marks a failed delivery as given up.
+func (deliveryModel *ModelDelivery) RecordAttempt(responseCode int, attemptErr error, nextAttempt *time.Time) error {
+	now := time.Now()
+	fields := map[string]interface{}{
+		"attempts":      gorm.Expr("attempts + 1"),
+		"response_code": responseCode,
+		"last_error":    "",
+	}
+
+	switch {
+	case attemptErr == nil:
+		fields["status"] = StatusSucceeded
+		fields["delivered_at"] = now
+	case nextAttempt == nil:
+		fields["status"] = StatusFailed
+	default:
+		fields["next_attempt_at"] = *nextAttempt
+	}
+
+	if attemptErr != nil {
+		lastError := attemptErr.Error()
+		if len(lastError) > maxErrorLength {
+			lastError = lastError[:maxErrorLength]
+		}
+		fields["last_error"] = lastError
+	}
+
+	return connect(deliveryModel.ctx).Model(&ModelDelivery{}).Where("id = ?", deliveryModel.ID).Updates(fields).Error
+}
+
+// PurgeFinishedBefore is used to drop the succeeded and given up deliveries created before the given time.
+func (deliveryModel *ModelDelivery) PurgeFinishedBefore(before time.Time) (int64, error) {
+	result := connect(deliveryModel.ctx).
+		Where("status <> ? AND created_at < ?", StatusPending, before).
+		Delete(&ModelDelivery{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// RunPurgeScheduler is used to call purge every interval, until ctx is cancelled. The rows purge drops are
+// logged with logger at level, named by what, such as "deleted tenants". Its errors are logged, and the next
+// call tried on the next tick.
+func RunPurgeScheduler(ctx context.Context, interval time.Duration, logger zerolog.Logger, level zerolog.Level, what string, purge func(ctx context.Context) (int64, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := purge(ctx)
+			if err != nil {
+				logger.Error().Err(err).Msg("Error purging " + what)
+				continue
+			}
+
+			if purged > 0 {
+				logger.WithLevel(level).Int64("purged", purged).Msg("Purged " + what)
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+// afterCommitKey is the context key of the functions run once the transaction the context carries is committed.
+type afterCommitKey struct{}
+
+// Transaction is used to run fn in a transaction on the client carried by ctx, committed only when fn succeeds.
+// The context given to fn carries the transaction, so the models called with it join it. When ctx already
+// carries a transaction, fn runs in a nested one, rolled back on its own on failure.
+func Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	callbacks, nested := ctx.Value(afterCommitKey{}).(*[]func())
+	if !nested {
+		callbacks = &[]func(){}
+	}
+
+	err := FromContext(ctx).Transaction(func(transaction *gorm.DB) error {
+		return fn(context.WithValue(NewContext(ctx, transaction), afterCommitKey{}, callbacks))
+	})
+	if err != nil || nested {
+		return err
+	}
+
+	for _, callback := range *callbacks {
+		callback()
+	}
+	return nil
+}
+
+// AfterCommit is used to run fn once the transaction carried by ctx is committed, such as to drop cached values.
+// It runs fn right away when ctx doesn't carry a transaction, and never if the transaction is rolled back.
+func AfterCommit(ctx context.Context, fn func()) {
+	if ctx != nil {
+		if callbacks, found := ctx.Value(afterCommitKey{}).(*[]func()); found {
+			*callbacks = append(*callbacks, fn)
+			return
+		}
+	}
+	fn()
+}
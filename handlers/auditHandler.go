@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	auditModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+type (
+	// HandlerAudit serves the audit trail.
+	HandlerAudit struct {
+		auditModel auditModel.ModelAuditEntry
+	}
+
+	auditEntryJSON struct {
+		ID        uint               `json:"id"`
+		CreatedAt time.Time          `json:"createdAt"`
+		Actor     string             `json:"actor"`
+		Tenant    string             `json:"tenant,omitempty"`
+		Action    string             `json:"action"`
+		Changes   auditModel.Changes `json:"changes"`
+		RequestID string             `json:"requestId,omitempty"`
+		IP        string             `json:"ip,omitempty"`
+	}
+
+	auditPageJSON struct {
+		Entries    []auditEntryJSON `json:"entries"`
+		NextCursor string           `json:"nextCursor,omitempty"`
+	}
+)
+
+// CreateHandlerAudit is used to create the handler of the audit trail.
+func CreateHandlerAudit(entry auditModel.ModelAuditEntry) *HandlerAudit {
+	return &HandlerAudit{entry}
+}
+
+// AuditMiddleware is used to carry the subject and address of the request in its context,
+// as the actor of the changes it makes. It must run after the subject is known.
+func AuditMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		actor := auditModel.Actor{Subject: logging.Subject(c), IP: c.RealIP()}
+		c.SetRequest(c.Request().WithContext(auditModel.NewContext(c.Request().Context(), actor)))
+		return next(c)
+	}
+}
+
+func toAuditEntryJSON(entry auditModel.ModelAuditEntry) auditEntryJSON {
+	return auditEntryJSON{
+		ID:        entry.ID,
+		CreatedAt: entry.CreatedAt,
+		Actor:     entry.Actor,
+		Tenant:    entry.Tenant,
+		Action:    entry.Action,
+		Changes:   entry.Changes,
+		RequestID: entry.RequestID,
+		IP:        entry.IP,
+	}
+}
+
+// auditFilter is used to read the audit entries selected by the query parameters.
+func auditFilter(c echo.Context) (auditModel.Filter, error) {
+	filter := auditModel.Filter{
+		Actor:  c.QueryParam("actor"),
+		Tenant: c.QueryParam("tenant"),
+		Action: c.QueryParam("action"),
+	}
+
+	for field, bound := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		rawTime := c.QueryParam(field)
+		if rawTime == "" {
+			continue
+		}
+
+		parsedTime, err := time.Parse(time.RFC3339, rawTime)
+		if err != nil {
+			return filter, problem.Validation("invalid "+field, problem.FieldError{Field: field, Rule: "datetime", Message: "must be an RFC 3339 date and time"})
+		}
+		*bound = parsedTime
+	}
+
+	return filter, nil
+}
+
+// Find godoc
+// @Summary List audit entries
+// @Description list the recorded changes matching the filters, the latest first, a page at a time
+// @Tags audit
+// @Produce  json
+// @Param actor query string false "Subject who made the change"
+// @Param tenant query string false "Tenant changed"
+// @Param action query string false "Action, such as tenant.update or policy.add"
+// @Param from query string false "RFC 3339 time of the oldest entry"
+// @Param to query string false "RFC 3339 time the entries are older than"
+// @Param limit query int false "Maximum number of entries"
+// @Param cursor query string false "nextCursor of the previous page"
+// @Success 200 {object} handlers.auditPageJSON
+// @Failure 422 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /audit [get]
+func (h HandlerAudit) Find(c echo.Context) error {
+	filter, err := auditFilter(c)
+	if err != nil {
+		return err
+	}
+
+	limit, cursor, err := pageParams(c, defaultAuditLimit, maxAuditLimit)
+	if err != nil {
+		return err
+	}
+
+	entries, err := h.auditModel.WithContext(c.Request().Context()).Find(filter, limit, cursor)
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	page := auditPageJSON{Entries: []auditEntryJSON{}}
+	for _, entry := range entries {
+		page.Entries = append(page.Entries, toAuditEntryJSON(entry))
+	}
+
+	if len(entries) > 0 {
+		page.NextCursor = nextCursor(len(entries), limit, entries[len(entries)-1].ID)
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// Export godoc
+// @Summary Export audit entries
+// @Description stream all the recorded changes matching the filters as newline delimited JSON, the oldest first
+// @Tags audit
+// @Produce  application/x-ndjson
+// @Param actor query string false "Subject who made the change"
+// @Param tenant query string false "Tenant changed"
+// @Param action query string false "Action, such as tenant.update or policy.add"
+// @Param from query string false "RFC 3339 time of the oldest entry"
+// @Param to query string false "RFC 3339 time the entries are older than"
+// @Success 200 {array} handlers.auditEntryJSON
+// @Failure 422 {object} problem.Problem
+// @Router /audit/export [get]
+func (h HandlerAudit) Export(c echo.Context) error {
+	filter, err := auditFilter(c)
+	if err != nil {
+		return err
+	}
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, MIMEApplicationNDJSON)
+	response.Header().Set(echo.HeaderContentDisposition, `attachment; filename="audit.ndjson"`)
+	response.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(response)
+	err = h.auditModel.WithContext(c.Request().Context()).EachInBatches(filter, exportBatchSize, func(entries []auditModel.ModelAuditEntry) error {
+		for _, entry := range entries {
+			if err := encoder.Encode(toAuditEntryJSON(entry)); err != nil {
+				return err
+			}
+		}
+
+		response.Flush()
+		return nil
+	})
+	if err != nil {
+		// The status is already sent, the truncated body is all the client gets.
+		c.Logger().Error(err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	auditModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func refreshAuditTable(t *testing.T) {
+	err := DbClient.Exec("DROP TABLE IF EXISTS audit_entry").Error
+	if err == nil {
+		err = DbClient.AutoMigrate(&auditModel.ModelAuditEntry{})
+	}
+	assert.NoError(t, err)
+}
+
+func TestAuditTrail(t *testing.T) {
+	refreshAuditTable(t)
+	e := echo.New()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	h := CreateHandlerAudit(auditModel.ModelAuditEntry{})
+
+	ctx := auditModel.NewContext(context.Background(), auditModel.Actor{Subject: "alice"})
+	for _, action := range []string{auditModel.ActionTenantCreate, auditModel.ActionTenantUpdate, auditModel.ActionTenantUpdate} {
+		assert.NoError(t, (&auditModel.ModelAuditEntry{}).WithContext(ctx).Record(action, validTenantID, auditModel.Changes{}))
+	}
+	assert.NoError(t, (&auditModel.ModelAuditEntry{}).Record(auditModel.ActionPolicyAdd, "", auditModel.Changes{}))
+
+	find := func(query string) (int, auditPageJSON) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/audit?"+query, nil), rec)
+		handle(c, h.Find)
+
+		var page auditPageJSON
+		if rec.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		}
+		return rec.Code, page
+	}
+
+	// Assertions
+	code, page := find("actor=alice&action=tenant.update&limit=1")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, page.Entries, 1) {
+		assert.Equal(t, uint(3), page.Entries[0].ID)
+		assert.Equal(t, validTenantID, page.Entries[0].Tenant)
+	}
+
+	code, page = find("actor=alice&action=tenant.update&limit=1&cursor=" + page.NextCursor)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, page.Entries, 1) {
+		assert.Equal(t, uint(2), page.Entries[0].ID)
+	}
+
+	code, page = find("actor=alice&action=tenant.update&limit=1&cursor=" + page.NextCursor)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, page.Entries)
+	assert.Empty(t, page.NextCursor)
+
+	code, page = find("actor=system")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, page.Entries, 1) {
+		assert.Equal(t, auditModel.ActionPolicyAdd, page.Entries[0].Action)
+	}
+
+	code, page = find("to=2000-01-01T00:00:00Z")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, page.Entries)
+
+	code, _ = find("from=yesterday")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	code, _ = find("cursor=abc")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/audit/export?tenant="+validTenantID, nil), rec)
+	handle(c, h.Export)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, MIMEApplicationNDJSON, rec.Header().Get(echo.HeaderContentType))
+
+	// Exported oldest first, one entry per line.
+	var actions []string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var entry auditEntryJSON
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []string{auditModel.ActionTenantCreate, auditModel.ActionTenantUpdate, auditModel.ActionTenantUpdate}, actions)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	libUUID "github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	tenantModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/tenant"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HeaderETag is the response header carrying the entity tag.
+	HeaderETag = "ETag"
+	// HeaderIfMatch is the request header making writes conditional on the entity tag.
+	HeaderIfMatch = "If-Match"
+	// HeaderIfNoneMatch is the request header making reads conditional on the entity tag.
+	HeaderIfNoneMatch = "If-None-Match"
+)
+
+// errPreconditionFailed is returned when no entity tag of If-Match can match the tenant.
+var errPreconditionFailed = errors.New("tenant version doesn't match If-Match")
+
+// tenantETag is used to build the entity tag of a tenant from its version.
+func tenantETag(tenant tenantModel.ModelTenant) string {
+	return fmt.Sprintf("\"%d\"", tenant.Version)
+}
+
+// contentETag is used to build the entity tag of a response from its content.
+func contentETag(value interface{}) (string, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf("%q", hex.EncodeToString(sum[:16])), nil
+}
+
+// entityTags is used to split a If-Match or If-None-Match header value into its entity tags.
+func entityTags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// jsonWithETag is used to answer with the ETag header set, or with 304 when If-None-Match already lists it.
+func jsonWithETag(c echo.Context, etag string, value interface{}) error {
+	c.Response().Header().Set(HeaderETag, etag)
+
+	// If-None-Match uses the weak comparison.
+	for _, tag := range entityTags(c.Request().Header.Get(HeaderIfNoneMatch)) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return c.NoContent(http.StatusNotModified)
+		}
+	}
+
+	return c.JSON(http.StatusOK, value)
+}
+
+// expectedVersion is used to read the tenant version required by If-Match, 0 when any version is accepted.
+func (h HandlerTenant) expectedVersion(c echo.Context, tenantID libUUID.UUID) (uint, error) {
+	header := c.Request().Header.Get(HeaderIfMatch)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	// If-Match uses the strong comparison, weak and foreign tags never match.
+	var versions []uint
+	for _, tag := range entityTags(header) {
+		unquoted, err := strconv.Unquote(tag)
+		if err != nil || strings.HasPrefix(tag, "W/") {
+			continue
+		}
+
+		version, err := strconv.ParseUint(unquoted, 10, 0)
+		if err == nil && version > 0 {
+			versions = append(versions, uint(version))
+		}
+	}
+
+	if len(versions) == 0 {
+		return 0, errPreconditionFailed
+	}
+
+	if len(versions) == 1 {
+		return versions[0], nil
+	}
+
+	tenant := tenantModel.ModelTenant{UUID: tenantID}
+	current, err := tenant.WithContext(c.Request().Context()).GetOne()
+	if err != nil {
+		// Let the operation itself report the missing tenant.
+		return 0, nil
+	}
+
+	for _, version := range versions {
+		if version == current.Version {
+			return version, nil
+		}
+	}
+	return 0, errPreconditionFailed
+}
+
+// versionConflict is used to report a failed optimistic concurrency check.
+func versionConflict(c echo.Context) error {
+	if c.Request().Header.Get(HeaderIfMatch) != "" {
+		return problem.PreconditionFailed(errPreconditionFailed.Error())
+	}
+	return problem.Conflict("tenant was modified concurrently, retry the request")
+}
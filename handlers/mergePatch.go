@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+)
+
+// MIMEApplicationMergePatch is the media type of RFC 7396 JSON merge patches.
+const MIMEApplicationMergePatch = "application/merge-patch+json"
+
+// applyMergePatch is used to apply a RFC 7396 JSON merge patch to a JSON document.
+func applyMergePatch(document []byte, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+
+	var patchValue interface{}
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergePatch(target, patchValue))
+}
+
+// mergePatch is the recursive MergePatch function described by RFC 7396.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+
+	return targetObject
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"github.com/labstack/echo/v4"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"strconv"
+)
+
+// pageParams is used to read the limit and cursor query parameters of a list served a page at a time, the latest
+// first. The limit is capped by maxLimit, and the cursor is the ID the elements of the page are older than, zero
+// for the first page.
+func pageParams(c echo.Context, defaultLimit int, maxLimit int) (int, uint, error) {
+	limit := defaultLimit
+	if rawLimit := c.QueryParam("limit"); rawLimit != "" {
+		parsedLimit, err := strconv.Atoi(rawLimit)
+		if err != nil || parsedLimit < 1 {
+			return 0, 0, problem.Validation("invalid limit", problem.FieldError{Field: "limit", Rule: "min", Message: "must be a number of at least 1"})
+		}
+		limit = min(parsedLimit, maxLimit)
+	}
+
+	var cursor uint64
+	if rawCursor := c.QueryParam("cursor"); rawCursor != "" {
+		var err error
+		cursor, err = strconv.ParseUint(rawCursor, 10, 0)
+		if err != nil || cursor == 0 {
+			return 0, 0, problem.Validation("invalid cursor", problem.FieldError{Field: "cursor", Rule: "cursor", Message: "must be the nextCursor of a previous page"})
+		}
+	}
+
+	return limit, uint(cursor), nil
+}
+
+// nextCursor is used to get the cursor of the page following the one ending with lastID.
+// A full page may be followed by another one, the cursor resumes after its last element.
+func nextCursor(count int, limit int, lastID uint) string {
+	if count < limit {
+		return ""
+	}
+	return strconv.FormatUint(uint64(lastID), 10)
+}
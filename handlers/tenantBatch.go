@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	libUUID "github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	tenantModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/tenant"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/rabbitmq"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/requestid"
+	"net/http"
+	"strconv"
+)
+
+const maxBatchOperations = 500
+
+type (
+	batchRequest struct {
+		Transactional bool             `json:"transactional"`
+		Operations    []batchOperation `json:"operations" validate:"required,min=1"`
+	}
+
+	batchOperation struct {
+		Action  string      `json:"action" validate:"required,oneof=create update delete"`
+		ID      string      `json:"id,omitempty" validate:"omitempty,uuid4"`
+		Version uint        `json:"version,omitempty"`
+		Tenant  *tenantData `json:"tenant,omitempty" validate:"-"`
+	}
+
+	// batchItemResult is the outcome of one batch operation, reported in the task result.
+	batchItemResult struct {
+		Index   int          `json:"index"`
+		Action  string       `json:"action"`
+		ID      libUUID.UUID `json:"id"`
+		Success bool         `json:"success"`
+		Error   string       `json:"error,omitempty"`
+	}
+)
+
+// Batch godoc
+// @Summary Create, update and delete tenants in bulk
+// @Description run a list of operations as one background task, each operation result is reported in the task result.
+// @Description With transactional set, any failure rolls back the whole batch.
+// @Tags tenants
+// @Accept  json
+// @Produce  json
+// @Param batch body handlers.batchRequest true "Operations"
+// @Param Idempotency-Key header string false "Key making retries return the first response"
+// @Success 201 {object} handlers.ResultTask
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /tenants:batch [post]
+func (h HandlerTenant) Batch(c echo.Context) error {
+	request := new(batchRequest)
+
+	if err := c.Bind(request); err != nil {
+		return err
+	}
+
+	if err := c.Validate(request); err != nil {
+		return err
+	}
+
+	if len(request.Operations) > maxBatchOperations {
+		return problem.Validation("a batch can't have more than "+strconv.Itoa(maxBatchOperations)+" operations",
+			problem.FieldError{Field: "operations", Rule: "max", Message: "must have at most " + strconv.Itoa(maxBatchOperations) + " items"})
+	}
+
+	operations := make([]tenantModel.BatchOperation, len(request.Operations))
+	for i := range request.Operations {
+		operation, err := toBatchOperation(c, &request.Operations[i])
+		if err != nil {
+			return batchOperationError(i, err)
+		}
+		operations[i] = operation
+	}
+
+	task := rabbitmq.CreateNewTask([]string{"batch", "tenant"}, "Running "+strconv.Itoa(len(operations))+" tenant operations", requestid.Get(c))
+	err := h.taskManager.PushTask(c.Request().Context(), task)
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	// Progress events are published right away, while the batch runs in its transaction.
+	logger := c.Logger()
+	h.runTask(c, &task, func(ctx context.Context) error {
+		results := tenantModel.ApplyBatch(ctx, operations, request.Transactional, func(done int) {
+			err := h.taskManager.UpdateTaskProgress(ctx, task, float32(done)/float32(len(operations)))
+			if err != nil {
+				logger.Error(err.Error())
+			}
+		})
+
+		itemResults := make([]batchItemResult, len(results))
+		var failure error
+		for i, result := range results {
+			itemResults[i] = batchItemResult{Index: i, Action: string(result.Action), ID: operations[i].Tenant.UUID, Success: result.Err == nil}
+			if result.Err != nil {
+				itemResults[i].Error = result.Err.Error()
+				if failure == nil || errors.Is(failure, tenantModel.ErrBatchRolledBack) {
+					failure = result.Err
+				}
+			} else {
+				itemResults[i].ID = result.Tenant.UUID
+			}
+		}
+
+		task.Progress = 1
+		task.Result = itemResults
+
+		// A transactional batch either fully succeeds or changes nothing, a partial one still completes.
+		if request.Transactional {
+			return failure
+		}
+		return nil
+	})
+
+	return c.JSON(http.StatusCreated, ResultTask{
+		TaskID: task.ID,
+	})
+}
+
+// toBatchOperation is used to validate a batch operation and turn it into its model counterpart.
+func toBatchOperation(c echo.Context, operation *batchOperation) (tenantModel.BatchOperation, error) {
+	modelOperation := tenantModel.BatchOperation{Action: tenantModel.BatchAction(operation.Action)}
+
+	if err := c.Validate(operation); err != nil {
+		return modelOperation, err
+	}
+
+	if modelOperation.Action == tenantModel.BatchDelete {
+		id, err := libUUID.Parse(operation.ID)
+		if err != nil {
+			return modelOperation, errors.New("delete needs the tenant id")
+		}
+
+		modelOperation.Tenant = tenantModel.ModelTenant{UUID: id, Version: operation.Version}
+		return modelOperation, nil
+	}
+
+	if operation.Tenant == nil {
+		return modelOperation, fmt.Errorf("%s needs the tenant", operation.Action)
+	}
+
+	data := operation.Tenant
+	if data.ID == "" {
+		data.ID = operation.ID
+	}
+
+	if operation.ID != "" && data.ID != operation.ID {
+		return modelOperation, errors.New("tenant id doesn't match the operation id")
+	}
+
+	if err := c.Validate(data); err != nil {
+		return modelOperation, problem.Validation("invalid tenant", problem.Fields(err, "tenant.")...)
+	}
+
+	if err := validateTenantData(data); err != nil {
+		return modelOperation, problem.Validation("invalid tenant", problem.Fields(err, "tenant.")...)
+	}
+
+	modelOperation.Tenant = tenantModel.ModelTenant{UUID: libUUID.MustParse(data.ID), Version: operation.Version}
+	applyTenantData(&modelOperation.Tenant, data)
+	return modelOperation, nil
+}
+
+// batchOperationError is used to report an invalid operation, its fields named after their path in the request.
+func batchOperationError(index int, err error) error {
+	prefix := fmt.Sprintf("operations[%d]", index)
+
+	fields := problem.Fields(err, prefix+".")
+	if len(fields) == 0 {
+		return problem.Validation(prefix + ": " + err.Error())
+	}
+	return problem.Validation(prefix+" is invalid", fields...)
+}
@@ -1,11 +1,31 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	libUUID "github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
 	tenantModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/tenant"
+	webhookModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/webhook"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/lifecycle"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
 	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/rabbitmq"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/requestid"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
 )
 
 type (
@@ -16,8 +36,26 @@ type (
 	}
 
 	resultJSON struct {
-		ID   libUUID.UUID `json:"id" validate:"required"`
-		Name string       `json:"name" validate:"required"`
+		ID           libUUID.UUID           `json:"id" validate:"required"`
+		Name         string                 `json:"name" validate:"required"`
+		Slug         string                 `json:"slug"`
+		Status       string                 `json:"status"`
+		ContactEmail string                 `json:"contactEmail,omitempty"`
+		Plan         string                 `json:"plan"`
+		Settings     map[string]interface{} `json:"settings"`
+	}
+
+	searchResultJSON struct {
+		ID        libUUID.UUID `json:"id"`
+		Name      string       `json:"name"`
+		Rank      float64      `json:"rank"`
+		Highlight string       `json:"highlight"`
+	}
+
+	trashResultJSON struct {
+		ID        libUUID.UUID `json:"id"`
+		Name      string       `json:"name"`
+		DeletedAt time.Time    `json:"deletedAt"`
 	}
 
 	// ResultTask Response given by task processing endpoint
@@ -26,47 +64,165 @@ type (
 	}
 
 	tenantData struct {
-		ID   string `json:"id" validate:"required,uuid4"`
-		Name string `json:"name" validate:"required"`
-	}
-
-	errorResult struct {
-		Message string `json:"message" comment:"Something went wrong"`
+		ID           string                 `json:"id" validate:"required,uuid4"`
+		Name         string                 `json:"name" validate:"required,tenantname,notreserved"`
+		Slug         string                 `json:"slug,omitempty" validate:"omitempty,max=100,slug,notreserved"`
+		ContactEmail string                 `json:"contactEmail,omitempty" validate:"omitempty,email"`
+		Plan         string                 `json:"plan,omitempty" validate:"omitempty,oneof=free pro enterprise"`
+		Settings     map[string]interface{} `json:"settings,omitempty"`
 	}
 )
 
+// HeaderTenantID is the request header naming the tenant the request is made for.
+const HeaderTenantID = "X-Tenant-ID"
+
+// contextTenant is the context key of the tenant the request is made for, set by CheckTenantStatus.
+const contextTenant = "tenant"
+
+// CurrentTenant is used to get the tenant the request is made for, nil when there is none.
+func CurrentTenant(c echo.Context) *tenantModel.ModelTenant {
+	tenant, _ := c.Get(contextTenant).(*tenantModel.ModelTenant)
+	return tenant
+}
+
+// backgroundWork tracks the tasks still running once their request is answered.
+var backgroundWork sync.WaitGroup
+
+// runInBackground is used to run the work of a task once its request is answered, tracked for the shutdown.
+func runInBackground(work func()) {
+	backgroundWork.Add(1)
+	go func() {
+		defer backgroundWork.Done()
+		work()
+	}()
+}
+
+// runTask is used to run the work of a task once its request is answered, tracked for the shutdown.
+// The work runs in a transaction along with the completed event of the task, written to the outbox,
+// and its webhook deliveries, so the event is only sent if the changes are committed. The task fails otherwise.
+// The echo context is reused once the response is sent, the task keeps the logger of its request.
+// Its context keeps the trace of the request, but isn't cancelled with it.
+func (h HandlerTenant) runTask(c echo.Context, task *rabbitmq.Task, work func(ctx context.Context) error) {
+	logger := c.Logger()
+	ctx := context.WithoutCancel(c.Request().Context())
+	runInBackground(func() {
+		err := database.Transaction(ctx, func(ctx context.Context) error {
+			if err := work(ctx); err != nil {
+				return err
+			}
+
+			if err := h.taskManager.CompleteTask(ctx, *task); err != nil {
+				return err
+			}
+			return notifyTask(ctx, webhookModel.EventTaskCompleted, "completed", *task)
+		})
+		if err == nil {
+			return
+		}
+
+		logger.Error(err.Error())
+		err = database.Transaction(ctx, func(ctx context.Context) error {
+			if err := h.taskManager.FailTask(ctx, *task); err != nil {
+				return err
+			}
+			return notifyTask(ctx, webhookModel.EventTaskFailed, "failed", *task)
+		})
+		if err != nil {
+			logger.Error(err.Error())
+		}
+	})
+}
+
+// notifyTask is used to queue the webhook event of a finished task within the transaction ctx carries,
+// so it is only sent along with the task event.
+func notifyTask(ctx context.Context, event string, status string, task rabbitmq.Task) error {
+	task.Status = status
+	return (&webhookModel.ModelDelivery{}).WithContext(ctx).Enqueue(event, task)
+}
+
+// WaitBackgroundWork is used on shutdown to wait for the tasks still running, until ctx is done.
+func WaitBackgroundWork(ctx context.Context) error {
+	return lifecycle.WaitGroup(ctx, &backgroundWork)
+}
+
 // CreateHandlerTenant is always in each HandlerTenant
 func CreateHandlerTenant(tenant tenantModel.ModelTenant, taskClient *rabbitmq.TaskClient) *HandlerTenant {
 	return &HandlerTenant{tenant, taskClient}
 }
 
+func toResultJSON(tenant tenantModel.ModelTenant) resultJSON {
+	settings := tenant.Settings
+	if settings == nil {
+		settings = tenantModel.Settings{}
+	}
+
+	return resultJSON{
+		ID:           tenant.UUID,
+		Name:         tenant.Name,
+		Slug:         tenant.Slug,
+		Status:       string(tenant.Status),
+		ContactEmail: tenant.ContactEmail,
+		Plan:         tenant.Plan,
+		Settings:     settings,
+	}
+}
+
+func toTenantData(tenant tenantModel.ModelTenant) tenantData {
+	return tenantData{
+		ID:           tenant.UUID.String(),
+		Name:         tenant.Name,
+		Slug:         tenant.Slug,
+		ContactEmail: tenant.ContactEmail,
+		Plan:         tenant.Plan,
+		Settings:     tenant.Settings,
+	}
+}
+
+// validateTenantData is used for the checks the struct validator can't express.
+func validateTenantData(data *tenantData) error {
+	if err := tenantModel.Settings(data.Settings).Validate(); err != nil {
+		return problem.Validation("invalid settings", problem.FieldError{Field: "settings", Rule: "schema", Message: err.Error()})
+	}
+	return nil
+}
+
+// applyTenantData is used to copy the request fields into the tenant model.
+func applyTenantData(tenant *tenantModel.ModelTenant, data *tenantData) {
+	tenant.Name = data.Name
+	tenant.Slug = data.Slug
+	tenant.ContactEmail = data.ContactEmail
+	tenant.Plan = data.Plan
+	tenant.Settings = data.Settings
+}
+
 // GetAll godoc
 // @Summary List tenants
 // @Description get tenants
 // @Tags tenants
 // @Accept  json
 // @Produce  json
+// @Param If-None-Match header string false "Entity tag of the cached list"
 // @Success 200 {array} handlers.resultJSON
-// @Failure 500 {object} handlers.errorResult
+// @Success 304
+// @Failure 500 {object} problem.Problem
 // @Router /tenants [get]
 func (h HandlerTenant) GetAll(c echo.Context) error {
-	tenants, err := h.tenantModel.GetAll()
+	tenants, err := h.tenantModel.WithContext(c.Request().Context()).GetAllCached()
 	if err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusInternalServerError, errorResult{Message: err.Error()})
+		return problem.Internal(err)
 	}
 
-	var results []resultJSON
+	results := make([]interface{}, 0, len(*tenants))
 	for _, tenant := range *tenants {
-		results = append(results, resultJSON{ID: tenant.UUID, Name: tenant.Name})
+		results = append(results, toVersionedResult(c, tenant))
 	}
 
-	if len(results) == 0 {
-		return c.JSON(http.StatusOK, []resultJSON{})
-
+	etag, err := contentETag(results)
+	if err != nil {
+		return problem.Internal(err)
 	}
 
-	return c.JSON(http.StatusOK, results)
+	return jsonWithETag(c, etag, results)
 }
 
 // GetOneByID godoc
@@ -77,37 +233,76 @@ func (h HandlerTenant) GetAll(c echo.Context) error {
 // @Accept  json
 // @Produce  json
 // @Param id path string true "Tenant ID"
+// @Param If-None-Match header string false "Entity tag of the cached tenant"
 // @Success 200 {object} handlers.resultJSON
-// @Failure 400 {object} handlers.errorResult
-// @Failure 404 {object} handlers.errorResult
+// @Success 304
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
 // @Router /tenants/{id} [get]
 func (h HandlerTenant) GetOneByID(c echo.Context) error {
 	tenantID, err := libUUID.Parse(c.Param("id"))
 	if err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return problem.BadRequest("invalid tenant id")
 	}
 
 	h.tenantModel.UUID = tenantID
 
-	tenant, err := h.tenantModel.GetOne()
+	tenant, err := h.tenantModel.WithContext(c.Request().Context()).GetOneCached()
+	if errors.Is(err, tenantModel.ErrNotFound) {
+		return problem.NotFound(err.Error())
+	}
+
 	if err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusNotFound, nil)
+		return problem.Internal(err)
 	}
 
-	if tenant == nil {
-		return c.JSON(http.StatusNotFound, nil)
+	return jsonWithETag(c, tenantETag(*tenant), toVersionedResult(c, *tenant))
+}
+
+// Search godoc
+// @Summary Search tenants
+// @Description search tenants by partial name, best matches first
+// @Tags tenants
+// @Accept  json
+// @Produce  json
+// @Param q query string true "Search query"
+// @Param limit query int false "Maximum number of results"
+// @Success 200 {array} handlers.searchResultJSON
+// @Failure 400 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /tenants/search [get]
+func (h HandlerTenant) Search(c echo.Context) error {
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if query == "" {
+		return problem.Validation("missing search query", problem.FieldError{Field: "q", Rule: "required", Message: "is required"})
 	}
 
-	if tenant.Name == "" {
-		return c.JSON(http.StatusNotFound, nil)
+	limit := defaultSearchLimit
+	if rawLimit := c.QueryParam("limit"); rawLimit != "" {
+		parsedLimit, err := strconv.Atoi(rawLimit)
+		if err != nil || parsedLimit < 1 {
+			return problem.Validation("invalid limit", problem.FieldError{Field: "limit", Rule: "min", Message: "must be a number of at least 1"})
+		}
+		limit = min(parsedLimit, maxSearchLimit)
 	}
 
-	return c.JSON(http.StatusOK, &resultJSON{
-		ID:   tenant.UUID,
-		Name: tenant.Name,
-	})
+	tenants, err := h.tenantModel.WithContext(c.Request().Context()).Search(query, limit)
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	results := []searchResultJSON{}
+	for _, tenant := range *tenants {
+		results = append(results, searchResultJSON{
+			ID:        tenant.UUID,
+			Name:      tenant.Name,
+			Rank:      tenant.Rank,
+			Highlight: tenant.Highlight,
+		})
+	}
+
+	return c.JSON(http.StatusOK, results)
 }
 
 // Create godoc
@@ -117,54 +312,50 @@ func (h HandlerTenant) GetOneByID(c echo.Context) error {
 // @Accept  json
 // @Produce  json
 // @Param tenant body handlers.tenantData true "Add tenant"
+// @Param Idempotency-Key header string false "Key making retries return the first response"
 // @Success 201 {object} handlers.ResultTask
-// @Failure 400 {object} handlers.errorResult
-// @Failure 500 {object} handlers.errorResult
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /tenants [post]
 func (h HandlerTenant) Create(c echo.Context) error {
 	newTenantData := new(tenantData)
 
 	if err := c.Bind(newTenantData); err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
 	if err := c.Validate(newTenantData); err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return err
+	}
+
+	if err := validateTenantData(newTenantData); err != nil {
+		return err
 	}
 
 	id, err := libUUID.Parse(newTenantData.ID)
 	if err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return problem.Internal(err)
 	}
 
 	h.tenantModel.UUID = id
-	h.tenantModel.Name = newTenantData.Name
+	applyTenantData(&h.tenantModel, newTenantData)
 
-	task := rabbitmq.CreateNewTask([]string{"create", "tenant"}, "Creating tenant "+newTenantData.Name)
-	err = h.taskManager.PushTask(task)
+	task := rabbitmq.CreateNewTask([]string{"create", "tenant"}, "Creating tenant "+newTenantData.Name, requestid.Get(c))
+	err = h.taskManager.PushTask(c.Request().Context(), task)
 	if err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return problem.Internal(err)
 	}
 
-	go func() {
-		_, err = h.tenantModel.Save()
-		if err != nil {
-			c.Logger().Error(err.Error())
-			err = h.taskManager.FailTask(task)
-			if err != nil {
-				c.Logger().Error(err.Error())
-			}
-		} else {
-			err = h.taskManager.CompleteTask(task)
-			if err != nil {
-				c.Logger().Error(err.Error())
-			}
+	h.runTask(c, &task, func(ctx context.Context) error {
+		tenant := h.tenantModel.WithContext(ctx)
+		_, err := tenant.Save()
+		if err == nil {
+			_, err = tenant.Activate()
 		}
-	}()
+		return err
+	})
 
 	return c.JSON(http.StatusCreated, ResultTask{
 		TaskID: task.ID,
@@ -172,73 +363,398 @@ func (h HandlerTenant) Create(c echo.Context) error {
 }
 
 // Update godoc
-// @Summary Update a tenant
-// @Description update by json tenant
+// @Summary Replace a tenant
+// @Description replace all the editable fields of a tenant, omitted fields are reset
 // @Tags tenants
 // @Accept  json
 // @Produce  json
-// @Param tenant body handlers.tenantData true "Update tenant"
+// @Param id path string true "Tenant ID"
+// @Param tenant body handlers.tenantData true "Replace tenant"
+// @Param If-Match header string false "Entity tag the tenant must still have"
 // @Success 200 {object} handlers.resultJSON
-// @Failure 400 {object} handlers.errorResult
-// @Failure 500 {object} handlers.errorResult
-// @Router /tenants [put]
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 412 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /tenants/{id} [put]
 func (h HandlerTenant) Update(c echo.Context) error {
+	tenantID, err := libUUID.Parse(c.Param("id"))
+	if err != nil {
+		return problem.BadRequest("invalid tenant id")
+	}
+
 	post := new(tenantData)
 
 	if err := c.Bind(post); err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
 
-	if err := c.Validate(post); err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusBadRequest, err.Error())
+	if post.ID == "" {
+		post.ID = tenantID.String()
 	}
 
-	id, err := libUUID.Parse(post.ID)
+	version, err := h.expectedVersion(c, tenantID)
 	if err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return versionConflict(c)
 	}
 
-	h.tenantModel.UUID = id
-	h.tenantModel.Name = post.Name
+	return h.replace(c, tenantID, post, version)
+}
 
-	tenant, err := h.tenantModel.Update()
+// Patch godoc
+// @Summary Patch a tenant
+// @Description update some fields of a tenant with a JSON merge patch (RFC 7396), null removes a field
+// @Tags tenants
+// @Accept  application/merge-patch+json
+// @Produce  json
+// @Param id path string true "Tenant ID"
+// @Param patch body object true "Merge patch"
+// @Param If-Match header string false "Entity tag the tenant must still have"
+// @Success 200 {object} handlers.resultJSON
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 412 {object} problem.Problem
+// @Failure 415 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /tenants/{id} [patch]
+func (h HandlerTenant) Patch(c echo.Context) error {
+	tenantID, err := libUUID.Parse(c.Param("id"))
 	if err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return problem.BadRequest("invalid tenant id")
 	}
 
-	return c.JSON(http.StatusOK, resultJSON{
-		ID:   tenant.UUID,
-		Name: tenant.Name,
-	})
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != MIMEApplicationMergePatch && mediaType != echo.MIMEApplicationJSON {
+		return problem.UnsupportedMediaType("patch must be sent as " + MIMEApplicationMergePatch)
+	}
+
+	patch, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return problem.BadRequest(err.Error())
+	}
+
+	version, err := h.expectedVersion(c, tenantID)
+	if err != nil {
+		return versionConflict(c)
+	}
+
+	h.tenantModel.UUID = tenantID
+
+	tenant, err := h.tenantModel.WithContext(c.Request().Context()).GetOne()
+	if errors.Is(err, tenantModel.ErrNotFound) {
+		return problem.NotFound(err.Error())
+	}
+
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	// The patch was computed from this version, it must not change until written.
+	if version == 0 {
+		version = tenant.Version
+	}
+
+	document, err := json.Marshal(toTenantData(*tenant))
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	patchedDocument, err := applyMergePatch(document, patch)
+	if err != nil {
+		return problem.BadRequest("invalid merge patch: " + err.Error())
+	}
+
+	patched := new(tenantData)
+	if err := json.Unmarshal(patchedDocument, patched); err != nil {
+		return problem.BadRequest("invalid patched tenant: " + err.Error())
+	}
+
+	return h.replace(c, tenantID, patched, version)
+}
+
+// replace is used to validate the full tenant data and overwrite the stored tenant with it.
+func (h HandlerTenant) replace(c echo.Context, tenantID libUUID.UUID, data *tenantData, version uint) error {
+	if data.ID != tenantID.String() {
+		return problem.Validation("tenant id can't be changed", problem.FieldError{Field: "id", Rule: "immutable", Message: "must match the tenant id of the path"})
+	}
+
+	if err := c.Validate(data); err != nil {
+		return err
+	}
+
+	if err := validateTenantData(data); err != nil {
+		return err
+	}
+
+	h.tenantModel.UUID = tenantID
+	h.tenantModel.Version = version
+	applyTenantData(&h.tenantModel, data)
+
+	tenant, err := h.tenantModel.WithContext(c.Request().Context()).Replace()
+	if errors.Is(err, tenantModel.ErrNotFound) {
+		return problem.NotFound(err.Error())
+	}
+
+	if errors.Is(err, tenantModel.ErrVersionConflict) {
+		return versionConflict(c)
+	}
+
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	c.Response().Header().Set(HeaderETag, tenantETag(*tenant))
+	return c.JSON(http.StatusOK, toVersionedResult(c, *tenant))
 }
 
 // DeleteByID godoc
 // @Summary Delete tenant
-// @Description delete tenant by id
+// @Description delete tenant by id, the tenant is moved to the trash unless hard is set
 // @Tags tenants
 // @ID delete-tenant-by-id
 // @Produce  json
 // @Param id path string true "Tenant ID"
+// @Param hard query bool false "Permanently delete the tenant"
+// @Param If-Match header string false "Entity tag the tenant must still have"
 // @Success 200 {object} handlers.resultJSON
-// @Failure 404 {object} handlers.errorResult
+// @Failure 404 {object} problem.Problem
+// @Failure 412 {object} problem.Problem
 // @Router /tenants/{id} [delete]
 func (h HandlerTenant) DeleteByID(c echo.Context) error {
 	tenantID, err := libUUID.Parse(c.Param("id"))
 	if err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusNotFound, err.Error())
+		return problem.BadRequest("invalid tenant id")
+	}
+
+	version, err := h.expectedVersion(c, tenantID)
+	if err != nil {
+		return versionConflict(c)
 	}
 
 	h.tenantModel.UUID = tenantID
+	h.tenantModel.Version = version
+
+	var isDeleted bool
+	hard := c.QueryParam("hard") == "true"
+	if hard {
+		isDeleted, err = h.tenantModel.WithContext(c.Request().Context()).HardDelete()
+	} else {
+		isDeleted, err = h.tenantModel.WithContext(c.Request().Context()).Delete()
+	}
+
+	if errors.Is(err, tenantModel.ErrVersionConflict) {
+		return versionConflict(c)
+	}
 
-	isDeleted, err := h.tenantModel.Delete()
 	if err != nil {
-		c.Logger().Error(err.Error())
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return problem.Internal(err)
+	}
+
+	// Only a permanent deletion reports a missing tenant, a soft deletion answers false.
+	if !isDeleted && hard {
+		return problem.NotFound(tenantModel.ErrNotFound.Error())
 	}
 	return c.JSON(http.StatusOK, isDeleted)
 }
+
+// GetTrash godoc
+// @Summary List deleted tenants
+// @Description get tenants in the trash, waiting to be restored or purged
+// @Tags tenants
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} handlers.trashResultJSON
+// @Failure 500 {object} problem.Problem
+// @Router /tenants/trash [get]
+func (h HandlerTenant) GetTrash(c echo.Context) error {
+	tenants, err := h.tenantModel.WithContext(c.Request().Context()).GetTrash()
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	results := []trashResultJSON{}
+	for _, tenant := range *tenants {
+		results = append(results, trashResultJSON{ID: tenant.UUID, Name: tenant.Name, DeletedAt: tenant.DeletedAt.Time})
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+// Restore godoc
+// @Summary Restore a deleted tenant
+// @Description restore tenant by id from the trash
+// @Tags tenants
+// @ID restore-tenant-by-id
+// @Produce  json
+// @Param id path string true "Tenant ID"
+// @Param If-Match header string false "Entity tag the tenant must still have"
+// @Success 200 {object} handlers.resultJSON
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 412 {object} problem.Problem
+// @Router /tenants/{id}/restore [post]
+func (h HandlerTenant) Restore(c echo.Context) error {
+	tenantID, err := libUUID.Parse(c.Param("id"))
+	if err != nil {
+		return problem.BadRequest("invalid tenant id")
+	}
+
+	version, err := h.expectedVersion(c, tenantID)
+	if err != nil {
+		return versionConflict(c)
+	}
+
+	h.tenantModel.UUID = tenantID
+	h.tenantModel.Version = version
+
+	tenant, err := h.tenantModel.WithContext(c.Request().Context()).Restore()
+	if errors.Is(err, tenantModel.ErrNotInTrash) {
+		return problem.NotFound(err.Error())
+	}
+
+	if errors.Is(err, tenantModel.ErrVersionConflict) {
+		return versionConflict(c)
+	}
+
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	c.Response().Header().Set(HeaderETag, tenantETag(*tenant))
+	return c.JSON(http.StatusOK, toVersionedResult(c, *tenant))
+}
+
+// Suspend godoc
+// @Summary Suspend a tenant
+// @Description suspend tenant by id, blocking its API access
+// @Tags tenants
+// @ID suspend-tenant-by-id
+// @Produce  json
+// @Param id path string true "Tenant ID"
+// @Success 200 {object} handlers.resultJSON
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /tenants/{id}/suspend [post]
+func (h HandlerTenant) Suspend(c echo.Context) error {
+	return h.transition(c, (*tenantModel.ModelTenant).Suspend)
+}
+
+// Activate godoc
+// @Summary Activate a tenant
+// @Description activate tenant by id, after provisioning or a suspension
+// @Tags tenants
+// @ID activate-tenant-by-id
+// @Produce  json
+// @Param id path string true "Tenant ID"
+// @Success 200 {object} handlers.resultJSON
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /tenants/{id}/activate [post]
+func (h HandlerTenant) Activate(c echo.Context) error {
+	return h.transition(c, (*tenantModel.ModelTenant).Activate)
+}
+
+func (h HandlerTenant) transition(c echo.Context, move func(*tenantModel.ModelTenant) (*tenantModel.ModelTenant, error)) error {
+	tenantID, err := libUUID.Parse(c.Param("id"))
+	if err != nil {
+		return problem.BadRequest("invalid tenant id")
+	}
+
+	h.tenantModel.UUID = tenantID
+
+	tenant, err := move(h.tenantModel.WithContext(c.Request().Context()))
+	if errors.Is(err, tenantModel.ErrInvalidTransition) {
+		return problem.Conflict(err.Error())
+	}
+
+	if errors.Is(err, tenantModel.ErrNotFound) {
+		return problem.NotFound(err.Error())
+	}
+
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	c.Response().Header().Set(HeaderETag, tenantETag(*tenant))
+	return c.JSON(http.StatusOK, toVersionedResult(c, *tenant))
+}
+
+// CheckTenantStatus is a middleware denying API access to suspended or archived tenants: the tenant the request
+// is made for, named by the X-Tenant-ID header, and the tenant of a /tenants/:id route. Only the status changes
+// of the blocked tenant are let through, so it can be activated again.
+// The tenant of the header is checked against the database, and kept for the handlers as CurrentTenant.
+func (h HandlerTenant) CheckTenantStatus(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if rawTenantID := c.Request().Header.Get(HeaderTenantID); rawTenantID != "" {
+			logging.SetTenant(c, rawTenantID)
+
+			tenantID, err := libUUID.Parse(rawTenantID)
+			if err != nil {
+				return problem.BadRequest("invalid " + HeaderTenantID + " header")
+			}
+
+			tenant, err := checkTenantStatus(c, tenantID)
+			if errors.Is(err, tenantModel.ErrNotFound) {
+				return problem.Forbidden("unknown tenant")
+			}
+
+			if err != nil {
+				return err
+			}
+			c.Set(contextTenant, tenant)
+		}
+
+		if !strings.Contains(c.Path(), "/tenants/:id") {
+			return next(c)
+		}
+
+		// The invalid and unknown route tenants are answered by the handlers.
+		routeTenantID, err := libUUID.Parse(c.Param("id"))
+		if err != nil {
+			return next(c)
+		}
+
+		if current := CurrentTenant(c); current == nil || current.UUID != routeTenantID {
+			_, err = checkTenantStatus(c, routeTenantID)
+			if err != nil && !errors.Is(err, tenantModel.ErrNotFound) {
+				return err
+			}
+		}
+		return next(c)
+	}
+}
+
+// checkTenantStatus is used to get the tenant of tenantID, failing with a forbidden problem when it is blocked,
+// unless the request changes its status.
+func checkTenantStatus(c echo.Context, tenantID libUUID.UUID) (*tenantModel.ModelTenant, error) {
+	tenant := tenantModel.ModelTenant{UUID: tenantID}
+	found, err := tenant.WithContext(c.Request().Context()).GetOne()
+	if errors.Is(err, tenantModel.ErrNotFound) {
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, problem.Internal(err)
+	}
+
+	if found.Status.IsBlocked() && !isStatusChange(c, tenantID) {
+		return nil, problem.Forbidden("tenant is " + string(found.Status))
+	}
+	return found, nil
+}
+
+// isStatusChange is used to know if the request suspends or activates the tenant of tenantID.
+// The routes are served under each version group, /v1/tenants/:id/activate and so on.
+func isStatusChange(c echo.Context, tenantID libUUID.UUID) bool {
+	if c.Param("id") != tenantID.String() {
+		return false
+	}
+	return strings.HasSuffix(c.Path(), "/tenants/:id/suspend") || strings.HasSuffix(c.Path(), "/tenants/:id/activate")
+}
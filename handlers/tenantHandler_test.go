@@ -1,9 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/NeowayLabs/wabbit/amqptest/server"
-	"github.com/go-playground/validator/v10"
 	libUuid "github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -11,21 +11,29 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
 	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	auditModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
+	outboxModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/outbox"
 	tenantModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/tenant"
+	webhookModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/webhook"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
 	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/rabbitmq"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/validation"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/versioning"
 	"gorm.io/gorm"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
 	mockDBTenant              = tenantModel.ModelTenant{Name: ""}
 	createTenantString        = `{"id":"39b0b2fc-749f-46f3-8960-453418e72b2e","name":"NAME"}`
-	allTenantsString          = `[{"id":"39b0b2fc-749f-46f3-8960-453418e72b2e","name":"NAME"}]`
+	allTenantsString          = `[{"id":"39b0b2fc-749f-46f3-8960-453418e72b2e","name":"NAME","slug":"name","status":"active","plan":"free","settings":{}}]`
 	updatedTenantString       = `{"id":"39b0b2fc-749f-46f3-8960-453418e72b2e","name":"NAME2"}`
+	updatedTenantResultString = `{"id":"39b0b2fc-749f-46f3-8960-453418e72b2e","name":"NAME2","slug":"name2","status":"active","plan":"free","settings":{}}`
 	updatedWrongTenantString  = `{"id":"yolo","name":"NAME2"}`
 	updatedWrongTenantString2 = `{"id":"39b0b2fc-749f-46f3-8960-453418e72b2e","name":""}`
 	updatedWrongTenantString3 = `{"name":"TEST"}`
@@ -33,21 +41,23 @@ var (
 	validTenantID             = "39b0b2fc-749f-46f3-8960-453418e72b2e"
 )
 
-type (
-	CustomValidator struct {
-		validator *validator.Validate
-	}
-)
-
 var DbClient *gorm.DB
 var TaskManager *rabbitmq.TaskClient = nil
 var ZeroLogger zerolog.Logger
 
-func (cv *CustomValidator) Validate(i interface{}) error {
-	if err := cv.validator.Struct(i); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+func newValidator() *validation.Validator {
+	requestValidator, err := validation.New()
+	if err != nil {
+		panic(err)
+	}
+	return requestValidator
+}
+
+// handle is used to call a handler the way echo does, errors are answered by the error handler.
+func handle(c echo.Context, handler echo.HandlerFunc) {
+	if err := handler(c); err != nil {
+		problem.HTTPErrorHandler(err, c)
 	}
-	return nil
 }
 
 func TestMain(m *testing.M) {
@@ -80,7 +90,7 @@ func refreshTenantTable(t *testing.T) {
 		return
 	}
 
-	err = DbClient.AutoMigrate(&tenantModel.ModelTenant{})
+	err = DbClient.AutoMigrate(&tenantModel.ModelTenant{}, &auditModel.ModelAuditEntry{}, &outboxModel.ModelMessage{}, &webhookModel.ModelSubscription{}, &webhookModel.ModelDelivery{})
 	if err != nil {
 		t.Errorf("Error migrate tenants models: %v\n", err)
 		return
@@ -93,7 +103,8 @@ func TestCreateTenant(t *testing.T) {
 	refreshTenantTable(t)
 	e := echo.New()
 	e.Use(middleware.Logger())
-	e.Validator = &CustomValidator{validator: validator.New()}
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
 
 	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(createTenantString))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -103,12 +114,18 @@ func TestCreateTenant(t *testing.T) {
 	h := &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.Create(c)) {
-		assert.Equal(t, http.StatusCreated, rec.Code)
-		var response ResultTask
-		assert.NoError(t, json.Unmarshal([]byte(rec.Body.String()), &response))
-		assert.NotNil(t, response.TaskID)
-	}
+	handle(c, h.Create)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var response ResultTask
+	assert.NoError(t, json.Unmarshal([]byte(rec.Body.String()), &response))
+	assert.NotNil(t, response.TaskID)
+
+	// The tenant is saved in background, wait for it before the next requests.
+	assert.Eventually(t, func() bool {
+		tenant := tenantModel.ModelTenant{UUID: libUuid.MustParse(validTenantID)}
+		found, err := tenant.GetOne()
+		return err == nil && found.Status == tenantModel.StatusActive
+	}, time.Second, 10*time.Millisecond)
 
 	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(createWrongTenantString))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -118,10 +135,10 @@ func TestCreateTenant(t *testing.T) {
 	h = &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.Create(c)) {
-		assert.Equal(t, http.StatusInternalServerError, rec.Code)
-		assert.Equal(t, "\"code=400, message=Unmarshal type error: expected=string, got=number, field=name, offset=23, internal=json: cannot unmarshal number into Go struct field tenantData.name of type string\"\n", rec.Body.String())
-	}
+	handle(c, h.Create)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, problem.MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+	assert.JSONEq(t, `{"type":"/problems/bad-request","title":"Bad request","status":400,"detail":"Unmarshal type error: expected=string, got=number, field=name, offset=23","instance":"/"}`, rec.Body.String())
 
 	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(createTenantString))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -131,18 +148,23 @@ func TestCreateTenant(t *testing.T) {
 	h = &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.Create(c)) {
-		assert.Equal(t, http.StatusCreated, rec.Code)
-		var response ResultTask
-		assert.NoError(t, json.Unmarshal([]byte(rec.Body.String()), &response))
-		assert.NotNil(t, response.TaskID)
-	}
+	handle(c, h.Create)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	response = ResultTask{}
+	assert.NoError(t, json.Unmarshal([]byte(rec.Body.String()), &response))
+	assert.NotNil(t, response.TaskID)
+
+	// The duplicate fails in background, wait for it before the next tests rename the tenant.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, WaitBackgroundWork(ctx))
 }
 
 func TestGetTenant(t *testing.T) {
 	e := echo.New()
 	e.Use(middleware.Logger())
-	e.Validator = &CustomValidator{validator: validator.New()}
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	rec := httptest.NewRecorder()
@@ -155,9 +177,8 @@ func TestGetTenant(t *testing.T) {
 	var fakeId = libUuid.New().String()
 
 	// Assertions
-	if assert.NoError(t, h.GetOneByID(c)) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-	}
+	handle(c, h.GetOneByID)
+	assert.Equal(t, http.StatusOK, rec.Code)
 
 	req = httptest.NewRequest(http.MethodGet, "/", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -169,10 +190,9 @@ func TestGetTenant(t *testing.T) {
 	h = &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.GetOneByID(c)) {
-		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		assert.Equal(t, "\"invalid UUID length: 4\"\n", rec.Body.String())
-	}
+	handle(c, h.GetOneByID)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/bad-request","title":"Bad request","status":400,"detail":"invalid tenant id","instance":"/"}`, rec.Body.String())
 
 	req = httptest.NewRequest(http.MethodGet, "/", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -184,18 +204,18 @@ func TestGetTenant(t *testing.T) {
 	h = &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.GetOneByID(c)) {
-		ZeroLogger.Printf(fakeId)
-		ZeroLogger.Printf(rec.Body.String())
-		assert.Equal(t, http.StatusNotFound, rec.Code)
-		assert.Equal(t, "null\n", rec.Body.String())
-	}
+	handle(c, h.GetOneByID)
+	ZeroLogger.Print(fakeId)
+	ZeroLogger.Print(rec.Body.String())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/not-found","title":"Resource not found","status":404,"detail":"tenant not found in database","instance":"/"}`, rec.Body.String())
 }
 
 func TestGetAllTenants(t *testing.T) {
 	e := echo.New()
 	e.Use(middleware.Logger())
-	e.Validator = &CustomValidator{validator: validator.New()}
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
@@ -203,80 +223,209 @@ func TestGetAllTenants(t *testing.T) {
 	h := &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.GetAll(c)) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, allTenantsString+"\n", rec.Body.String())
-	}
+	handle(c, h.GetAll)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, allTenantsString+"\n", rec.Body.String())
+}
+
+func TestSearchTenants(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.Logger())
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	req := httptest.NewRequest(http.MethodGet, "/?q=am", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/tenants/search")
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+
+	// Assertions
+	handle(c, h.Search)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `[{"id":"39b0b2fc-749f-46f3-8960-453418e72b2e","name":"NAME","rank":0.5,"highlight":"N\u003cb\u003eAM\u003c/b\u003eE"}]`+"\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/?q=nothing", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetPath("/tenants/search")
+
+	// Assertions
+	handle(c, h.Search)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[]\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/?q=", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetPath("/tenants/search")
+
+	// Assertions
+	handle(c, h.Search)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/validation","title":"Validation failed","status":422,"detail":"missing search query","instance":"/","errors":[{"field":"q","rule":"required","message":"is required"}]}`, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/?q=am&limit=zero", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetPath("/tenants/search")
+
+	// Assertions
+	handle(c, h.Search)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
 }
 
 func TestUpdateTenant(t *testing.T) {
 	e := echo.New()
 	e.Use(middleware.Logger())
-	e.Validator = &CustomValidator{validator: validator.New()}
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
 	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(updatedTenantString))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
-	c.SetPath("/tenants")
+	c.SetPath("/tenants/:id")
+	c.SetParamNames("id")
+	c.SetParamValues(validTenantID)
 	h := &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.Update(c)) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, updatedTenantString+"\n", rec.Body.String())
-	}
+	handle(c, h.Update)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, updatedTenantResultString+"\n", rec.Body.String())
 
 	req = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(updatedWrongTenantString))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	rec = httptest.NewRecorder()
 	c = e.NewContext(req, rec)
-	c.SetPath("/tenants")
+	c.SetPath("/tenants/:id")
+	c.SetParamNames("id")
+	c.SetParamValues(validTenantID)
 	h = &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.Update(c)) {
-		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		assert.Equal(t, "\"code=500, message=Key: 'tenantData.ID' Error:Field validation for 'ID' failed on the 'uuid4' tag\"\n", rec.Body.String())
-	}
+	handle(c, h.Update)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/validation","title":"Validation failed","status":422,"detail":"tenant id can't be changed","instance":"/","errors":[{"field":"id","rule":"immutable","message":"must match the tenant id of the path"}]}`, rec.Body.String())
 
 	req = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(updatedWrongTenantString))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	rec = httptest.NewRecorder()
 	c = e.NewContext(req, rec)
-	c.SetPath("/tenants")
+	c.SetPath("/tenants/:id")
+	c.SetParamNames("id")
+	c.SetParamValues("yolo")
 	h = &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.Update(c)) {
-		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		assert.Equal(t, "\"code=500, message=Key: 'tenantData.ID' Error:Field validation for 'ID' failed on the 'uuid4' tag\"\n", rec.Body.String())
-	}
+	handle(c, h.Update)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/bad-request","title":"Bad request","status":400,"detail":"invalid tenant id","instance":"/"}`, rec.Body.String())
 
 	req = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(updatedWrongTenantString2))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	rec = httptest.NewRecorder()
 	c = e.NewContext(req, rec)
-	c.SetPath("/tenants")
+	c.SetPath("/tenants/:id")
+	c.SetParamNames("id")
+	c.SetParamValues(validTenantID)
 	h = &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.Update(c)) {
-		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		assert.Equal(t, "\"code=500, message=Key: 'tenantData.Name' Error:Field validation for 'Name' failed on the 'required' tag\"\n", rec.Body.String())
-	}
+	handle(c, h.Update)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/validation","title":"Validation failed","status":422,"detail":"the request has invalid fields","instance":"/","errors":[{"field":"name","rule":"required","message":"is required"}]}`, rec.Body.String())
 
 	req = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(updatedWrongTenantString3))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	rec = httptest.NewRecorder()
 	c = e.NewContext(req, rec)
-	c.SetPath("/tenants")
+	c.SetPath("/tenants/:id")
+	c.SetParamNames("id")
+	c.SetParamValues(libUuid.New().String())
 	h = &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.Update(c)) {
-		assert.Equal(t, http.StatusBadRequest, rec.Code)
-		assert.Equal(t, "\"code=500, message=Key: 'tenantData.ID' Error:Field validation for 'ID' failed on the 'required' tag\"\n", rec.Body.String())
-	}
+	handle(c, h.Update)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/not-found","title":"Resource not found","status":404,"detail":"tenant not found in database","instance":"/"}`, rec.Body.String())
+}
+
+func TestPatchTenant(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.Logger())
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+	e.PUT("/tenants/:id", h.Update)
+	e.PATCH("/tenants/:id", h.Patch)
+
+	req := httptest.NewRequest(http.MethodPatch, "/tenants/"+validTenantID, strings.NewReader(`{"contactEmail":"ops@name.test","settings":{"locale":"fr"}}`))
+	req.Header.Set(echo.HeaderContentType, MIMEApplicationMergePatch)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"id":"39b0b2fc-749f-46f3-8960-453418e72b2e","name":"NAME2","slug":"name2","status":"active","contactEmail":"ops@name.test","plan":"free","settings":{"locale":"fr"}}`+"\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodPatch, "/tenants/"+validTenantID, strings.NewReader(`{"contactEmail":null,"settings":{"locale":null}}`))
+	req.Header.Set(echo.HeaderContentType, MIMEApplicationMergePatch)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, updatedTenantResultString+"\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodPatch, "/tenants/"+validTenantID, strings.NewReader(`{"name":null}`))
+	req.Header.Set(echo.HeaderContentType, MIMEApplicationMergePatch)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), `{"field":"name","rule":"required","message":"is required"}`)
+
+	req = httptest.NewRequest(http.MethodPatch, "/tenants/"+validTenantID, strings.NewReader(`{"id":"`+libUuid.New().String()+`"}`))
+	req.Header.Set(echo.HeaderContentType, MIMEApplicationMergePatch)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"detail":"tenant id can't be changed"`)
+
+	req = httptest.NewRequest(http.MethodPatch, "/tenants/"+validTenantID, strings.NewReader(`[{"op":"remove","path":"/name"}]`))
+	req.Header.Set(echo.HeaderContentType, "application/json-patch+json")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPatch, "/tenants/"+libUuid.New().String(), strings.NewReader(`{"plan":"pro"}`))
+	req.Header.Set(echo.HeaderContentType, MIMEApplicationMergePatch)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// A full replacement resets the omitted fields.
+	req = httptest.NewRequest(http.MethodPatch, "/tenants/"+validTenantID, strings.NewReader(`{"plan":"pro"}`))
+	req.Header.Set(echo.HeaderContentType, MIMEApplicationMergePatch)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPut, "/tenants/"+validTenantID, strings.NewReader(`{"name":"NAME2"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, updatedTenantResultString+"\n", rec.Body.String())
 }
 
 func TestCreateHandler(t *testing.T) {
@@ -288,7 +437,8 @@ func TestCreateHandler(t *testing.T) {
 func TestDeleteTenant(t *testing.T) {
 	e := echo.New()
 	e.Use(middleware.Logger())
-	e.Validator = &CustomValidator{validator: validator.New()}
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
 	req := httptest.NewRequest(http.MethodDelete, "/", nil)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
@@ -298,10 +448,9 @@ func TestDeleteTenant(t *testing.T) {
 	h := &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.DeleteByID(c)) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, "true\n", rec.Body.String())
-	}
+	handle(c, h.DeleteByID)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true\n", rec.Body.String())
 
 	req = httptest.NewRequest(http.MethodDelete, "/", nil)
 	rec = httptest.NewRecorder()
@@ -312,10 +461,9 @@ func TestDeleteTenant(t *testing.T) {
 	h = &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.DeleteByID(c)) {
-		assert.Equal(t, http.StatusNotFound, rec.Code)
-		assert.Equal(t, "\"invalid UUID length: 4\"\n", rec.Body.String())
-	}
+	handle(c, h.DeleteByID)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/bad-request","title":"Bad request","status":400,"detail":"invalid tenant id","instance":"/"}`, rec.Body.String())
 
 	req = httptest.NewRequest(http.MethodDelete, "/", nil)
 	rec = httptest.NewRecorder()
@@ -326,16 +474,16 @@ func TestDeleteTenant(t *testing.T) {
 	h = &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.DeleteByID(c)) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, "false\n", rec.Body.String())
-	}
+	handle(c, h.DeleteByID)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "false\n", rec.Body.String())
 }
 
 func TestGetAllNoTenants(t *testing.T) {
 	e := echo.New()
 	e.Use(middleware.Logger())
-	e.Validator = &CustomValidator{validator: validator.New()}
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	rec := httptest.NewRecorder()
 	c := e.NewContext(req, rec)
@@ -343,8 +491,692 @@ func TestGetAllNoTenants(t *testing.T) {
 	h := &HandlerTenant{mockDBTenant, TaskManager}
 
 	// Assertions
-	if assert.NoError(t, h.GetAll(c)) {
-		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, "[]\n", rec.Body.String())
+	handle(c, h.GetAll)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[]\n", rec.Body.String())
+}
+
+func TestGetTrash(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.Logger())
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/tenants/trash")
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+
+	// Assertions
+	handle(c, h.GetTrash)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response []trashResultJSON
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	if assert.Len(t, response, 1) {
+		assert.Equal(t, validTenantID, response[0].ID.String())
+		assert.False(t, response[0].DeletedAt.IsZero())
 	}
 }
+
+func TestRestoreTenant(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.Logger())
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(HeaderIfMatch, `"99"`)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/tenants/:id/restore")
+	c.SetParamNames("id")
+	c.SetParamValues(validTenantID)
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+
+	// Assertions
+	handle(c, h.Restore)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetPath("/tenants/:id/restore")
+	c.SetParamNames("id")
+	c.SetParamValues(validTenantID)
+
+	// Assertions
+	handle(c, h.Restore)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, updatedTenantResultString+"\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetPath("/tenants/:id/restore")
+	c.SetParamNames("id")
+	c.SetParamValues(validTenantID)
+
+	// Assertions
+	handle(c, h.Restore)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/not-found","title":"Resource not found","status":404,"detail":"tenant not found in trash","instance":"/"}`, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetPath("/tenants/:id/restore")
+	c.SetParamNames("id")
+	c.SetParamValues("yolo")
+
+	// Assertions
+	handle(c, h.Restore)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/bad-request","title":"Bad request","status":400,"detail":"invalid tenant id","instance":"/"}`, rec.Body.String())
+}
+
+func TestHardDeleteTenant(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.Logger())
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	req := httptest.NewRequest(http.MethodDelete, "/?hard=true", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/tenants/:id")
+	c.SetParamNames("id")
+	c.SetParamValues(validTenantID)
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+
+	// Assertions
+	handle(c, h.DeleteByID)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetPath("/tenants/trash")
+
+	// Assertions
+	handle(c, h.GetTrash)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[]\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodDelete, "/?hard=true", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetPath("/tenants/:id")
+	c.SetParamNames("id")
+	c.SetParamValues(validTenantID)
+
+	// Assertions
+	handle(c, h.DeleteByID)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/not-found","title":"Resource not found","status":404,"detail":"tenant not found in database","instance":"/"}`, rec.Body.String())
+}
+
+func TestSuspendAndActivateTenant(t *testing.T) {
+	tenant := tenantModel.ModelTenant{Name: "Suspended Inc"}
+	_, err := tenant.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tenant.Activate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Use(middleware.Logger())
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+	e.Use(h.CheckTenantStatus)
+	e.GET("/tenants", h.GetAll)
+	e.GET("/tenants/:id", h.GetOneByID)
+	e.POST("/tenants/:id/suspend", h.Suspend)
+	e.POST("/tenants/:id/activate", h.Activate)
+
+	req := httptest.NewRequest(http.MethodPost, "/tenants/"+tenant.UUID.String()+"/suspend", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"suspended"`)
+
+	req = httptest.NewRequest(http.MethodPost, "/tenants/"+tenant.UUID.String()+"/suspend", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":409,"detail":"invalid tenant status transition: from suspended to suspended"`)
+
+	req = httptest.NewRequest(http.MethodGet, "/tenants", nil)
+	req.Header.Set(HeaderTenantID, tenant.UUID.String())
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/forbidden","title":"Forbidden","status":403,"detail":"tenant is suspended","instance":"/tenants"}`, rec.Body.String())
+
+	// The tenant of the route is checked too, without the header.
+	req = httptest.NewRequest(http.MethodGet, "/tenants/"+tenant.UUID.String(), nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"detail":"tenant is suspended"`)
+
+	req = httptest.NewRequest(http.MethodPost, "/tenants/"+tenant.UUID.String()+"/activate", nil)
+	req.Header.Set(HeaderTenantID, tenant.UUID.String())
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"active"`)
+
+	req = httptest.NewRequest(http.MethodGet, "/tenants", nil)
+	req.Header.Set(HeaderTenantID, tenant.UUID.String())
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/tenants/"+tenant.UUID.String(), nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/tenants/"+libUuid.New().String()+"/activate", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestActivateSuspendedTenantByVersion(t *testing.T) {
+	e := echo.New()
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+	e.Use(h.CheckTenantStatus)
+	for _, version := range []string{VersionV1, VersionV2} {
+		group := versioning.Group(e, versioning.Version{Name: version})
+		group.POST("/tenants/:id/suspend", h.Suspend)
+		group.POST("/tenants/:id/activate", h.Activate)
+	}
+
+	for _, version := range []string{VersionV1, VersionV2} {
+		tenant := tenantModel.ModelTenant{Name: "Reactivated " + version}
+		_, err := tenant.Save()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tenant.Activate()
+		if err == nil {
+			_, err = tenant.Suspend()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/"+version+"/tenants/"+tenant.UUID.String()+"/activate", nil)
+		req.Header.Set(HeaderTenantID, tenant.UUID.String())
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		// Assertions
+		assert.Equal(t, http.StatusOK, rec.Code, version)
+		assert.Contains(t, rec.Body.String(), `"status":"active"`, version)
+	}
+}
+
+func TestCreateTenantTranslatedErrors(t *testing.T) {
+	requestValidator := newValidator()
+	e := echo.New()
+	e.Validator = requestValidator
+	e.HTTPErrorHandler = problem.NewHTTPErrorHandler(requestValidator.Translate)
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+	e.POST("/tenants", h.Create)
+
+	req := httptest.NewRequest(http.MethodPost, "/tenants", strings.NewReader(`{"id":"`+libUuid.New().String()+`","name":"Admin","plan":"gold"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Accept-Language", "fr-FR,fr;q=0.9,en;q=0.5")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/validation","title":"Validation failed","status":422,"detail":"the request has invalid fields","instance":"/tenants","errors":[
+		{"field":"name","rule":"notreserved","message":"name est un nom réservé"},
+		{"field":"plan","rule":"oneof","param":"free pro enterprise","message":"plan doit être l'un des choix suivants [free pro enterprise]"}
+	]}`, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/tenants", strings.NewReader(`{"id":"`+libUuid.New().String()+`","name":"#1 tenant"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), `{"field":"name","rule":"tenantname","message":"name must be 2 to 100 letters, digits, spaces or . ' \u0026 - characters, starting with a letter or digit"}`)
+}
+
+func TestCreateTenantWithMetadata(t *testing.T) {
+	e := echo.New()
+	e.Use(middleware.Logger())
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":"`+libUuid.New().String()+`","name":"Meta","plan":"gold"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/tenants")
+
+	// Assertions
+	handle(c, h.Create)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), `{"field":"plan","rule":"oneof","param":"free pro enterprise","message":"must be one of: free, pro, enterprise"}`)
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":"`+libUuid.New().String()+`","name":"Meta","settings":{"maxUsers":"many"}}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetPath("/tenants")
+
+	// Assertions
+	handle(c, h.Create)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), `{"field":"settings","rule":"schema","message":"setting \"maxUsers\" must be of type number, got string"}`)
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":"`+libUuid.New().String()+`","name":"Meta","slug":"Not A Slug"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetPath("/tenants")
+
+	// Assertions
+	handle(c, h.Create)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+}
+
+func TestTenantETags(t *testing.T) {
+	tenant := tenantModel.ModelTenant{Name: "Tagged"}
+	_, err := tenant.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenantURL := "/tenants/" + tenant.UUID.String()
+
+	e := echo.New()
+	e.Use(middleware.Logger())
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+	e.GET("/tenants", h.GetAll)
+	e.GET("/tenants/:id", h.GetOneByID)
+	e.PUT("/tenants/:id", h.Update)
+	e.PATCH("/tenants/:id", h.Patch)
+	e.DELETE("/tenants/:id", h.DeleteByID)
+
+	req := httptest.NewRequest(http.MethodGet, tenantURL, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"1"`, rec.Header().Get(HeaderETag))
+
+	req = httptest.NewRequest(http.MethodGet, tenantURL, nil)
+	req.Header.Set(HeaderIfNoneMatch, `W/"1"`)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/tenants", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	listETag := rec.Header().Get(HeaderETag)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, listETag)
+
+	req = httptest.NewRequest(http.MethodGet, "/tenants", nil)
+	req.Header.Set(HeaderIfNoneMatch, listETag)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPut, tenantURL, strings.NewReader(`{"name":"Tagged2"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(HeaderIfMatch, `"1"`)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"2"`, rec.Header().Get(HeaderETag))
+
+	req = httptest.NewRequest(http.MethodPatch, tenantURL, strings.NewReader(`{"name":"Tagged3"}`))
+	req.Header.Set(echo.HeaderContentType, MIMEApplicationMergePatch)
+	req.Header.Set(HeaderIfMatch, `"1"`)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"type":"/problems/precondition-failed"`)
+
+	req = httptest.NewRequest(http.MethodPatch, tenantURL, strings.NewReader(`{"name":"Tagged3"}`))
+	req.Header.Set(echo.HeaderContentType, MIMEApplicationMergePatch)
+	req.Header.Set(HeaderIfMatch, `"1", "2"`)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"3"`, rec.Header().Get(HeaderETag))
+
+	req = httptest.NewRequest(http.MethodDelete, tenantURL, nil)
+	req.Header.Set(HeaderIfMatch, `W/"3"`)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, tenantURL, nil)
+	req.Header.Set(HeaderIfMatch, `"3"`)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true\n", rec.Body.String())
+}
+
+func TestBatchTenants(t *testing.T) {
+	refreshTenantTable(t)
+
+	existingTenant := tenantModel.ModelTenant{Name: "Existing", UUID: libUuid.MustParse(validTenantID)}
+	_, err := existingTenant.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+	e.POST("/tenants\\:batch", h.Batch)
+
+	batch := `{"operations":[
+		{"action":"create","tenant":{"id":"b4c7e3f2-43c4-4d41-9b4f-4f2f0f4b8c11","name":"Batched"}},
+		{"action":"update","id":"` + validTenantID + `","tenant":{"name":"Existing2"}},
+		{"action":"delete","id":"6a0f9a8e-36f5-4d6e-8d3b-3d0a0c9c6e01"}
+	]}`
+	req := httptest.NewRequest(http.MethodPost, "/tenants:batch", strings.NewReader(batch))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), "taskId")
+
+	assert.Eventually(t, func() bool {
+		tenant, err := (&tenantModel.ModelTenant{UUID: libUuid.MustParse(validTenantID)}).GetOne()
+		return err == nil && tenant.Name == "Existing2"
+	}, time.Second, 10*time.Millisecond)
+
+	created, err := (&tenantModel.ModelTenant{UUID: libUuid.MustParse("b4c7e3f2-43c4-4d41-9b4f-4f2f0f4b8c11")}).GetOne()
+	if assert.NoError(t, err) {
+		assert.Equal(t, tenantModel.StatusActive, created.Status)
+	}
+
+	// The deleted tenant doesn't exist, the transactional batch must not keep the create.
+	batch = `{"transactional":true,"operations":[
+		{"action":"create","tenant":{"id":"0d5b8d7c-2d7e-4f0e-a1c4-7a2f5c0f8e22","name":"Rolledback"}},
+		{"action":"delete","id":"6a0f9a8e-36f5-4d6e-8d3b-3d0a0c9c6e01"}
+	]}`
+	req = httptest.NewRequest(http.MethodPost, "/tenants:batch", strings.NewReader(batch))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Never(t, func() bool {
+		_, err := (&tenantModel.ModelTenant{UUID: libUuid.MustParse("0d5b8d7c-2d7e-4f0e-a1c4-7a2f5c0f8e22")}).GetOne()
+		return err == nil
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	invalidBatches := []string{
+		`{"operations":[]}`,
+		`{"operations":[{"action":"rename","id":"` + validTenantID + `"}]}`,
+		`{"operations":[{"action":"delete"}]}`,
+		`{"operations":[{"action":"create"}]}`,
+		`{"operations":[{"action":"update","id":"` + validTenantID + `","tenant":{"id":"b4c7e3f2-43c4-4d41-9b4f-4f2f0f4b8c11","name":"Other"}}]}`,
+	}
+
+	for _, invalidBatch := range invalidBatches {
+		req = httptest.NewRequest(http.MethodPost, "/tenants:batch", strings.NewReader(invalidBatch))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		// Assertions
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, invalidBatch)
+	}
+}
+
+func TestExportAndImportTenants(t *testing.T) {
+	refreshTenantTable(t)
+
+	tenant := tenantModel.ModelTenant{Name: "Exported", UUID: libUuid.MustParse(validTenantID), Settings: tenantModel.Settings{"locale": "fr"}}
+	_, err := tenant.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+	e.GET("/tenants/export", h.Export)
+	e.POST("/tenants/import", h.Import)
+
+	req := httptest.NewRequest(http.MethodGet, "/tenants/export?format=csv", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "id,name,slug,status,contactEmail,plan,settings\n"+
+		validTenantID+`,Exported,exported,provisioning,,free,"{""locale"":""fr""}"`+"\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/tenants/export", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, MIMEApplicationNDJSON, rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, `{"id":"`+validTenantID+`","name":"Exported","slug":"exported","status":"provisioning","plan":"free","settings":{"locale":"fr"}}`+"\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/tenants/export?format=xml", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	imported := "id,name,plan\n" +
+		"b4c7e3f2-43c4-4d41-9b4f-4f2f0f4b8c11,Imported,pro\n" +
+		validTenantID + ",Renamed,free\n" +
+		"yolo,Invalid,free\n"
+	req = httptest.NewRequest(http.MethodPost, "/tenants/import?onConflict=overwrite&dryRun=true", strings.NewReader(imported))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Never(t, func() bool {
+		_, err := (&tenantModel.ModelTenant{UUID: libUuid.MustParse("b4c7e3f2-43c4-4d41-9b4f-4f2f0f4b8c11")}).GetOne()
+		return err == nil
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	req = httptest.NewRequest(http.MethodPost, "/tenants/import?onConflict=overwrite", strings.NewReader(imported))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Eventually(t, func() bool {
+		tenant, err := (&tenantModel.ModelTenant{UUID: libUuid.MustParse(validTenantID)}).GetOne()
+		return err == nil && tenant.Name == "Renamed"
+	}, time.Second, 10*time.Millisecond)
+
+	created, err := (&tenantModel.ModelTenant{UUID: libUuid.MustParse("b4c7e3f2-43c4-4d41-9b4f-4f2f0f4b8c11")}).GetOne()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "pro", created.Plan)
+		assert.Equal(t, tenantModel.StatusActive, created.Status)
+	}
+
+	importedNDJSON := `{"id":"0d5b8d7c-2d7e-4f0e-a1c4-7a2f5c0f8e22","name":"Suspended","status":"suspended"}` + "\n\n" + `{"id":` + "\n"
+	req = httptest.NewRequest(http.MethodPost, "/tenants/import", strings.NewReader(importedNDJSON))
+	req.Header.Set(echo.HeaderContentType, MIMEApplicationNDJSON)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Eventually(t, func() bool {
+		tenant, err := (&tenantModel.ModelTenant{UUID: libUuid.MustParse("0d5b8d7c-2d7e-4f0e-a1c4-7a2f5c0f8e22")}).GetOne()
+		return err == nil && tenant.Status == tenantModel.StatusSuspended
+	}, time.Second, 10*time.Millisecond)
+
+	invalidImports := []struct {
+		query       string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"", echo.MIMEApplicationJSON, "[]", http.StatusUnsupportedMediaType},
+		{"?onConflict=merge", "text/csv", imported, http.StatusUnprocessableEntity},
+		{"", "text/csv", "id,name,color\n", http.StatusBadRequest},
+		{"", "text/csv", "name\n", http.StatusBadRequest},
+		{"", MIMEApplicationNDJSON, "\n", http.StatusUnprocessableEntity},
+		{"", MIMEApplicationNDJSON, strings.Repeat("{}\n", maxImportRows+1), http.StatusUnprocessableEntity},
+		{"", "text/csv", "id,name\n" + validTenantID + ",\"" + strings.Repeat("a", maxImportBytes), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, invalidImport := range invalidImports {
+		req = httptest.NewRequest(http.MethodPost, "/tenants/import"+invalidImport.query, strings.NewReader(invalidImport.body))
+		req.Header.Set(echo.HeaderContentType, invalidImport.contentType)
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		// Assertions
+		assert.Equal(t, invalidImport.code, rec.Code, invalidImport.body)
+	}
+}
+
+func TestDecodeImportRows(t *testing.T) {
+	rows, err := decodeCSV(strings.NewReader("id,name,settings\n"+
+		validTenantID+",Good,\"{\"\"locale\"\":\"\"fr\"\"}\"\n"+
+		validTenantID+",Bad,{\n"+
+		validTenantID+"\n"), maxImportRows)
+	if assert.NoError(t, err) && assert.Len(t, rows, 3) {
+		assert.Equal(t, 2, rows[0].Line)
+		assert.NoError(t, rows[0].Err)
+		assert.Equal(t, "fr", rows[0].Record.Settings["locale"])
+		assert.Equal(t, 3, rows[1].Line)
+		assert.Error(t, rows[1].Err)
+		assert.Equal(t, 4, rows[2].Line)
+		assert.Error(t, rows[2].Err)
+	}
+
+	rows, err = decodeNDJSON(strings.NewReader(`{"id":"`+validTenantID+`","name":"Good"}`+"\n\nnot json\n"), maxImportRows)
+	if assert.NoError(t, err) && assert.Len(t, rows, 2) {
+		assert.Equal(t, 1, rows[0].Line)
+		assert.Equal(t, "Good", rows[0].Record.Name)
+		assert.Equal(t, 3, rows[1].Line)
+		assert.Error(t, rows[1].Err)
+	}
+
+	// Decoding stops at the first row over the limit, blank lines aren't rows.
+	rows, err = decodeCSV(strings.NewReader("id,name\n"+validTenantID+",First\n"+validTenantID+",\"Second\n"), 1)
+	assert.ErrorIs(t, err, errTooManyRows)
+	assert.Nil(t, rows)
+
+	rows, err = decodeNDJSON(strings.NewReader("{}\n\n{}\n"), 1)
+	assert.ErrorIs(t, err, errTooManyRows)
+	assert.Nil(t, rows)
+
+	rows, err = decodeNDJSON(strings.NewReader("{}\n\n"), 1)
+	if assert.NoError(t, err) {
+		assert.Len(t, rows, 1)
+	}
+}
+
+func TestVersionedTenants(t *testing.T) {
+	refreshTenantTable(t)
+
+	tenant := tenantModel.ModelTenant{Name: "Versioned", UUID: libUuid.MustParse(validTenantID)}
+	_, err := tenant.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	h := &HandlerTenant{mockDBTenant, TaskManager}
+	deprecation := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	versioning.Group(e, versioning.Version{Name: VersionV1, Deprecation: deprecation, Successor: VersionV2}).GET("/tenants/:id", h.GetOneByID)
+	versioning.Group(e, versioning.Version{Name: VersionV2}).GET("/tenants/:id", h.GetOneByID)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/tenants/"+validTenantID, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"`+validTenantID+`","name":"Versioned","slug":"versioned","status":"provisioning","plan":"free","settings":{}}`, rec.Body.String())
+	assert.Equal(t, "@1792368000", rec.Header().Get(versioning.HeaderDeprecation))
+	assert.Equal(t, `</v2/tenants/`+validTenantID+`>; rel="successor-version"`, rec.Header().Get(versioning.HeaderLink))
+
+	req = httptest.NewRequest(http.MethodGet, "/v2/tenants/"+validTenantID, nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var result resultJSONV2
+	err = json.Unmarshal(rec.Body.Bytes(), &result)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, err)
+	assert.Equal(t, "Versioned", result.Name)
+	assert.Equal(t, uint(1), result.Version)
+	assert.False(t, result.CreatedAt.IsZero())
+	assert.Contains(t, rec.Body.String(), `"updatedAt"`)
+	assert.Empty(t, rec.Header().Get(versioning.HeaderDeprecation))
+}
@@ -0,0 +1,452 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	libUUID "github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	tenantModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/tenant"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/rabbitmq"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/requestid"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	formatCSV          = "csv"
+	formatNDJSON       = "ndjson"
+	exportBatchSize    = 100
+	maxImportRows      = 10000
+	maxImportLineBytes = 1024 * 1024
+	maxImportBytes     = 32 * 1024 * 1024
+)
+
+// errTooManyRows is returned by the decoders when the import has more than maxImportRows rows.
+var errTooManyRows = errors.New("an import can't have more than " + strconv.Itoa(maxImportRows) + " rows")
+
+// MIMEApplicationNDJSON is the media type of newline delimited JSON, one tenant per line.
+const MIMEApplicationNDJSON = "application/x-ndjson"
+
+// transferColumns are the CSV columns, named as the JSON fields.
+var transferColumns = []string{"id", "name", "slug", "status", "contactEmail", "plan", "settings"}
+
+type (
+	// transferRecord is a tenant as written by the export and read by the import.
+	transferRecord struct {
+		tenantData
+		Status string `json:"status,omitempty" validate:"omitempty,oneof=provisioning active suspended archived"`
+	}
+
+	// transferRow is a decoded import row, Err is set when the row can't be imported.
+	transferRow struct {
+		Line   int
+		Record transferRecord
+		Err    error
+	}
+
+	// importReport is the import outcome, reported in the task result.
+	importReport struct {
+		DryRun  bool              `json:"dryRun"`
+		Created int               `json:"created"`
+		Updated int               `json:"updated"`
+		Skipped int               `json:"skipped"`
+		Failed  int               `json:"failed"`
+		Rows    []importRowResult `json:"rows"`
+	}
+
+	importRowResult struct {
+		Line    int    `json:"line"`
+		ID      string `json:"id,omitempty"`
+		Outcome string `json:"outcome"`
+		Error   string `json:"error,omitempty"`
+	}
+)
+
+// Export godoc
+// @Summary Export tenants
+// @Description stream all the tenants as CSV or newline delimited JSON, in the format read by the import
+// @Tags tenants
+// @Produce  text/csv
+// @Produce  application/x-ndjson
+// @Param format query string false "csv or ndjson, ndjson by default"
+// @Success 200 {array} handlers.resultJSON
+// @Failure 400 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Router /tenants/export [get]
+func (h HandlerTenant) Export(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = formatNDJSON
+	}
+
+	response := c.Response()
+	var writeTenants func(tenants []tenantModel.ModelTenant) error
+
+	switch format {
+	case formatCSV:
+		writer := csv.NewWriter(response)
+		writeTenants = func(tenants []tenantModel.ModelTenant) error {
+			for _, tenant := range tenants {
+				row, err := toCSVRow(tenant)
+				if err != nil {
+					return err
+				}
+
+				if err := writer.Write(row); err != nil {
+					return err
+				}
+			}
+
+			writer.Flush()
+			return writer.Error()
+		}
+
+		response.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		response.Header().Set(echo.HeaderContentDisposition, `attachment; filename="tenants.csv"`)
+		response.WriteHeader(http.StatusOK)
+
+		if err := writer.Write(transferColumns); err != nil {
+			return err
+		}
+		writer.Flush()
+	case formatNDJSON:
+		encoder := json.NewEncoder(response)
+		writeTenants = func(tenants []tenantModel.ModelTenant) error {
+			for _, tenant := range tenants {
+				if err := encoder.Encode(toVersionedResult(c, tenant)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		response.Header().Set(echo.HeaderContentType, MIMEApplicationNDJSON)
+		response.Header().Set(echo.HeaderContentDisposition, `attachment; filename="tenants.ndjson"`)
+		response.WriteHeader(http.StatusOK)
+	default:
+		return problem.Validation("format must be csv or ndjson", problem.FieldError{Field: "format", Rule: "oneof", Message: "must be one of: csv, ndjson"})
+	}
+
+	err := h.tenantModel.WithContext(c.Request().Context()).EachInBatches(exportBatchSize, func(tenants []tenantModel.ModelTenant) error {
+		if err := writeTenants(tenants); err != nil {
+			return err
+		}
+
+		response.Flush()
+		return nil
+	})
+	if err != nil {
+		// The status is already sent, the truncated body is all the client gets.
+		c.Logger().Error(err.Error())
+	}
+
+	return nil
+}
+
+// Import godoc
+// @Summary Import tenants
+// @Description import tenants from CSV or newline delimited JSON as a background task, the report of every row is the task result.
+// @Description Tenants are matched by id or name, onConflict decides what happens to the existing ones.
+// @Tags tenants
+// @Accept  text/csv
+// @Accept  application/x-ndjson
+// @Produce  json
+// @Param format query string false "csv or ndjson, guessed from the content type by default"
+// @Param onConflict query string false "skip, overwrite or fail, skip by default"
+// @Param dryRun query bool false "Report what the import would do without writing anything"
+// @Param Idempotency-Key header string false "Key making retries return the first response"
+// @Success 201 {object} handlers.ResultTask
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 413 {object} problem.Problem
+// @Failure 415 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /tenants/import [post]
+func (h HandlerTenant) Import(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+		switch mediaType {
+		case "text/csv":
+			format = formatCSV
+		case MIMEApplicationNDJSON:
+			format = formatNDJSON
+		default:
+			return problem.UnsupportedMediaType("import must be sent as text/csv or " + MIMEApplicationNDJSON)
+		}
+	}
+
+	strategy := tenantModel.ConflictStrategy(c.QueryParam("onConflict"))
+	switch strategy {
+	case "":
+		strategy = tenantModel.ConflictSkip
+	case tenantModel.ConflictSkip, tenantModel.ConflictOverwrite, tenantModel.ConflictFail:
+	default:
+		return problem.Validation("onConflict must be skip, overwrite or fail", problem.FieldError{Field: "onConflict", Rule: "oneof", Message: "must be one of: skip, overwrite, fail"})
+	}
+
+	dryRun := c.QueryParam("dryRun") == "true"
+
+	// The rows are decoded as they are read, an oversized import is rejected without reading all of it.
+	body := http.MaxBytesReader(c.Response(), c.Request().Body, maxImportBytes)
+
+	var rows []transferRow
+	var err error
+	switch format {
+	case formatCSV:
+		rows, err = decodeCSV(body, maxImportRows)
+	case formatNDJSON:
+		rows, err = decodeNDJSON(body, maxImportRows)
+	default:
+		return problem.Validation("format must be csv or ndjson", problem.FieldError{Field: "format", Rule: "oneof", Message: "must be one of: csv, ndjson"})
+	}
+
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "an import can't be larger than "+strconv.Itoa(maxImportBytes/(1024*1024))+" MiB")
+	}
+
+	if errors.Is(err, errTooManyRows) {
+		return problem.Validation(err.Error())
+	}
+
+	if err != nil {
+		return problem.BadRequest(err.Error())
+	}
+
+	if len(rows) == 0 {
+		return problem.Validation("nothing to import")
+	}
+
+	var tenants []tenantModel.ModelTenant
+	var tenantRows []int
+	for i := range rows {
+		if rows[i].Err == nil {
+			rows[i].Err = validateTransferRecord(c, &rows[i].Record)
+		}
+
+		if rows[i].Err != nil {
+			continue
+		}
+
+		tenant := tenantModel.ModelTenant{
+			UUID:   libUUID.MustParse(rows[i].Record.ID),
+			Status: tenantModel.Status(rows[i].Record.Status),
+		}
+		applyTenantData(&tenant, &rows[i].Record.tenantData)
+		tenants = append(tenants, tenant)
+		tenantRows = append(tenantRows, i)
+	}
+
+	task := rabbitmq.CreateNewTask([]string{"import", "tenant"}, "Importing "+strconv.Itoa(len(rows))+" tenants", requestid.Get(c))
+	err = h.taskManager.PushTask(c.Request().Context(), task)
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	// Progress events are published right away, while the import runs in its transaction.
+	logger := c.Logger()
+	h.runTask(c, &task, func(ctx context.Context) error {
+		results, err := tenantModel.Import(ctx, tenants, strategy, dryRun, func(done int) {
+			err := h.taskManager.UpdateTaskProgress(ctx, task, float32(done)/float32(len(tenants)))
+			if err != nil {
+				logger.Error(err.Error())
+			}
+		})
+
+		report := importReport{DryRun: dryRun, Rows: make([]importRowResult, len(rows))}
+		for i, row := range rows {
+			report.Rows[i] = importRowResult{Line: row.Line, ID: row.Record.ID, Outcome: string(tenantModel.ImportFailed)}
+			if row.Err != nil {
+				report.Rows[i].Error = rowError(row.Err)
+			}
+		}
+
+		for i, result := range results {
+			rowResult := &report.Rows[tenantRows[i]]
+			rowResult.Outcome = string(result.Outcome)
+			if result.Err != nil {
+				rowResult.Error = result.Err.Error()
+			}
+		}
+
+		for _, rowResult := range report.Rows {
+			switch tenantModel.ImportOutcome(rowResult.Outcome) {
+			case tenantModel.ImportCreated:
+				report.Created++
+			case tenantModel.ImportUpdated:
+				report.Updated++
+			case tenantModel.ImportSkipped:
+				report.Skipped++
+			default:
+				report.Failed++
+			}
+		}
+
+		task.Progress = 1
+		task.Result = report
+		return err
+	})
+
+	return c.JSON(http.StatusCreated, ResultTask{
+		TaskID: task.ID,
+	})
+}
+
+// validateTransferRecord is used to run the same checks as on creation on an imported row.
+func validateTransferRecord(c echo.Context, record *transferRecord) error {
+	if err := c.Validate(record); err != nil {
+		return err
+	}
+
+	return validateTenantData(&record.tenantData)
+}
+
+// rowError is used to describe why a row can't be imported, listing the invalid fields if any.
+func rowError(err error) string {
+	fields := problem.Fields(err, "")
+	if len(fields) == 0 {
+		return err.Error()
+	}
+
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field.Field + " " + field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// toCSVRow is used to write a tenant in the order of transferColumns.
+func toCSVRow(tenant tenantModel.ModelTenant) ([]string, error) {
+	settings := ""
+	if len(tenant.Settings) > 0 {
+		document, err := json.Marshal(tenant.Settings)
+		if err != nil {
+			return nil, err
+		}
+		settings = string(document)
+	}
+
+	return []string{
+		tenant.UUID.String(),
+		tenant.Name,
+		tenant.Slug,
+		string(tenant.Status),
+		tenant.ContactEmail,
+		tenant.Plan,
+		settings,
+	}, nil
+}
+
+// decodeCSV is used to read the import rows, the header names the columns.
+// Malformed rows are kept with their error, only an unusable header or more than maxRows rows fail the whole file.
+func decodeCSV(body io.Reader, maxRows int) ([]transferRow, error) {
+	reader := csv.NewReader(body)
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if !slices.Contains(transferColumns, column) {
+			return nil, fmt.Errorf("unknown csv column: %s", column)
+		}
+		columns[column] = i
+	}
+
+	for _, column := range []string{"id", "name"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("missing csv column: %s", column)
+		}
+	}
+
+	var rows []transferRow
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		if len(rows) == maxRows {
+			return nil, errTooManyRows
+		}
+
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			rows = append(rows, transferRow{Line: parseError.StartLine, Err: parseError.Err})
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := transferRow{Line: line}
+		field := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+
+		row.Record.ID = field("id")
+		row.Record.Name = field("name")
+		row.Record.Slug = field("slug")
+		row.Record.Status = field("status")
+		row.Record.ContactEmail = field("contactEmail")
+		row.Record.Plan = field("plan")
+		if settings := field("settings"); settings != "" {
+			if err := json.Unmarshal([]byte(settings), &row.Record.Settings); err != nil {
+				row.Err = fmt.Errorf("invalid settings: %w", err)
+			}
+		}
+
+		rows = append(rows, row)
+	}
+}
+
+// decodeNDJSON is used to read the import rows, one JSON tenant per line, blank lines are ignored.
+// More than maxRows rows fail the whole file.
+func decodeNDJSON(body io.Reader, maxRows int) ([]transferRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+
+	var rows []transferRow
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		if len(rows) == maxRows {
+			return nil, errTooManyRows
+		}
+
+		row := transferRow{Line: line}
+		if err := json.Unmarshal(scanner.Bytes(), &row.Record); err != nil {
+			row.Err = fmt.Errorf("invalid json: %w", err)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
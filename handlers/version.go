@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	libUUID "github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	tenantModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/tenant"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/versioning"
+	"time"
+)
+
+const (
+	// VersionV1 is the first version of the API, tenants are represented by resultJSON.
+	VersionV1 = "v1"
+	// VersionV2 adds the version and the timestamps of the tenants to their representation.
+	VersionV2 = "v2"
+)
+
+// resultJSONV2 is the tenant representation of the v2 API.
+type resultJSONV2 struct {
+	ID           libUUID.UUID           `json:"id" validate:"required"`
+	Name         string                 `json:"name" validate:"required"`
+	Slug         string                 `json:"slug"`
+	Status       string                 `json:"status"`
+	ContactEmail string                 `json:"contactEmail,omitempty"`
+	Plan         string                 `json:"plan"`
+	Settings     map[string]interface{} `json:"settings"`
+	Version      uint                   `json:"version"`
+	CreatedAt    time.Time              `json:"createdAt"`
+	UpdatedAt    time.Time              `json:"updatedAt"`
+}
+
+func toResultJSONV2(tenant tenantModel.ModelTenant) resultJSONV2 {
+	result := toResultJSON(tenant)
+	return resultJSONV2{
+		ID:           result.ID,
+		Name:         result.Name,
+		Slug:         result.Slug,
+		Status:       result.Status,
+		ContactEmail: result.ContactEmail,
+		Plan:         result.Plan,
+		Settings:     result.Settings,
+		Version:      tenant.Version,
+		CreatedAt:    tenant.CreatedAt,
+		UpdatedAt:    tenant.UpdatedAt,
+	}
+}
+
+// toVersionedResult is used to represent a tenant as expected by the API version of the request.
+// Requests outside the versioned route groups get the v1 representation.
+func toVersionedResult(c echo.Context, tenant tenantModel.ModelTenant) interface{} {
+	if versioning.FromContext(c) == VersionV2 {
+		return toResultJSONV2(tenant)
+	}
+	return toResultJSON(tenant)
+}
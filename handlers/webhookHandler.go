@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	libUUID "github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	webhookModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/webhook"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/webhook"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+// webhookEvents are the events a subscription can filter on, along with "*" and the "tenant.*" and "task.*" prefixes.
+var webhookEvents = []string{
+	webhookModel.EventTenantCreated,
+	webhookModel.EventTenantUpdated,
+	webhookModel.EventTenantDeleted,
+	webhookModel.EventTenantRestored,
+	webhookModel.EventTenantPurged,
+	webhookModel.EventTaskCompleted,
+	webhookModel.EventTaskFailed,
+}
+
+type (
+	// HandlerWebhook serves the webhook subscriptions and their delivery log.
+	HandlerWebhook struct {
+		subscriptionModel webhookModel.ModelSubscription
+		deliveryModel     webhookModel.ModelDelivery
+	}
+
+	subscriptionData struct {
+		URL string `json:"url" validate:"required,url,max=2048"`
+		// Secret is generated when empty on creation, and kept when empty on update.
+		Secret string   `json:"secret,omitempty" validate:"omitempty,min=16,max=255"`
+		Events []string `json:"events" validate:"required,min=1"`
+		Active *bool    `json:"active,omitempty"`
+	}
+
+	subscriptionJSON struct {
+		ID     libUUID.UUID `json:"id"`
+		URL    string       `json:"url"`
+		Events []string     `json:"events"`
+		Active bool         `json:"active"`
+		// Secret is only returned on creation.
+		Secret    string    `json:"secret,omitempty"`
+		CreatedAt time.Time `json:"createdAt"`
+		UpdatedAt time.Time `json:"updatedAt"`
+	}
+
+	deliveryJSON struct {
+		ID            libUUID.UUID    `json:"id"`
+		Event         string          `json:"event"`
+		Status        string          `json:"status"`
+		Attempts      int             `json:"attempts"`
+		ResponseCode  int             `json:"responseCode,omitempty"`
+		LastError     string          `json:"lastError,omitempty"`
+		NextAttemptAt *time.Time      `json:"nextAttemptAt,omitempty"`
+		DeliveredAt   *time.Time      `json:"deliveredAt,omitempty"`
+		CreatedAt     time.Time       `json:"createdAt"`
+		Payload       json.RawMessage `json:"payload"`
+	}
+
+	deliveryPageJSON struct {
+		Deliveries []deliveryJSON `json:"deliveries"`
+		NextCursor string         `json:"nextCursor,omitempty"`
+	}
+)
+
+// CreateHandlerWebhook is used to create the handler of the webhook subscriptions.
+func CreateHandlerWebhook(subscription webhookModel.ModelSubscription, delivery webhookModel.ModelDelivery) *HandlerWebhook {
+	return &HandlerWebhook{subscription, delivery}
+}
+
+func toSubscriptionJSON(subscription webhookModel.ModelSubscription) subscriptionJSON {
+	events := subscription.Events
+	if events == nil {
+		events = []string{}
+	}
+
+	return subscriptionJSON{
+		ID:        subscription.UUID,
+		URL:       subscription.URL,
+		Events:    events,
+		Active:    subscription.Active,
+		CreatedAt: subscription.CreatedAt,
+		UpdatedAt: subscription.UpdatedAt,
+	}
+}
+
+func toDeliveryJSON(delivery webhookModel.ModelDelivery) deliveryJSON {
+	result := deliveryJSON{
+		ID:           delivery.UUID,
+		Event:        delivery.Event,
+		Status:       delivery.Status,
+		Attempts:     delivery.Attempts,
+		ResponseCode: delivery.ResponseCode,
+		LastError:    delivery.LastError,
+		DeliveredAt:  delivery.DeliveredAt,
+		CreatedAt:    delivery.CreatedAt,
+		Payload:      delivery.Payload,
+	}
+
+	if delivery.Status == webhookModel.StatusPending {
+		result.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	return result
+}
+
+// validateSubscriptionData is used to check the rules the validator tags can't express:
+// the URL must be absolute HTTP(S), and the events known ones or prefixes of them.
+func validateSubscriptionData(data *subscriptionData) error {
+	parsedURL, err := url.Parse(data.URL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return problem.Validation("invalid url", problem.FieldError{Field: "url", Rule: "http_url", Message: "must be an absolute http or https URL"})
+	}
+
+	for _, event := range data.Events {
+		if !isWebhookEvent(event) {
+			return problem.Validation("unknown event "+event, problem.FieldError{
+				Field:   "events",
+				Rule:    "oneof",
+				Message: "must be *, tenant.*, task.* or one of: " + strings.Join(webhookEvents, ", "),
+			})
+		}
+	}
+	return nil
+}
+
+// isWebhookEvent is used to know if a subscription can filter on event.
+func isWebhookEvent(event string) bool {
+	if event == "*" || event == "tenant.*" || event == "task.*" {
+		return true
+	}
+
+	for _, known := range webhookEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// subscription is used to get the subscription of the id path parameter.
+func (h HandlerWebhook) subscription(c echo.Context) (*webhookModel.ModelSubscription, error) {
+	subscriptionID, err := libUUID.Parse(c.Param("id"))
+	if err != nil {
+		return nil, problem.BadRequest("invalid webhook id")
+	}
+
+	h.subscriptionModel.UUID = subscriptionID
+	subscription, err := h.subscriptionModel.WithContext(c.Request().Context()).GetOne()
+	if errors.Is(err, webhookModel.ErrNotFound) {
+		return nil, problem.NotFound(err.Error())
+	}
+
+	if err != nil {
+		return nil, problem.Internal(err)
+	}
+	return subscription, nil
+}
+
+// GetAll godoc
+// @Summary List webhook subscriptions
+// @Description get the webhook subscriptions, without their secret
+// @Tags webhooks
+// @Produce  json
+// @Success 200 {array} handlers.subscriptionJSON
+// @Failure 500 {object} problem.Problem
+// @Router /webhooks [get]
+func (h HandlerWebhook) GetAll(c echo.Context) error {
+	subscriptions, err := h.subscriptionModel.WithContext(c.Request().Context()).GetAll()
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	results := []subscriptionJSON{}
+	for _, subscription := range *subscriptions {
+		results = append(results, toSubscriptionJSON(subscription))
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+// Create godoc
+// @Summary Create a webhook subscription
+// @Description subscribe an URL to events, the deliveries being signed with the secret, generated if not given
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param subscription body handlers.subscriptionData true "Subscription"
+// @Success 201 {object} handlers.subscriptionJSON
+// @Failure 400 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /webhooks [post]
+func (h HandlerWebhook) Create(c echo.Context) error {
+	data := new(subscriptionData)
+	if err := c.Bind(data); err != nil {
+		return err
+	}
+
+	if err := c.Validate(data); err != nil {
+		return err
+	}
+
+	if err := validateSubscriptionData(data); err != nil {
+		return err
+	}
+
+	secret := data.Secret
+	if secret == "" {
+		var err error
+		secret, err = webhook.NewSecret()
+		if err != nil {
+			return problem.Internal(err)
+		}
+	}
+
+	h.subscriptionModel.URL = data.URL
+	h.subscriptionModel.Secret = secret
+	h.subscriptionModel.Events = data.Events
+	h.subscriptionModel.Active = data.Active == nil || *data.Active
+
+	subscription, err := h.subscriptionModel.WithContext(c.Request().Context()).Save()
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	// The secret is only shown once, for the receiver to verify the signatures.
+	result := toSubscriptionJSON(*subscription)
+	result.Secret = subscription.Secret
+	return c.JSON(http.StatusCreated, result)
+}
+
+// GetOne godoc
+// @Summary Get a webhook subscription
+// @Description get a webhook subscription by id, without its secret
+// @Tags webhooks
+// @Produce  json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} handlers.subscriptionJSON
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /webhooks/{id} [get]
+func (h HandlerWebhook) GetOne(c echo.Context) error {
+	subscription, err := h.subscription(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, toSubscriptionJSON(*subscription))
+}
+
+// Update godoc
+// @Summary Update a webhook subscription
+// @Description replace the URL, events and active flag of a subscription, and its secret if given
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Subscription ID"
+// @Param subscription body handlers.subscriptionData true "Subscription"
+// @Success 200 {object} handlers.subscriptionJSON
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /webhooks/{id} [put]
+func (h HandlerWebhook) Update(c echo.Context) error {
+	subscriptionID, err := libUUID.Parse(c.Param("id"))
+	if err != nil {
+		return problem.BadRequest("invalid webhook id")
+	}
+
+	data := new(subscriptionData)
+	if err := c.Bind(data); err != nil {
+		return err
+	}
+
+	if err := c.Validate(data); err != nil {
+		return err
+	}
+
+	if err := validateSubscriptionData(data); err != nil {
+		return err
+	}
+
+	h.subscriptionModel.UUID = subscriptionID
+	h.subscriptionModel.URL = data.URL
+	h.subscriptionModel.Secret = data.Secret
+	h.subscriptionModel.Events = data.Events
+	h.subscriptionModel.Active = data.Active == nil || *data.Active
+
+	subscription, err := h.subscriptionModel.WithContext(c.Request().Context()).Update()
+	if errors.Is(err, webhookModel.ErrNotFound) {
+		return problem.NotFound(err.Error())
+	}
+
+	if err != nil {
+		return problem.Internal(err)
+	}
+	return c.JSON(http.StatusOK, toSubscriptionJSON(*subscription))
+}
+
+// DeleteByID godoc
+// @Summary Delete a webhook subscription
+// @Description delete a webhook subscription along with its delivery log
+// @Tags webhooks
+// @Produce  json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} bool
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /webhooks/{id} [delete]
+func (h HandlerWebhook) DeleteByID(c echo.Context) error {
+	subscriptionID, err := libUUID.Parse(c.Param("id"))
+	if err != nil {
+		return problem.BadRequest("invalid webhook id")
+	}
+
+	h.subscriptionModel.UUID = subscriptionID
+	isDeleted, err := h.subscriptionModel.WithContext(c.Request().Context()).Delete()
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	if !isDeleted {
+		return problem.NotFound(webhookModel.ErrNotFound.Error())
+	}
+	return c.JSON(http.StatusOK, isDeleted)
+}
+
+// GetDeliveries godoc
+// @Summary List webhook deliveries
+// @Description list the deliveries of a subscription with the outcome of their last attempt, the latest first, a page at a time
+// @Tags webhooks
+// @Produce  json
+// @Param id path string true "Subscription ID"
+// @Param limit query int false "Maximum number of deliveries"
+// @Param cursor query string false "nextCursor of the previous page"
+// @Success 200 {object} handlers.deliveryPageJSON
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /webhooks/{id}/deliveries [get]
+func (h HandlerWebhook) GetDeliveries(c echo.Context) error {
+	subscription, err := h.subscription(c)
+	if err != nil {
+		return err
+	}
+
+	limit, cursor, err := pageParams(c, defaultDeliveryLimit, maxDeliveryLimit)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := h.deliveryModel.WithContext(c.Request().Context()).Find(subscription.ID, limit, cursor)
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	page := deliveryPageJSON{Deliveries: []deliveryJSON{}}
+	for _, delivery := range deliveries {
+		page.Deliveries = append(page.Deliveries, toDeliveryJSON(delivery))
+	}
+
+	if len(deliveries) > 0 {
+		page.NextCursor = nextCursor(len(deliveries), limit, deliveries[len(deliveries)-1].ID)
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// Redeliver godoc
+// @Summary Redeliver a webhook event
+// @Description send the event of a delivery again, as a new delivery keeping the event ID
+// @Tags webhooks
+// @Produce  json
+// @Param id path string true "Subscription ID"
+// @Param delivery path string true "Delivery ID"
+// @Success 202 {object} handlers.deliveryJSON
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /webhooks/{id}/deliveries/{delivery}/redeliver [post]
+func (h HandlerWebhook) Redeliver(c echo.Context) error {
+	subscription, err := h.subscription(c)
+	if err != nil {
+		return err
+	}
+
+	deliveryID, err := libUUID.Parse(c.Param("delivery"))
+	if err != nil {
+		return problem.BadRequest("invalid delivery id")
+	}
+
+	h.deliveryModel.UUID = deliveryID
+	h.deliveryModel.SubscriptionID = subscription.ID
+	delivery, err := h.deliveryModel.WithContext(c.Request().Context()).GetOne()
+	if errors.Is(err, webhookModel.ErrDeliveryNotFound) {
+		return problem.NotFound(err.Error())
+	}
+
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	redelivery, err := delivery.Redeliver()
+	if err != nil {
+		return problem.Internal(err)
+	}
+	return c.JSON(http.StatusAccepted, toDeliveryJSON(*redelivery))
+}
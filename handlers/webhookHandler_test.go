@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	webhookModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/webhook"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func refreshWebhookTables(t *testing.T) {
+	err := DbClient.Migrator().DropTable(&webhookModel.ModelDelivery{}, &webhookModel.ModelSubscription{})
+	if err == nil {
+		err = DbClient.AutoMigrate(&webhookModel.ModelSubscription{}, &webhookModel.ModelDelivery{})
+	}
+	assert.NoError(t, err)
+}
+
+func TestWebhooks(t *testing.T) {
+	refreshWebhookTables(t)
+	defer refreshWebhookTables(t)
+	e := echo.New()
+	e.Validator = newValidator()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	h := CreateHandlerWebhook(webhookModel.ModelSubscription{}, webhookModel.ModelDelivery{})
+
+	serve := func(method string, target string, body string, handler echo.HandlerFunc, params ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if len(params) > 0 {
+			c.SetParamNames([]string{"id", "delivery"}[:len(params)]...)
+			c.SetParamValues(params...)
+		}
+		handle(c, handler)
+		return rec
+	}
+
+	// Assertions
+	rec := serve(http.MethodPost, "/webhooks", `{"url":"ftp://example.com","events":["*"]}`, h.Create)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	rec = serve(http.MethodPost, "/webhooks", `{"url":"https://example.com/hook","events":["tenant.renamed"]}`, h.Create)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	rec = serve(http.MethodPost, "/webhooks", `{"url":"https://example.com/hook","events":[]}`, h.Create)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	// The generated secret is only returned on creation.
+	rec = serve(http.MethodPost, "/webhooks", `{"url":"https://example.com/hook","events":["tenant.*","task.failed"]}`, h.Create)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var created subscriptionJSON
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Len(t, created.Secret, 64)
+	assert.True(t, created.Active)
+
+	rec = serve(http.MethodGet, "/webhooks", "", h.GetAll)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), created.Secret)
+
+	rec = serve(http.MethodPut, "/webhooks/"+created.ID.String(), `{"url":"https://example.com/v2","events":["*"],"active":false}`, h.Update, created.ID.String())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var updated subscriptionJSON
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &updated))
+	assert.Equal(t, "https://example.com/v2", updated.URL)
+	assert.Equal(t, []string{"*"}, updated.Events)
+	assert.False(t, updated.Active)
+	assert.Empty(t, updated.Secret)
+
+	// Inactive subscriptions aren't sent the events, until active again.
+	assert.NoError(t, webhookModel.Enqueue(DbClient, webhookModel.EventTaskFailed, map[string]string{"status": "failed"}))
+	rec = serve(http.MethodPut, "/webhooks/"+created.ID.String(), `{"url":"https://example.com/v2","events":["*"]}`, h.Update, created.ID.String())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, webhookModel.Enqueue(DbClient, webhookModel.EventTaskCompleted, map[string]string{"status": "completed"}))
+
+	rec = serve(http.MethodGet, "/webhooks/"+created.ID.String()+"/deliveries", "", h.GetDeliveries, created.ID.String())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var page deliveryPageJSON
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	if !assert.Len(t, page.Deliveries, 1) {
+		return
+	}
+	delivery := page.Deliveries[0]
+	assert.Equal(t, webhookModel.EventTaskCompleted, delivery.Event)
+	assert.Equal(t, webhookModel.StatusPending, delivery.Status)
+	assert.Contains(t, string(delivery.Payload), `"status":"completed"`)
+
+	// Redelivered as a new delivery of the same event.
+	rec = serve(http.MethodPost, "/", "", h.Redeliver, created.ID.String(), delivery.ID.String())
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	var redelivery deliveryJSON
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &redelivery))
+	assert.NotEqual(t, delivery.ID, redelivery.ID)
+	assert.JSONEq(t, string(delivery.Payload), string(redelivery.Payload))
+
+	rec = serve(http.MethodGet, "/", "", h.GetDeliveries, created.ID.String())
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Deliveries, 2)
+
+	rec = serve(http.MethodPost, "/", "", h.Redeliver, created.ID.String(), validTenantID)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serve(http.MethodDelete, "/", "", h.DeleteByID, created.ID.String())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(http.MethodGet, "/", "", h.GetOne, created.ID.String())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = serve(http.MethodDelete, "/", "", h.DeleteByID, created.ID.String())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
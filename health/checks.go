@@ -0,0 +1,55 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/casbin/casbin/v2"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Database is used to check the database answers a ping.
+func Database(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// AMQP is used to check the client is connected to RabbitMQ, as tracked by its reconnection loop.
+func AMQP(client interface{ IsConnected() bool }) Check {
+	return func(context.Context) error {
+		if !client.IsConnected() {
+			return errors.New("not connected to RabbitMQ")
+		}
+		return nil
+	}
+}
+
+// Policy is used to check the enforcer has loaded its policy, without which every request is denied.
+func Policy(enforcer *casbin.Enforcer) Check {
+	return func(context.Context) error {
+		policies, err := enforcer.GetPolicy()
+		if err != nil {
+			return err
+		}
+		if len(policies) == 0 {
+			return errors.New("no policy loaded")
+		}
+		return nil
+	}
+}
+
+// Listening is used to check an echo server is listening, server returning nil until it is created.
+func Listening(server func() *echo.Echo) Check {
+	return func(context.Context) error {
+		e := server()
+		if e == nil || e.ListenerAddr() == nil {
+			return errors.New("not listening")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,126 @@
+// Package health serves the liveness and readiness probes of the app, readiness checking each of its dependencies.
+package health
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// StatusUp is the status of a passing check, and of a ready app.
+	StatusUp = "up"
+	// StatusDown is the status of a failing check, and of an app not ready.
+	StatusDown = "down"
+)
+
+// checkTimeout is the longest a check can take before it is reported down.
+const checkTimeout = 2 * time.Second
+
+type (
+	// Check is used to know if a dependency is usable, returning why it isn't.
+	Check func(ctx context.Context) error
+
+	// Checker holds the checks run for readiness, and whether the app is shutting down.
+	Checker struct {
+		names        []string
+		checks       map[string]Check
+		shuttingDown atomic.Bool
+	}
+
+	// Result is the outcome of one check.
+	Result struct {
+		Status string `json:"status"`
+		// Latency is the time taken by the check, as a Go duration.
+		Latency string `json:"latency"`
+		Error   string `json:"error,omitempty"`
+	}
+
+	// Report is the readiness of the app, with the result of each check.
+	Report struct {
+		Status string            `json:"status"`
+		Checks map[string]Result `json:"checks"`
+	}
+)
+
+// New is used to create a checker without any check.
+func New() *Checker {
+	return &Checker{checks: map[string]Check{}}
+}
+
+// Register is used to add the check of a dependency, reported under name.
+func (checker *Checker) Register(name string, check Check) {
+	if _, found := checker.checks[name]; !found {
+		checker.names = append(checker.names, name)
+	}
+	checker.checks[name] = check
+}
+
+// ShutDown is used to report the app as not ready, so no more traffic is sent to it while it stops.
+func (checker *Checker) ShutDown() {
+	checker.shuttingDown.Store(true)
+}
+
+// Run is used to run every check concurrently, each within checkTimeout.
+func (checker *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(checker.names))}
+	if checker.shuttingDown.Load() {
+		report.Status = StatusDown
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range checker.names {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			result := run(ctx, check)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Checks[name] = result
+			if result.Status == StatusDown {
+				report.Status = StatusDown
+			}
+		}(name, checker.checks[name])
+	}
+	wg.Wait()
+
+	return report
+}
+
+func run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := Result{Status: StatusUp, Latency: time.Since(start).String()}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Liveness is used to answer the liveness probe, the app being alive as long as it answers.
+func (checker *Checker) Liveness() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, Report{Status: StatusUp, Checks: map[string]Result{}})
+	}
+}
+
+// Readiness is used to answer the readiness probe with the report of the checks,
+// with 503 Service Unavailable when one of them fails or the app is shutting down.
+func (checker *Checker) Readiness() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		report := checker.Run(c.Request().Context())
+		if report.Status == StatusDown {
+			return c.JSON(http.StatusServiceUnavailable, report)
+		}
+		return c.JSON(http.StatusOK, report)
+	}
+}
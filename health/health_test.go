@@ -0,0 +1,116 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeAMQPClient struct {
+	connected bool
+}
+
+func (client fakeAMQPClient) IsConnected() bool {
+	return client.connected
+}
+
+func readiness(t *testing.T, checker *Checker) (int, Report) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)
+	assert.NoError(t, checker.Readiness()(c))
+
+	report := Report{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return rec.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+	checker := New()
+	checker.Register("database", func(context.Context) error { return nil })
+	checker.Register("amqp", AMQP(fakeAMQPClient{connected: true}))
+
+	code, report := readiness(t, checker)
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusUp, report.Status)
+	assert.Equal(t, StatusUp, report.Checks["database"].Status)
+	assert.NotEmpty(t, report.Checks["database"].Latency)
+
+	checker.Register("amqp", AMQP(fakeAMQPClient{}))
+	code, report = readiness(t, checker)
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, StatusUp, report.Checks["database"].Status)
+	assert.Equal(t, Result{Status: StatusDown, Latency: report.Checks["amqp"].Latency, Error: "not connected to RabbitMQ"}, report.Checks["amqp"])
+	assert.Len(t, report.Checks, 2)
+}
+
+func TestShutDown(t *testing.T) {
+	checker := New()
+	checker.Register("database", func(context.Context) error { return nil })
+	checker.ShutDown()
+
+	code, report := readiness(t, checker)
+
+	rec := httptest.NewRecorder()
+	assert.NoError(t, checker.Liveness()(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/healthz", nil), rec)))
+
+	// Assertions
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, StatusUp, report.Checks["database"].Status)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestChecks(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:health?mode=memory"), &gorm.Config{})
+	assert.NoError(t, err)
+
+	policyModel, err := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+[policy_definition]
+p = sub, obj, act
+[policy_effect]
+e = some(where (p.eft == allow))
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act`)
+	assert.NoError(t, err)
+	enforcer, err := casbin.NewEnforcer(policyModel)
+	assert.NoError(t, err)
+
+	e := echo.New()
+	var server *echo.Echo
+
+	// Assertions
+	assert.NoError(t, Database(db)(context.Background()))
+	assert.EqualError(t, Policy(enforcer)(context.Background()), "no policy loaded")
+	_, err = enforcer.AddPolicy("guest", "/tenants", http.MethodGet)
+	assert.NoError(t, err)
+	assert.NoError(t, Policy(enforcer)(context.Background()))
+
+	listening := Listening(func() *echo.Echo { return server })
+	assert.Error(t, listening(context.Background()))
+	server = e
+	assert.Error(t, listening(context.Background()))
+
+	go func() {
+		if err := e.Start("127.0.0.1:0"); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			t.Error(err)
+		}
+	}()
+	defer e.Close()
+	assert.Eventually(t, func() bool { return listening(context.Background()) == nil }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,151 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/labstack/echo/v4"
+	idempotencyModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/idempotency"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// HeaderIdempotencyKey is the request header carrying the client chosen key.
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set on responses replayed from a previous request.
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+type (
+	// responseRecorder copies the response body while it is written to the client.
+	responseRecorder struct {
+		http.ResponseWriter
+		body bytes.Buffer
+	}
+)
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// fingerprint is used to identify a request by its method, path and body.
+func fingerprint(request *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(request.Method + " " + request.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Middleware makes requests carrying an Idempotency-Key header safe to retry.
+// The first response for a key is stored for ttl and replayed for requests with the same key and body,
+// the same key with a different body is rejected with 422. Server errors are not stored so they can be retried.
+// Keys are stored within the scope of the client sending them, so clients never see the responses of others.
+func Middleware(ttl time.Duration, scope func(c echo.Context) string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderIdempotencyKey)
+			if key == "" {
+				return next(c)
+			}
+
+			if len(key) > maxKeyLength {
+				return problem.Validation("idempotency key is too long",
+					problem.FieldError{Field: HeaderIdempotencyKey, Rule: "max", Message: "must be at most " + strconv.Itoa(maxKeyLength) + " long"})
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return problem.BadRequest(err.Error())
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			requestFingerprint := fingerprint(c.Request(), body)
+
+			clientScope := scope(c)
+			storedKey, err := (&idempotencyModel.ModelIdempotencyKey{Scope: clientScope, Key: key}).WithContext(c.Request().Context()).GetOne()
+			if err == nil {
+				return replay(c, storedKey, requestFingerprint)
+			}
+
+			if !errors.Is(err, idempotencyModel.ErrNotFound) {
+				return problem.Internal(err)
+			}
+
+			// The key is written even if the client gave up meanwhile, or its retries would find it in progress
+			// until it expires.
+			reservedKey, err := (&idempotencyModel.ModelIdempotencyKey{
+				Scope:       clientScope,
+				Key:         key,
+				Fingerprint: requestFingerprint,
+				ExpiresAt:   time.Now().Add(ttl),
+			}).WithContext(context.WithoutCancel(c.Request().Context())).Reserve()
+			if errors.Is(err, idempotencyModel.ErrReserved) {
+				// Another request reserved the key in the meantime.
+				return problem.Conflict("a request with this idempotency key is in progress")
+			}
+
+			if err != nil {
+				return problem.Internal(err)
+			}
+
+			// The key is released unless the response is stored, also when the handler panics, so it can be retried.
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+
+				if releaseErr := reservedKey.Release(); releaseErr != nil {
+					c.Logger().Error(releaseErr.Error())
+				}
+			}()
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			// Errors are answered here so client errors are stored like any other response.
+			if err = next(c); err != nil {
+				c.Error(err)
+			}
+
+			if c.Response().Status >= http.StatusInternalServerError {
+				return nil
+			}
+
+			err = reservedKey.Complete(c.Response().Status, c.Response().Header().Get(echo.HeaderContentType), recorder.body.Bytes())
+			if err != nil {
+				c.Logger().Error(err.Error())
+				return nil
+			}
+			completed = true
+			return nil
+		}
+	}
+}
+
+// replay is used to answer with the stored response of a previous request with the same key.
+func replay(c echo.Context, storedKey *idempotencyModel.ModelIdempotencyKey, requestFingerprint string) error {
+	if storedKey.Fingerprint != requestFingerprint {
+		return problem.Unprocessable("idempotency key was already used with a different request")
+	}
+
+	if storedKey.StatusCode == 0 {
+		return problem.Conflict("a request with this idempotency key is in progress")
+	}
+
+	c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+	return c.Blob(storedKey.StatusCode, storedKey.ContentType, storedKey.Response)
+}
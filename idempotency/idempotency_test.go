@@ -0,0 +1,253 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/config"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	idempotencyModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/idempotency"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var DbClient *gorm.DB
+
+func TestMain(m *testing.M) {
+	DbClient = database.ConnectForTests()
+	err := DbClient.AutoMigrate(&idempotencyModel.ModelIdempotencyKey{})
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+
+	os.Exit(m.Run())
+}
+
+// testScope is used to name the client of a request by its X-Client header.
+func testScope(c echo.Context) string {
+	return c.Request().Header.Get("X-Client")
+}
+
+// countingServer is used to count how many requests really reached the handler.
+func countingServer(ttl time.Duration, status int) (*echo.Echo, *int) {
+	calls := 0
+	e := echo.New()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	e.POST("/tenants", func(c echo.Context) error {
+		calls++
+		return c.JSON(status, map[string]string{"taskId": strconv.Itoa(calls)})
+	}, Middleware(ttl, testScope))
+	return e, &calls
+}
+
+func post(e *echo.Echo, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/tenants", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestReplayWithSameKey(t *testing.T) {
+	e, calls := countingServer(time.Hour, http.StatusCreated)
+
+	rec := post(e, "replay-key", `{"name":"Acme"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, `{"taskId":"1"}`+"\n", rec.Body.String())
+	assert.Empty(t, rec.Header().Get(HeaderIdempotentReplayed))
+
+	rec = post(e, "replay-key", `{"name":"Acme"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, `{"taskId":"1"}`+"\n", rec.Body.String())
+	assert.Equal(t, "true", rec.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, echo.MIMEApplicationJSON, rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, 1, *calls)
+
+	rec = post(e, "replay-key", `{"name":"Globex"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, problem.MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+	assert.Contains(t, rec.Body.String(), `"detail":"idempotency key was already used with a different request"`)
+	assert.Equal(t, 1, *calls)
+
+	rec = post(e, "", `{"name":"Acme"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, 2, *calls)
+}
+
+func TestExpiredKey(t *testing.T) {
+	e, calls := countingServer(-time.Second, http.StatusCreated)
+
+	post(e, "expired-key", `{"name":"Acme"}`)
+	rec := post(e, "expired-key", `{"name":"Globex"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, rec.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, 2, *calls)
+}
+
+func TestServerErrorIsNotStored(t *testing.T) {
+	e, calls := countingServer(time.Hour, http.StatusInternalServerError)
+
+	post(e, "failing-key", `{"name":"Acme"}`)
+	rec := post(e, "failing-key", `{"name":"Acme"}`)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, 2, *calls)
+}
+
+func TestKeyInProgress(t *testing.T) {
+	e, calls := countingServer(time.Hour, http.StatusCreated)
+
+	_, err := (&idempotencyModel.ModelIdempotencyKey{
+		Key:         "pending-key",
+		Fingerprint: fingerprint(httptest.NewRequest(http.MethodPost, "/tenants", nil), []byte(`{"name":"Acme"}`)),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}).Reserve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := post(e, "pending-key", `{"name":"Acme"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, 0, *calls)
+}
+
+func TestPurgeExpiredKeys(t *testing.T) {
+	_, err := (&idempotencyModel.ModelIdempotencyKey{Key: "old-key", Fingerprint: "x", ExpiresAt: time.Now().Add(-time.Minute)}).Reserve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := (&idempotencyModel.ModelIdempotencyKey{}).PurgeExpired(time.Now())
+	if assert.NoError(t, err) {
+		assert.GreaterOrEqual(t, purged, int64(1))
+	}
+
+	_, err = (&idempotencyModel.ModelIdempotencyKey{Key: "old-key"}).GetOne()
+	assert.ErrorIs(t, err, idempotencyModel.ErrNotFound)
+}
+
+func TestReplayClientError(t *testing.T) {
+	calls := 0
+	e := echo.New()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	e.POST("/tenants", func(c echo.Context) error {
+		calls++
+		return problem.Validation("invalid tenant")
+	}, Middleware(time.Hour, testScope))
+
+	rec := post(e, "client-error-key", `{"name":""}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	// Client errors are answered for good, the retry gets the same problem without reaching the handler.
+	replayed := post(e, "client-error-key", `{"name":""}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, replayed.Code)
+	assert.Equal(t, problem.MIMEApplicationProblemJSON, replayed.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, rec.Body.String(), replayed.Body.String())
+	assert.Equal(t, "true", replayed.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, 1, calls)
+}
+
+func TestKeysAreScopedByClient(t *testing.T) {
+	e, calls := countingServer(time.Hour, http.StatusCreated)
+
+	for _, client := range []string{"alice", "bob"} {
+		req := httptest.NewRequest(http.MethodPost, "/tenants", strings.NewReader(`{"name":"Acme"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(HeaderIdempotencyKey, "shared-key")
+		req.Header.Set("X-Client", client)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Empty(t, rec.Header().Get(HeaderIdempotentReplayed))
+	}
+	assert.Equal(t, 2, *calls)
+}
+
+func TestReserveError(t *testing.T) {
+	failingClient, err := database.Open(config.Database{Driver: config.DriverSQLite, Name: "idempotency-failing", DSN: t.TempDir() + "/idempotency.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = failingClient.AutoMigrate(&idempotencyModel.ModelIdempotencyKey{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = failingClient.Callback().Create().Before("gorm:create").Register("fail", func(tx *gorm.DB) {
+		_ = tx.AddError(errors.New("database is down"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, calls := countingServer(time.Hour, http.StatusCreated)
+	e.Pre(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.SetRequest(c.Request().WithContext(database.NewContext(c.Request().Context(), failingClient)))
+			return next(c)
+		}
+	})
+
+	rec := post(e, "failing-reserve-key", `{"name":"Acme"}`)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, 0, *calls)
+}
+
+func TestPanicReleasesKey(t *testing.T) {
+	calls := 0
+	e := echo.New()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	e.Use(middleware.Recover())
+	e.POST("/tenants", func(c echo.Context) error {
+		calls++
+		if calls == 1 {
+			panic("handler failure")
+		}
+		return c.JSON(http.StatusCreated, map[string]string{"taskId": strconv.Itoa(calls)})
+	}, Middleware(time.Hour, testScope))
+
+	rec := post(e, "panic-key", `{"name":"Acme"}`)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	rec = post(e, "panic-key", `{"name":"Acme"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestClientGaveUp(t *testing.T) {
+	for status, replayed := range map[int]string{http.StatusCreated: "true", http.StatusInternalServerError: ""} {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		e := echo.New()
+		e.HTTPErrorHandler = problem.HTTPErrorHandler
+		e.POST("/tenants", func(c echo.Context) error {
+			calls++
+			// The client times out while the request is processed.
+			cancel()
+			return c.JSON(status, map[string]string{"taskId": strconv.Itoa(calls)})
+		}, Middleware(time.Hour, testScope))
+
+		key := "gave-up-key-" + strconv.Itoa(status)
+		req := httptest.NewRequest(http.MethodPost, "/tenants", strings.NewReader(`{"name":"Acme"}`)).WithContext(ctx)
+		req.Header.Set(HeaderIdempotencyKey, key)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+
+		// The retry gets the stored response, or runs again when the first one failed, instead of a conflict.
+		rec := post(e, key, `{"name":"Acme"}`)
+		assert.Equal(t, status, rec.Code)
+		assert.Equal(t, replayed, rec.Header().Get(HeaderIdempotentReplayed))
+	}
+}
@@ -0,0 +1,84 @@
+// Package lifecycle stops the components of the app in order once it is asked to terminate, within a deadline.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type (
+	// Hook is a step of the shutdown, stopping one component.
+	Hook struct {
+		Name string
+		Stop func(ctx context.Context) error
+	}
+
+	// Manager holds the shutdown hooks, run in the order they were added.
+	Manager struct {
+		hooks   []Hook
+		timeout time.Duration
+		logger  zerolog.Logger
+	}
+)
+
+// New is used to create a manager giving timeout to the whole shutdown.
+func New(timeout time.Duration, logger zerolog.Logger) *Manager {
+	return &Manager{timeout: timeout, logger: logger}
+}
+
+// OnShutdown is used to add the hook stopping a component, after the ones already added.
+func (manager *Manager) OnShutdown(name string, stop func(ctx context.Context) error) {
+	manager.hooks = append(manager.hooks, Hook{Name: name, Stop: stop})
+}
+
+// WaitForSignal is used to block until the app receives SIGINT or SIGTERM.
+func WaitForSignal() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+}
+
+// Shutdown is used to run every hook in order, sharing the deadline of the manager or of ctx, the earliest.
+// A hook failing or running out of time doesn't prevent the next ones from running, their errors are joined.
+func (manager *Manager) Shutdown(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, manager.timeout)
+	defer cancel()
+
+	manager.logger.Info().Msg("Shutting down")
+
+	var errs []error
+	for _, hook := range manager.hooks {
+		start := time.Now()
+		err := hook.Stop(ctx)
+		if err != nil {
+			manager.logger.Error().Err(err).Str("hook", hook.Name).Dur("latency", time.Since(start)).Msg("Error shutting down")
+			errs = append(errs, fmt.Errorf("%s: %w", hook.Name, err))
+			continue
+		}
+		manager.logger.Info().Str("hook", hook.Name).Dur("latency", time.Since(start)).Msg("Shut down")
+	}
+	return errors.Join(errs...)
+}
+
+// WaitGroup is used to wait for the work tracked by wg, until ctx is done.
+func WaitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,54 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	manager := New(50*time.Millisecond, zerolog.Nop())
+	var stopped []string
+	manager.OnShutdown("http", func(context.Context) error {
+		stopped = append(stopped, "http")
+		return nil
+	})
+	manager.OnShutdown("workers", func(ctx context.Context) error {
+		stopped = append(stopped, "workers")
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	manager.OnShutdown("database", func(ctx context.Context) error {
+		stopped = append(stopped, "database")
+		return errors.New("already closed")
+	})
+
+	err := manager.Shutdown(context.Background())
+
+	// Assertions
+	assert.Equal(t, []string{"http", "workers", "database"}, stopped)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, "workers: context deadline exceeded\ndatabase: already closed")
+}
+
+func TestWaitGroup(t *testing.T) {
+	var wg sync.WaitGroup
+	release := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-release
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Assertions
+	assert.ErrorIs(t, WaitGroup(ctx, &wg), context.DeadlineExceeded)
+	close(release)
+	assert.NoError(t, WaitGroup(context.Background(), &wg))
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"github.com/rs/zerolog"
+	"strings"
+)
+
+// CasbinLogger is the casbin logger, writing to a zerolog logger. Everything but errors is logged at the debug level.
+type CasbinLogger struct {
+	logger  zerolog.Logger
+	enabled bool
+}
+
+// NewCasbinLogger is used to create the casbin logger writing to logger.
+func NewCasbinLogger(logger zerolog.Logger) *CasbinLogger {
+	return &CasbinLogger{logger: logger}
+}
+
+func (l *CasbinLogger) EnableLog(enabled bool) {
+	l.enabled = enabled
+}
+
+func (l *CasbinLogger) IsEnabled() bool {
+	return l.enabled
+}
+
+func (l *CasbinLogger) LogModel(model [][]string) {
+	if l.enabled {
+		l.logger.Debug().Interface("model", model).Msg("policy model")
+	}
+}
+
+func (l *CasbinLogger) LogEnforce(matcher string, request []interface{}, result bool, explains [][]string) {
+	if l.enabled {
+		l.logger.Debug().Str("matcher", matcher).Interface("request", request).Bool("allowed", result).Interface("explains", explains).Msg("policy enforced")
+	}
+}
+
+func (l *CasbinLogger) LogRole(roles []string) {
+	if l.enabled {
+		l.logger.Debug().Strs("roles", roles).Msg("policy roles")
+	}
+}
+
+func (l *CasbinLogger) LogPolicy(policy map[string][][]string) {
+	if l.enabled {
+		l.logger.Debug().Interface("policy", policy).Msg("policy loaded")
+	}
+}
+
+func (l *CasbinLogger) LogError(err error, message ...string) {
+	l.logger.Error().Err(err).Msg(strings.Join(message, " "))
+}
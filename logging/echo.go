@@ -0,0 +1,233 @@
+package logging
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/rs/zerolog"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	subjectKey = "logSubject"
+	tenantKey  = "logTenant"
+)
+
+// EchoLogger is the echo logger, writing to a zerolog logger.
+type EchoLogger struct {
+	logger zerolog.Logger
+	prefix string
+}
+
+// NewEchoLogger is used to create the echo logger writing to logger.
+func NewEchoLogger(logger zerolog.Logger) *EchoLogger {
+	return &EchoLogger{logger: logger}
+}
+
+// FromEcho is used to find the zerolog logger behind an echo logger, loggers of other kinds fall back to the http one.
+func FromEcho(logger echo.Logger) zerolog.Logger {
+	if echoLogger, ok := logger.(*EchoLogger); ok {
+		return echoLogger.logger
+	}
+	return Component("http")
+}
+
+// SetSubject is used to name who made the request in its access log.
+func SetSubject(c echo.Context, subject string) {
+	c.Set(subjectKey, subject)
+}
+
+// Subject is used to get the subject the request is made by, empty when it wasn't set.
+func Subject(c echo.Context) string {
+	subject, _ := c.Get(subjectKey).(string)
+	return subject
+}
+
+// SetTenant is used to name the tenant the request is made for in its access log.
+func SetTenant(c echo.Context, tenant string) {
+	c.Set(tenantKey, tenant)
+}
+
+// AccessLog is used to log every request once answered, with its latency, sizes, subject and tenant.
+// Errors are answered here, as the echo logger middleware does, so the logged status is the one sent.
+func AccessLog() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			request, response := c.Request(), c.Response()
+			logger := FromEcho(c.Logger())
+
+			event := logger.Info()
+			if response.Status >= http.StatusInternalServerError {
+				event = logger.Error()
+			} else if response.Status >= http.StatusBadRequest {
+				event = logger.Warn()
+			}
+
+			event = event.
+				Str("method", request.Method).
+				Str("uri", request.RequestURI).
+				Str("route", c.Path()).
+				Int("status", response.Status).
+				Dur("latency", time.Since(start)).
+				Int64("bytesIn", request.ContentLength).
+				Int64("bytesOut", response.Size).
+				Str("remoteIp", c.RealIP())
+
+			if subject, ok := c.Get(subjectKey).(string); ok {
+				event = event.Str("subject", subject)
+			}
+
+			if tenant, ok := c.Get(tenantKey).(string); ok {
+				event = event.Str("tenant", tenant)
+			}
+
+			event.Msg("request")
+			return nil
+		}
+	}
+}
+
+// Output is the zerolog logger itself, which writes without level.
+func (l *EchoLogger) Output() io.Writer {
+	return l.logger
+}
+
+// SetOutput is used to write the logs somewhere else.
+func (l *EchoLogger) SetOutput(w io.Writer) {
+	l.logger = l.logger.Output(w)
+}
+
+// Prefix is only kept for echo, it isn't written.
+func (l *EchoLogger) Prefix() string {
+	return l.prefix
+}
+
+// SetPrefix is only kept for echo, it isn't written.
+func (l *EchoLogger) SetPrefix(p string) {
+	l.prefix = p
+}
+
+// Level is the echo counterpart of the zerolog level.
+func (l *EchoLogger) Level() log.Lvl {
+	switch l.logger.GetLevel() {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return log.DEBUG
+	case zerolog.InfoLevel:
+		return log.INFO
+	case zerolog.WarnLevel:
+		return log.WARN
+	case zerolog.ErrorLevel:
+		return log.ERROR
+	}
+	return log.OFF
+}
+
+// SetLevel is used to change the zerolog level from its echo counterpart.
+func (l *EchoLogger) SetLevel(v log.Lvl) {
+	levels := map[log.Lvl]zerolog.Level{
+		log.DEBUG: zerolog.DebugLevel,
+		log.INFO:  zerolog.InfoLevel,
+		log.WARN:  zerolog.WarnLevel,
+		log.ERROR: zerolog.ErrorLevel,
+	}
+
+	level, found := levels[v]
+	if !found {
+		level = zerolog.Disabled
+	}
+	l.logger = l.logger.Level(level)
+}
+
+// SetHeader does nothing, the zerolog output decides the format.
+func (l *EchoLogger) SetHeader(string) {}
+
+func (l *EchoLogger) Print(i ...interface{}) {
+	l.logger.Log().Msg(fmt.Sprint(i...))
+}
+
+func (l *EchoLogger) Printf(format string, args ...interface{}) {
+	l.logger.Log().Msgf(format, args...)
+}
+
+func (l *EchoLogger) Printj(j log.JSON) {
+	l.logger.Log().Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *EchoLogger) Debug(i ...interface{}) {
+	l.logger.Debug().Msg(fmt.Sprint(i...))
+}
+
+func (l *EchoLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debug().Msgf(format, args...)
+}
+
+func (l *EchoLogger) Debugj(j log.JSON) {
+	l.logger.Debug().Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *EchoLogger) Info(i ...interface{}) {
+	l.logger.Info().Msg(fmt.Sprint(i...))
+}
+
+func (l *EchoLogger) Infof(format string, args ...interface{}) {
+	l.logger.Info().Msgf(format, args...)
+}
+
+func (l *EchoLogger) Infoj(j log.JSON) {
+	l.logger.Info().Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *EchoLogger) Warn(i ...interface{}) {
+	l.logger.Warn().Msg(fmt.Sprint(i...))
+}
+
+func (l *EchoLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Warn().Msgf(format, args...)
+}
+
+func (l *EchoLogger) Warnj(j log.JSON) {
+	l.logger.Warn().Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *EchoLogger) Error(i ...interface{}) {
+	l.logger.Error().Msg(fmt.Sprint(i...))
+}
+
+func (l *EchoLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Error().Msgf(format, args...)
+}
+
+func (l *EchoLogger) Errorj(j log.JSON) {
+	l.logger.Error().Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *EchoLogger) Fatal(i ...interface{}) {
+	l.logger.Fatal().Msg(fmt.Sprint(i...))
+}
+
+func (l *EchoLogger) Fatalf(format string, args ...interface{}) {
+	l.logger.Fatal().Msgf(format, args...)
+}
+
+func (l *EchoLogger) Fatalj(j log.JSON) {
+	l.logger.Fatal().Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *EchoLogger) Panic(i ...interface{}) {
+	l.logger.Panic().Msg(fmt.Sprint(i...))
+}
+
+func (l *EchoLogger) Panicf(format string, args ...interface{}) {
+	l.logger.Panic().Msgf(format, args...)
+}
+
+func (l *EchoLogger) Panicj(j log.JSON) {
+	l.logger.Panic().Fields(map[string]interface{}(j)).Send()
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+	"time"
+)
+
+// slowQueryThreshold is the duration above which queries are logged as warnings.
+const slowQueryThreshold = 200 * time.Millisecond
+
+// GormLogger is the gorm logger, writing to a zerolog logger. Queries are logged at the debug level.
+type GormLogger struct {
+	logger zerolog.Logger
+}
+
+// NewGormLogger is used to create the gorm logger writing to logger.
+func NewGormLogger(logger zerolog.Logger) *GormLogger {
+	return &GormLogger{logger: logger}
+}
+
+// LogMode is used by gorm to lower the level, such as in its silent sessions.
+func (l *GormLogger) LogMode(level gormLogger.LogLevel) gormLogger.Interface {
+	levels := map[gormLogger.LogLevel]zerolog.Level{
+		gormLogger.Silent: zerolog.Disabled,
+		gormLogger.Error:  zerolog.ErrorLevel,
+		gormLogger.Warn:   zerolog.WarnLevel,
+		gormLogger.Info:   zerolog.DebugLevel,
+	}
+
+	zerologLevel, found := levels[level]
+	if !found || zerologLevel < l.logger.GetLevel() {
+		return l
+	}
+	return &GormLogger{logger: l.logger.Level(zerologLevel)}
+}
+
+func (l *GormLogger) Info(_ context.Context, message string, data ...interface{}) {
+	l.logger.Info().Msgf(message, data...)
+}
+
+func (l *GormLogger) Warn(_ context.Context, message string, data ...interface{}) {
+	l.logger.Warn().Msgf(message, data...)
+}
+
+func (l *GormLogger) Error(_ context.Context, message string, data ...interface{}) {
+	l.logger.Error().Msgf(message, data...)
+}
+
+// Trace is used by gorm after each query, failed and slow queries are logged above the debug level.
+func (l *GormLogger) Trace(_ context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+
+	var event *zerolog.Event
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		event = l.logger.Error().Err(err)
+	case elapsed > slowQueryThreshold:
+		event = l.logger.Warn().Bool("slow", true)
+	default:
+		event = l.logger.Debug()
+	}
+
+	if event == nil {
+		return
+	}
+
+	sql, rowsAffected := fc()
+	event.Str("sql", sql).Int64("rows", rowsAffected).Dur("latency", elapsed).Msg("query")
+}
@@ -0,0 +1,61 @@
+// Package logging provides the zerolog loggers of every component, and their adapters for echo, gorm and casbin.
+package logging
+
+import (
+	"fmt"
+	"github.com/rs/zerolog"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	mutex        sync.RWMutex
+	root         = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).With().Timestamp().Logger()
+	defaultLevel = zerolog.InfoLevel
+	levels       = map[string]zerolog.Level{}
+)
+
+// Configure is used to set the output and the levels of the loggers: JSON on stdout in prod, console output otherwise.
+// level is the default one, componentLevels override it for the components they name.
+func Configure(prod bool, level string, componentLevels map[string]string) error {
+	var output io.Writer = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
+	if prod {
+		output = os.Stdout
+	}
+
+	parsedLevel, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("log level: %w", err)
+	}
+
+	parsedLevels := make(map[string]zerolog.Level, len(componentLevels))
+	for component, componentLevel := range componentLevels {
+		parsedLevels[component], err = zerolog.ParseLevel(componentLevel)
+		if err != nil {
+			return fmt.Errorf("log level of %s: %w", component, err)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	root = zerolog.New(output).With().Timestamp().Logger()
+	defaultLevel = parsedLevel
+	levels = parsedLevels
+	return nil
+}
+
+// Component is used to get the logger of a component, at the level configured for it.
+// Loggers should be taken once Configure was called, not kept in package variables.
+func Component(name string) zerolog.Logger {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	level, found := levels[name]
+	if !found {
+		level = defaultLevel
+	}
+	return root.Level(level).With().Str("component", name).Logger()
+}
@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lines is used to decode the JSON lines written by zerolog.
+func lines(t *testing.T, output *bytes.Buffer) []map[string]interface{} {
+	var decoded []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &fields), line)
+		decoded = append(decoded, fields)
+	}
+	return decoded
+}
+
+func TestConfigure(t *testing.T) {
+	defer func() {
+		assert.NoError(t, Configure(false, "info", nil))
+	}()
+
+	err := Configure(true, "warn", map[string]string{"database": "debug"})
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, zerolog.WarnLevel, Component("http").GetLevel())
+	assert.Equal(t, zerolog.DebugLevel, Component("database").GetLevel())
+
+	assert.Error(t, Configure(true, "loud", nil))
+	assert.Error(t, Configure(true, "info", map[string]string{"amqp": "loud"}))
+
+	// Failed configurations are not applied.
+	assert.Equal(t, zerolog.WarnLevel, Component("http").GetLevel())
+}
+
+func TestAccessLog(t *testing.T) {
+	var output bytes.Buffer
+	e := echo.New()
+	e.Logger = NewEchoLogger(zerolog.New(&output))
+	e.Use(AccessLog())
+	e.GET("/tenants/:id", func(c echo.Context) error {
+		SetSubject(c, "guest")
+		SetTenant(c, "tenant-1")
+		return c.String(http.StatusOK, "found")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tenants/1?full=true", nil))
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	logs := lines(t, &output)
+
+	// Assertions
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	if assert.Len(t, logs, 2) {
+		assert.Equal(t, "info", logs[0]["level"])
+		assert.Equal(t, "request", logs[0]["message"])
+		assert.Equal(t, "GET", logs[0]["method"])
+		assert.Equal(t, "/tenants/1?full=true", logs[0]["uri"])
+		assert.Equal(t, "/tenants/:id", logs[0]["route"])
+		assert.Equal(t, float64(http.StatusOK), logs[0]["status"])
+		assert.Equal(t, float64(len("found")), logs[0]["bytesOut"])
+		assert.Equal(t, "guest", logs[0]["subject"])
+		assert.Equal(t, "tenant-1", logs[0]["tenant"])
+		assert.Contains(t, logs[0], "latency")
+
+		assert.Equal(t, "warn", logs[1]["level"])
+		assert.Equal(t, float64(http.StatusNotFound), logs[1]["status"])
+		assert.NotContains(t, logs[1], "subject")
+	}
+}
+
+func TestEchoLogger(t *testing.T) {
+	var output bytes.Buffer
+	logger := NewEchoLogger(zerolog.New(&output))
+	logger.SetLevel(log.WARN)
+
+	logger.Infof("hidden %d", 1)
+	logger.Warnf("shown %d", 2)
+	logger.Errorj(log.JSON{"tenant": "tenant-1"})
+
+	logs := lines(t, &output)
+
+	// Assertions
+	assert.Equal(t, zerolog.WarnLevel, FromEcho(logger).GetLevel())
+	if assert.Len(t, logs, 2) {
+		assert.Equal(t, "shown 2", logs[0]["message"])
+		assert.Equal(t, "error", logs[1]["level"])
+		assert.Equal(t, "tenant-1", logs[1]["tenant"])
+	}
+}
+
+func TestGormLogger(t *testing.T) {
+	var output bytes.Buffer
+	logger := NewGormLogger(zerolog.New(&output).Level(zerolog.InfoLevel))
+	query := func() (string, int64) {
+		return "SELECT 1", 1
+	}
+
+	logger.Trace(context.Background(), time.Now(), query, nil)
+	logger.Trace(context.Background(), time.Now(), query, gorm.ErrRecordNotFound)
+	logger.Trace(context.Background(), time.Now(), query, errors.New("broken"))
+	logger.Trace(context.Background(), time.Now().Add(-time.Second), query, nil)
+	logger.LogMode(gormLogger.Silent).Trace(context.Background(), time.Now(), query, errors.New("silenced"))
+
+	logs := lines(t, &output)
+
+	// Assertions
+	if assert.Len(t, logs, 2) {
+		assert.Equal(t, "error", logs[0]["level"])
+		assert.Equal(t, "broken", logs[0]["error"])
+		assert.Equal(t, "SELECT 1", logs[0]["sql"])
+		assert.Equal(t, "warn", logs[1]["level"])
+		assert.Equal(t, true, logs[1]["slow"])
+	}
+}
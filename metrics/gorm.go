@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+	"time"
+)
+
+const startKey = "metrics:start"
+
+// gormPlugin times the queries of a gorm client.
+type gormPlugin struct{}
+
+// InstrumentDB is used to time the queries of a gorm client and collect the stats of its connection pool, under name.
+// A client opened again under the same name replaces the previous one in the stats.
+func InstrumentDB(name string, db *gorm.DB) error {
+	err := db.Use(gormPlugin{})
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	collector := collectors.NewDBStatsCollector(sqlDB, name)
+	err = Registry.Register(collector)
+
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		Registry.Unregister(registered.ExistingCollector)
+		return Registry.Register(collector)
+	}
+	return err
+}
+
+func (gormPlugin) Name() string {
+	return "metrics"
+}
+
+// Initialize is used by gorm to register the callbacks timing each kind of operation.
+func (gormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register("metrics:before_create", start),
+		callbacks.Create().After("gorm:create").Register("metrics:after_create", observe("create")),
+		callbacks.Query().Before("gorm:query").Register("metrics:before_query", start),
+		callbacks.Query().After("gorm:query").Register("metrics:after_query", observe("query")),
+		callbacks.Update().Before("gorm:update").Register("metrics:before_update", start),
+		callbacks.Update().After("gorm:update").Register("metrics:after_update", observe("update")),
+		callbacks.Delete().Before("gorm:delete").Register("metrics:before_delete", start),
+		callbacks.Delete().After("gorm:delete").Register("metrics:after_delete", observe("delete")),
+		callbacks.Row().Before("gorm:row").Register("metrics:before_row", start),
+		callbacks.Row().After("gorm:row").Register("metrics:after_row", observe("row")),
+		callbacks.Raw().Before("gorm:raw").Register("metrics:before_raw", start),
+		callbacks.Raw().After("gorm:raw").Register("metrics:after_raw", observe("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func start(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func observe(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		started, found := db.InstanceGet(startKey)
+		if !found {
+			return
+		}
+
+		DBQueryDuration.WithLabelValues(operation, db.Statement.Table).Observe(time.Since(started.(time.Time)).Seconds())
+	}
+}
@@ -0,0 +1,137 @@
+// Package metrics holds the Prometheus collectors of every component, served on /metrics.
+package metrics
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"strconv"
+	"time"
+)
+
+// Registry holds the collectors of the app, along with the Go runtime and process ones.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts the answered requests, by method, route and status.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Answered HTTP requests, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes the time taken to answer requests, by method, route and status.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to answer HTTP requests, by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// RateLimitDenials counts the requests denied by the rate limiter.
+	RateLimitDenials = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "http_rate_limit_denials_total",
+		Help: "HTTP requests denied by the rate limiter.",
+	})
+
+	// CacheRequests counts the cache reads, by cache and result: hit or miss.
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "Cache reads, by cache and result: hit or miss.",
+	}, []string{"cache", "result"})
+
+	// DBQueryDuration observes the time taken by the database queries, by operation and table.
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Time taken by the database queries, by operation and table.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "table"})
+
+	// AMQPPublishDuration observes the time taken to publish messages, and to have them confirmed by the server.
+	AMQPPublishDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "amqp_publish_duration_seconds",
+		Help:    "Time taken to publish AMQP messages (publish) and to have them confirmed (confirm).",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"stage"})
+
+	// AMQPReconnects counts the connections made to the AMQP server after the first one.
+	AMQPReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "amqp_reconnects_total",
+		Help: "Connections made to the AMQP server after the first one.",
+	})
+
+	// AMQPConsumedMessages counts the consumed messages, by outcome: ack, nack or reject.
+	AMQPConsumedMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "amqp_consumed_messages_total",
+		Help: "Consumed AMQP messages, by outcome: ack, nack or reject.",
+	}, []string{"outcome"})
+
+	// TaskTransitions counts the tasks pushed in each status.
+	TaskTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "task_transitions_total",
+		Help: "Tasks pushed in each status.",
+	}, []string{"status"})
+
+	// OutboxPending is the number of outbox messages waiting to be published, as last seen by the relay.
+	OutboxPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "outbox_pending_messages",
+		Help: "Outbox messages waiting to be published.",
+	})
+
+	// WebhookDeliveries counts the webhook delivery attempts, by outcome: succeeded, retried or failed.
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_deliveries_total",
+		Help: "Webhook delivery attempts, by outcome: succeeded, retried or failed.",
+	}, []string{"outcome"})
+
+	// WebSocketConnections is the number of open WebSocket connections.
+	WebSocketConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_connections",
+		Help: "Open WebSocket connections.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		RateLimitDenials,
+		CacheRequests,
+		DBQueryDuration,
+		AMQPPublishDuration,
+		AMQPReconnects,
+		AMQPConsumedMessages,
+		TaskTransitions,
+		OutboxPending,
+		WebhookDeliveries,
+		WebSocketConnections,
+	)
+}
+
+// Handler is used to serve the collected metrics.
+func Handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+}
+
+// Middleware is used to count and time the requests by route, so path parameters don't make new series.
+// Errors are answered here, as the access log does, so the status counted is the one sent.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			labels := prometheus.Labels{
+				"method": c.Request().Method,
+				"route":  c.Path(),
+				"status": strconv.Itoa(c.Response().Status),
+			}
+			HTTPRequests.With(labels).Inc()
+			HTTPRequestDuration.With(labels).Observe(time.Since(start).Seconds())
+			return nil
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/metrics", Handler())
+	e.GET("/tenants/:id", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "unknown tenant")
+	})
+
+	for _, id := range []string{"1", "2"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/tenants/"+id, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	// Assertions
+	assert.Equal(t, float64(2), testutil.ToFloat64(HTTPRequests.WithLabelValues(http.MethodGet, "/tenants/:id", "404")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `http_requests_total{method="GET",route="/tenants/:id",status="404"} 2`)
+	assert.Contains(t, rec.Body.String(), `http_request_duration_seconds_count{method="GET",route="/tenants/:id",status="404"} 2`)
+	assert.Contains(t, rec.Body.String(), "go_goroutines")
+}
+
+func TestInstrumentDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:metrics?mode=memory"), &gorm.Config{})
+	assert.NoError(t, err)
+
+	type sample struct {
+		ID   uint
+		Name string
+	}
+
+	err = InstrumentDB("metrics", db)
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&sample{}))
+	assert.NoError(t, db.Create(&sample{Name: "first"}).Error)
+	assert.NoError(t, db.Find(&[]sample{}).Error)
+
+	// Assertions
+	count, err := testutil.GatherAndCount(Registry, "go_sql_open_connections")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	rec := httptest.NewRecorder()
+	assert.NoError(t, Handler()(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/metrics", nil), rec)))
+	assert.Contains(t, rec.Body.String(), `db_query_duration_seconds_count{operation="create",table="samples"} 1`)
+	assert.Contains(t, rec.Body.String(), `db_query_duration_seconds_count{operation="query",table="samples"} 1`)
+}
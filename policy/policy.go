@@ -1,22 +1,39 @@
 package policy
 
 import (
+	"context"
+	"errors"
 	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/rbac/default-role-manager"
 	"github.com/casbin/casbin/v2/util"
 	gormadapter "github.com/casbin/gorm-adapter/v3"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/config"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/audit"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
 	"gorm.io/gorm"
-	"log"
+)
+
+// PurgeAction is the policy action checked for hard deletes, as they share the DELETE method.
+const PurgeAction = "PURGE"
+
+var (
+	// ErrPolicyExists is returned when granting a policy which already exists.
+	ErrPolicyExists = errors.New("policy already exists")
+	// ErrPolicyNotFound is returned when revoking a policy which doesn't exist.
+	ErrPolicyNotFound = errors.New("policy not found")
 )
 
 // InitPolicy is used to initialise all policy manager needs to function.
 func InitPolicy(gormClient *gorm.DB) (*casbin.Enforcer, error) {
+	logger := logging.Component("policy")
+
 	// Initialize a Gorm adapter and use it in a Casbin enforcer:
 	// The adapter will use the MySQL database named "casbin".
 	// If it doesn't exist, the adapter will create it automatically.
 	casbinGormAdapter, err := gormadapter.NewAdapterByDB(gormClient) // Your driver and data source.
 	if err != nil {
-		log.Fatal(err)
+		logger.Error().Err(err).Msg("Error initialising policy")
 		return nil, err
 	}
 
@@ -25,77 +42,180 @@ func InitPolicy(gormClient *gorm.DB) (*casbin.Enforcer, error) {
 	roleManager.AddMatchingFunc("KeyMatch2", util.KeyMatch2)
 
 	// Create Policy enforcer with our customized model.
-	policyEnforcer, err := casbin.NewEnforcer("config/keymatch_model", casbinGormAdapter)
+	policyModel, err := model.NewModelFromString(config.PolicyModel)
 	if err != nil {
-		log.Fatal(err)
+		logger.Error().Err(err).Msg("Error initialising policy")
+		return nil, err
+	}
+
+	policyEnforcer, err := casbin.NewEnforcer(policyModel, casbinGormAdapter)
+	if err != nil {
+		logger.Error().Err(err).Msg("Error initialising policy")
 		return nil, err
 	}
 
 	policyEnforcer.SetRoleManager(roleManager)
 
-	// Logs for casbin.
+	// Logs for casbin, written at the debug level of the policy component.
+	policyEnforcer.SetLogger(logging.NewCasbinLogger(logger))
 	policyEnforcer.EnableLog(true)
 
 	// Load the policy from DB.
 	err = policyEnforcer.LoadPolicy()
 	if err != nil {
-		log.Fatal(err)
+		logger.Error().Err(err).Msg("Error initialising policy")
 		return nil, err
 	}
 
 	// Save the policy back to DB.
 	err = policyEnforcer.SavePolicy()
 	if err != nil {
-		log.Fatal(err)
+		logger.Error().Err(err).Msg("Error initialising policy")
 		return nil, err
 	}
 
 	return policyEnforcer, nil
 }
 
-// AddCreatePolicy is used to add policy for specified user.
-func AddCreatePolicy(policyEnforcer *casbin.Enforcer, user string, url string) {
-	isAdded, err := policyEnforcer.AddPolicy(user, url, "POST")
+// Grant is used to allow subject to run action on object, and record it in the audit trail
+// with the actor carried by ctx, on the database client ctx carries.
+func Grant(ctx context.Context, policyEnforcer *casbin.Enforcer, subject string, object string, action string) error {
+	// Checked first, as adding an existing policy isn't reported by casbin.
+	exists, err := policyEnforcer.HasPolicy(subject, object, action)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrPolicyExists
+	}
+
+	_, err = policyEnforcer.AddPolicy(subject, object, action)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	log.Printf("Added policy create with result: %t", isAdded)
+
+	return recordPolicy(ctx, audit.ActionPolicyAdd, audit.Change{After: []string{subject, object, action}})
 }
 
-// AddUpdatePolicy is used to add policy for specified user.
-func AddUpdatePolicy(policyEnforcer *casbin.Enforcer, user string, url string) {
-	isAdded, err := policyEnforcer.AddPolicy(user, url, "PUT")
+// Revoke is used to remove the policy allowing subject to run action on object, and record it in the audit trail
+// with the actor carried by ctx, on the database client ctx carries.
+func Revoke(ctx context.Context, policyEnforcer *casbin.Enforcer, subject string, object string, action string) error {
+	removed, err := policyEnforcer.RemovePolicy(subject, object, action)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	log.Printf("Added policy update with result: %t", isAdded)
+	if !removed {
+		return ErrPolicyNotFound
+	}
+
+	return recordPolicy(ctx, audit.ActionPolicyRemove, audit.Change{Before: []string{subject, object, action}})
+}
+
+// recordPolicy is used to append a policy change to the audit trail.
+// The casbin adapter writes on its own, so the change is recorded once it is stored.
+func recordPolicy(ctx context.Context, action string, change audit.Change) error {
+	entry := audit.ModelAuditEntry{}
+	return entry.WithContext(ctx).Record(action, "", audit.Changes{"policy": change})
+}
+
+// AddCreatePolicy is used to add policy for specified user.
+func AddCreatePolicy(policyEnforcer *casbin.Enforcer, user string, url string) {
+	isAdded, err := policyEnforcer.AddPolicy(user, url, "POST")
+	logAddedPolicy("create", isAdded, err)
+}
+
+// AddUpdatePolicy is used to add policy for specified user, covering full (PUT) and partial (PATCH) updates.
+func AddUpdatePolicy(policyEnforcer *casbin.Enforcer, user string, url string) {
+	isAdded, err := policyEnforcer.AddPolicy(user, url+"/:id", "PUT|PATCH")
+	logAddedPolicy("update", isAdded, err)
 }
 
 // AddDeletePolicy is used to add policy for specified user.
 func AddDeletePolicy(policyEnforcer *casbin.Enforcer, user string, url string) {
 	isAdded, err := policyEnforcer.AddPolicy(user, url+"/:id", "DELETE")
-	if err != nil {
-		log.Fatal(err)
+	logAddedPolicy("delete", isAdded, err)
+}
+
+// AddPurgePolicy is used to add policy for specified user.
+func AddPurgePolicy(policyEnforcer *casbin.Enforcer, user string, url string) {
+	isAdded, err := policyEnforcer.AddPolicy(user, url+"/:id", PurgeAction)
+	logAddedPolicy("purge", isAdded, err)
+}
+
+// AddRestorePolicy is used to add policy for specified user.
+func AddRestorePolicy(policyEnforcer *casbin.Enforcer, user string, url string) {
+	isAdded, err := policyEnforcer.AddPolicy(user, url+"/:id/restore", "POST")
+	logAddedPolicy("restore", isAdded, err)
+}
+
+// AddStatusPolicy is used to add policy for specified user.
+func AddStatusPolicy(policyEnforcer *casbin.Enforcer, user string, url string) {
+	for _, transition := range []string{"suspend", "activate"} {
+		isAdded, err := policyEnforcer.AddPolicy(user, url+"/:id/"+transition, "POST")
+		logAddedPolicy(transition, isAdded, err)
 	}
-	log.Printf("Added policy delete with result: %t", isAdded)
+}
+
+// AddBatchPolicy is used to add policy for specified user.
+// A batch can delete tenants, so it should only be granted along with AddDeletePolicy.
+func AddBatchPolicy(policyEnforcer *casbin.Enforcer, user string, url string) {
+	isAdded, err := policyEnforcer.AddPolicy(user, url+":batch", "POST")
+	logAddedPolicy("batch", isAdded, err)
+}
+
+// AddImportPolicy is used to add policy for specified user.
+// Exports are read through the /:id rule added by AddGetPolicy.
+func AddImportPolicy(policyEnforcer *casbin.Enforcer, user string, url string) {
+	isAdded, err := policyEnforcer.AddPolicy(user, url+"/import", "POST")
+	logAddedPolicy("import", isAdded, err)
 }
 
 // AddGetPolicy is used to add policy for specified user.
 func AddGetPolicy(policyEnforcer *casbin.Enforcer, user string, url string) {
 	isAdded, err := policyEnforcer.AddPolicy(user, url, "GET")
-	if err != nil {
-		log.Fatal(err)
-	}
-	log.Printf("Added policy get with result: %t", isAdded)
+	logAddedPolicy("get", isAdded, err)
 
 	AddGetByIDPolicy(policyEnforcer, user, url+"/:id")
 }
 
+// AddAuditPolicy is used to add policy for specified user, to read and export the audit trail.
+func AddAuditPolicy(policyEnforcer *casbin.Enforcer, user string) {
+	for _, url := range []string{"/audit", "/audit/export"} {
+		isAdded, err := policyEnforcer.AddPolicy(user, url, "GET")
+		logAddedPolicy("audit", isAdded, err)
+	}
+}
+
+// AddWebhookPolicy is used to add policy for specified user, to manage the webhook subscriptions,
+// read their delivery log and redeliver their events.
+func AddWebhookPolicy(policyEnforcer *casbin.Enforcer, user string) {
+	rules := [][2]string{
+		{"/webhooks", "GET"},
+		{"/webhooks", "POST"},
+		{"/webhooks/:id", "GET"},
+		{"/webhooks/:id", "PUT"},
+		{"/webhooks/:id", "DELETE"},
+		{"/webhooks/:id/deliveries", "GET"},
+		{"/webhooks/:id/deliveries/:delivery/redeliver", "POST"},
+	}
+
+	for _, rule := range rules {
+		isAdded, err := policyEnforcer.AddPolicy(user, rule[0], rule[1])
+		logAddedPolicy("webhook", isAdded, err)
+	}
+}
+
 // AddGetByIDPolicy is used to add policy for specified user.
 func AddGetByIDPolicy(policyEnforcer *casbin.Enforcer, user string, url string) {
 	isAdded, err := policyEnforcer.AddPolicy(user, url, "GET")
+	logAddedPolicy("by id", isAdded, err)
+}
+
+// logAddedPolicy is used to log the result of adding a policy, the app can't run without its policies.
+func logAddedPolicy(name string, isAdded bool, err error) {
+	logger := logging.Component("policy")
 	if err != nil {
-		log.Fatal(err)
+		logger.Fatal().Err(err).Str("policy", name).Msg("Error adding policy")
 	}
-	log.Printf("Added policy by id with result: %t", isAdded)
+	logger.Info().Str("policy", name).Bool("added", isAdded).Msg("Added policy")
 }
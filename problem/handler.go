@@ -0,0 +1,140 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// TranslateFunc is used to write the message of a failed validation rule in the language of the request.
+type TranslateFunc func(c echo.Context, validationError validator.FieldError) string
+
+// HTTPErrorHandler is the echo error handler, every error is answered with a problem+json body.
+// Validation messages are always in English, see NewHTTPErrorHandler to translate them.
+var HTTPErrorHandler = NewHTTPErrorHandler(nil)
+
+// NewHTTPErrorHandler is used to create an echo error handler answering every error with a problem+json body,
+// the messages of the failed validation rules are written by translate when it isn't nil.
+func NewHTTPErrorHandler(translate TranslateFunc) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		problemError := From(err)
+		if problemError.Status >= http.StatusInternalServerError {
+			c.Logger().Error(err.Error())
+		}
+
+		if translate != nil {
+			problemError = translated(c, problemError, translate)
+		}
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(problemError.Status)
+		} else {
+			err = Write(c, problemError)
+		}
+
+		if err != nil {
+			c.Logger().Error(err.Error())
+		}
+	}
+}
+
+// translated is used to copy the problem with the messages of its failed validation rules translated.
+func translated(c echo.Context, problemError *Error, translate TranslateFunc) *Error {
+	if len(problemError.Fields) == 0 {
+		return problemError
+	}
+
+	translatedError := *problemError
+	translatedError.Fields = make([]FieldError, len(problemError.Fields))
+	for i, field := range problemError.Fields {
+		if field.source != nil {
+			field.Message = translate(c, field.source)
+		}
+		translatedError.Fields[i] = field
+	}
+	return &translatedError
+}
+
+// Write is used to answer with the problem of the given error.
+func Write(c echo.Context, problemError *Error) error {
+	body, err := json.Marshal(Problem{
+		Type:      problemError.Type,
+		Title:     problemError.Title,
+		Status:    problemError.Status,
+		Detail:    problemError.Detail,
+		Instance:  c.Request().URL.Path,
+		RequestID: requestID(c),
+		Errors:    problemError.Fields,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.Blob(problemError.Status, MIMEApplicationProblemJSON, body)
+}
+
+// From is used to find the problem matching any error, unknown errors are internal ones.
+func From(err error) *Error {
+	var problemError *Error
+	if errors.As(err, &problemError) {
+		return problemError
+	}
+
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		return Validation("the request has invalid fields", fieldErrors(validationErrors)...)
+	}
+
+	var httpError *echo.HTTPError
+	if errors.As(err, &httpError) {
+		return fromHTTPError(httpError)
+	}
+
+	return Internal(err)
+}
+
+// fromHTTPError is used for the errors raised by echo itself and its middlewares.
+func fromHTTPError(httpError *echo.HTTPError) *Error {
+	detail := fmt.Sprint(httpError.Message)
+
+	switch httpError.Code {
+	case http.StatusBadRequest:
+		return BadRequest(detail)
+	case http.StatusUnauthorized:
+		return Unauthorized(detail)
+	case http.StatusForbidden:
+		return Forbidden(detail)
+	case http.StatusNotFound:
+		return NotFound(detail)
+	case http.StatusConflict:
+		return Conflict(detail)
+	case http.StatusPreconditionFailed:
+		return PreconditionFailed(detail)
+	case http.StatusUnsupportedMediaType:
+		return UnsupportedMediaType(detail)
+	case http.StatusUnprocessableEntity:
+		return Unprocessable(detail)
+	}
+
+	if httpError.Code >= http.StatusInternalServerError {
+		return Internal(httpError)
+	}
+
+	// Statuses without a domain meaning, such as 405 or 429, keep the generic problem type.
+	return &Error{Type: "about:blank", Title: http.StatusText(httpError.Code), Status: httpError.Code, Detail: detail}
+}
+
+// requestID is used to find the request ID, set on the response by a request ID middleware or sent by the client.
+func requestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
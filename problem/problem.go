@@ -0,0 +1,130 @@
+// Package problem turns handler errors into RFC 7807 application/problem+json responses.
+package problem
+
+import (
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+// MIMEApplicationProblemJSON is the media type of the error responses.
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// Problem types, relative to the API root.
+const (
+	TypeBadRequest           = "/problems/bad-request"
+	TypeValidation           = "/problems/validation"
+	TypeUnauthorized         = "/problems/unauthorized"
+	TypeForbidden            = "/problems/forbidden"
+	TypeNotFound             = "/problems/not-found"
+	TypeConflict             = "/problems/conflict"
+	TypePreconditionFailed   = "/problems/precondition-failed"
+	TypeUnsupportedMediaType = "/problems/unsupported-media-type"
+	TypeUnprocessable        = "/problems/unprocessable"
+	TypeTooManyRequests      = "/problems/too-many-requests"
+	TypeInternal             = "/problems/internal"
+)
+
+type (
+	// Problem is the application/problem+json response body.
+	Problem struct {
+		Type      string       `json:"type"`
+		Title     string       `json:"title"`
+		Status    int          `json:"status"`
+		Detail    string       `json:"detail,omitempty"`
+		Instance  string       `json:"instance,omitempty"`
+		RequestID string       `json:"requestId,omitempty"`
+		Errors    []FieldError `json:"errors,omitempty"`
+	}
+
+	// FieldError is a request field which failed a validation rule.
+	FieldError struct {
+		Field   string `json:"field"`
+		Rule    string `json:"rule"`
+		Param   string `json:"param,omitempty"`
+		Message string `json:"message"`
+		// source is the failed validator rule, kept to translate the message when the problem is written.
+		source validator.FieldError
+	}
+
+	// Error is a domain error, the error handler answers it with its problem.
+	Error struct {
+		Type   string
+		Title  string
+		Status int
+		Detail string
+		Fields []FieldError
+		// Err is the cause, logged but never shown to the client.
+		Err error
+	}
+)
+
+func (e *Error) Error() string {
+	message := e.Detail
+	if message == "" {
+		message = e.Title
+	}
+
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// BadRequest is used for requests which can't be read, such as malformed JSON or path parameters.
+func BadRequest(detail string) *Error {
+	return &Error{Type: TypeBadRequest, Title: "Bad request", Status: http.StatusBadRequest, Detail: detail}
+}
+
+// Validation is used for requests which were read but break the validation rules.
+func Validation(detail string, fields ...FieldError) *Error {
+	return &Error{Type: TypeValidation, Title: "Validation failed", Status: http.StatusUnprocessableEntity, Detail: detail, Fields: fields}
+}
+
+// Unauthorized is used for requests without valid credentials.
+func Unauthorized(detail string) *Error {
+	return &Error{Type: TypeUnauthorized, Title: "Unauthorized", Status: http.StatusUnauthorized, Detail: detail}
+}
+
+// Forbidden is used for requests the caller isn't allowed to make.
+func Forbidden(detail string) *Error {
+	return &Error{Type: TypeForbidden, Title: "Forbidden", Status: http.StatusForbidden, Detail: detail}
+}
+
+// NotFound is used when the requested resource doesn't exist.
+func NotFound(detail string) *Error {
+	return &Error{Type: TypeNotFound, Title: "Resource not found", Status: http.StatusNotFound, Detail: detail}
+}
+
+// Conflict is used when the request clashes with the current state of the resource.
+func Conflict(detail string) *Error {
+	return &Error{Type: TypeConflict, Title: "Conflict", Status: http.StatusConflict, Detail: detail}
+}
+
+// PreconditionFailed is used when a conditional request header doesn't match.
+func PreconditionFailed(detail string) *Error {
+	return &Error{Type: TypePreconditionFailed, Title: "Precondition failed", Status: http.StatusPreconditionFailed, Detail: detail}
+}
+
+// UnsupportedMediaType is used when the request body isn't sent in an accepted format.
+func UnsupportedMediaType(detail string) *Error {
+	return &Error{Type: TypeUnsupportedMediaType, Title: "Unsupported media type", Status: http.StatusUnsupportedMediaType, Detail: detail}
+}
+
+// Unprocessable is used for well formed requests which can't be processed as they are.
+func Unprocessable(detail string) *Error {
+	return &Error{Type: TypeUnprocessable, Title: "Unprocessable request", Status: http.StatusUnprocessableEntity, Detail: detail}
+}
+
+// TooManyRequests is used when the client has used up its rate limit.
+func TooManyRequests(detail string) *Error {
+	return &Error{Type: TypeTooManyRequests, Title: "Too many requests", Status: http.StatusTooManyRequests, Detail: detail}
+}
+
+// Internal is used for unexpected failures, err is logged but not shown to the client.
+func Internal(err error) *Error {
+	return &Error{Type: TypeInternal, Title: "Internal server error", Status: http.StatusInternalServerError, Err: err}
+}
@@ -0,0 +1,138 @@
+package problem
+
+import (
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type tenantRequest struct {
+	Name  string `json:"name" validate:"required"`
+	Plan  string `json:"plan" validate:"omitempty,oneof=free pro"`
+	Email string `json:"email" validate:"omitempty,email"`
+}
+
+func serveError(err error, method string, requestID string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(method, "/tenants/42", nil)
+	if requestID != "" {
+		req.Header.Set(echo.HeaderXRequestID, requestID)
+	}
+	rec := httptest.NewRecorder()
+	HTTPErrorHandler(err, e.NewContext(req, rec))
+	return rec
+}
+
+func TestDomainErrors(t *testing.T) {
+	rec := serveError(NotFound("tenant not found in database"), http.MethodGet, "request-1")
+
+	// Assertions
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+	assert.JSONEq(t, `{"type":"/problems/not-found","title":"Resource not found","status":404,"detail":"tenant not found in database","instance":"/tenants/42","requestId":"request-1"}`, rec.Body.String())
+
+	for err, status := range map[error]int{
+		BadRequest("bad"):           http.StatusBadRequest,
+		Validation("invalid"):       http.StatusUnprocessableEntity,
+		Unauthorized("who"):         http.StatusUnauthorized,
+		Forbidden("no"):             http.StatusForbidden,
+		Conflict("again"):           http.StatusConflict,
+		PreconditionFailed("stale"): http.StatusPreconditionFailed,
+		UnsupportedMediaType("xml"): http.StatusUnsupportedMediaType,
+		Unprocessable("different"):  http.StatusUnprocessableEntity,
+	} {
+		assert.Equal(t, status, serveError(err, http.MethodGet, "").Code, err.Error())
+	}
+
+	// Wrapped domain errors keep their problem.
+	wrapped := errors.Join(errors.New("context"), Conflict("again"))
+	assert.Equal(t, http.StatusConflict, From(wrapped).Status)
+}
+
+func TestInternalErrorsAreHidden(t *testing.T) {
+	rec := serveError(errors.New("pq: connection refused"), http.MethodGet, "")
+
+	// Assertions
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/internal","title":"Internal server error","status":500,"instance":"/tenants/42"}`, rec.Body.String())
+
+	rec = serveError(NotFound("gone"), http.MethodHead, "")
+
+	// Assertions
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestEchoErrors(t *testing.T) {
+	rec := serveError(echo.ErrMethodNotAllowed, http.MethodGet, "")
+
+	// Assertions
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.JSONEq(t, `{"type":"about:blank","title":"Method Not Allowed","status":405,"detail":"Method Not Allowed","instance":"/tenants/42"}`, rec.Body.String())
+
+	rec = serveError(echo.NewHTTPError(http.StatusBadRequest, "Syntax error: offset=1"), http.MethodGet, "")
+
+	// Assertions
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"type":"/problems/bad-request"`)
+
+	rec = serveError(echo.NewHTTPError(http.StatusServiceUnavailable, "database is down"), http.MethodGet, "")
+
+	// Assertions
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "database is down")
+}
+
+func TestValidationErrors(t *testing.T) {
+	err := validator.New().Struct(tenantRequest{Plan: "gold", Email: "nope"})
+	rec := serveError(err, http.MethodPost, "")
+
+	// Assertions
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.JSONEq(t, `{"type":"/problems/validation","title":"Validation failed","status":422,"detail":"the request has invalid fields","instance":"/tenants/42","errors":[
+		{"field":"Name","rule":"required","message":"is required"},
+		{"field":"Plan","rule":"oneof","param":"free pro","message":"must be one of: free, pro"},
+		{"field":"Email","rule":"email","message":"must be a valid email address"}
+	]}`, rec.Body.String())
+
+	fields := Fields(err, "tenant.")
+	if assert.Len(t, fields, 3) {
+		assert.Equal(t, "tenant.Name", fields[0].Field)
+	}
+
+	fields = Fields(Validation("invalid", FieldError{Field: "slug", Rule: "slug", Message: "is invalid"}), "operations[0].")
+	if assert.Len(t, fields, 1) {
+		assert.Equal(t, "operations[0].slug", fields[0].Field)
+	}
+
+	assert.Nil(t, Fields(errors.New("not a validation error"), ""))
+}
+
+func TestTranslatedValidationErrors(t *testing.T) {
+	translate := func(c echo.Context, validationError validator.FieldError) string {
+		return c.Request().Header.Get("Accept-Language") + ": " + validationError.Tag()
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/tenants", nil)
+	req.Header.Set("Accept-Language", "fr")
+	rec := httptest.NewRecorder()
+	err := Validation("invalid tenant", Fields(validator.New().Struct(tenantRequest{}), "tenant.")...)
+	NewHTTPErrorHandler(translate)(err, e.NewContext(req, rec))
+
+	// Assertions
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), `{"field":"tenant.Name","rule":"required","message":"fr: required"}`)
+
+	// Fields added by hand have no rule to translate, their message is kept.
+	rec = httptest.NewRecorder()
+	err = Validation("invalid slug", FieldError{Field: "slug", Rule: "slug", Message: "is invalid"})
+	NewHTTPErrorHandler(translate)(err, e.NewContext(req, rec))
+
+	// Assertions
+	assert.Contains(t, rec.Body.String(), `{"field":"slug","rule":"slug","message":"is invalid"}`)
+}
@@ -0,0 +1,74 @@
+package problem
+
+import (
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/validation"
+	"strings"
+)
+
+// fieldErrors is used to describe every failed validation rule.
+func fieldErrors(validationErrors validator.ValidationErrors) []FieldError {
+	fields := make([]FieldError, 0, len(validationErrors))
+	for _, validationError := range validationErrors {
+		fields = append(fields, FieldError{
+			Field:   fieldName(validationError),
+			Rule:    validationError.Tag(),
+			Param:   validationError.Param(),
+			Message: fieldMessage(validationError),
+			source:  validationError,
+		})
+	}
+	return fields
+}
+
+// fieldName is used to name the field as in the request, without the name of the validated struct.
+func fieldName(validationError validator.FieldError) string {
+	namespace := validationError.Namespace()
+	if index := strings.Index(namespace, "."); index >= 0 {
+		return namespace[index+1:]
+	}
+	return validationError.Field()
+}
+
+// fieldMessage is used to explain a failed rule in plain words, the custom rules with their own message.
+func fieldMessage(validationError validator.FieldError) string {
+	if message, found := validation.Message(validationError.Tag()); found {
+		return message
+	}
+
+	switch validationError.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(validationError.Param(), " ", ", ")
+	case "max":
+		return "must be at most " + validationError.Param() + " long"
+	case "min":
+		return "must be at least " + validationError.Param() + " long"
+	}
+	return "failed on the " + validationError.Tag() + " rule"
+}
+
+// Fields is used to list the failed rules of a validation error, with the field names prefixed by prefix.
+// It is nil for the errors which aren't about request fields.
+func Fields(err error, prefix string) []FieldError {
+	var fields []FieldError
+
+	var problemError *Error
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &problemError) {
+		fields = append(fields, problemError.Fields...)
+	} else if errors.As(err, &validationErrors) {
+		fields = fieldErrors(validationErrors)
+	}
+
+	for i := range fields {
+		fields[i].Field = prefix + fields[i].Field
+	}
+	return fields
+}
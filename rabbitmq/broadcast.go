@@ -0,0 +1,203 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"github.com/NeowayLabs/wabbit"
+	libUUID "github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/tracing"
+	"time"
+)
+
+const (
+	// broadcastExchangeKind is the kind of the broadcast exchanges, every queue bound with
+	// broadcastBindingKey getting every message like on a fanout exchange, which the fake server lacks.
+	broadcastExchangeKind = "topic"
+	broadcastBindingKey   = "#"
+	broadcastRoutingKey   = "broadcast"
+)
+
+// Exchange is an exchange every subscriber gets all the messages of, through the connection of a client.
+type Exchange struct {
+	client *AMQPClient
+	name   string
+}
+
+// Exchange is used to broadcast messages on the exchange name, declared on first use.
+func (c *AMQPClient) Exchange(name string) *Exchange {
+	return &Exchange{client: c, name: name}
+}
+
+// Broadcast is used to send data to every subscriber of the exchange, on a channel of its own so the
+// confirmations of the pushed tasks aren't mixed with it. Nothing is kept for the replicas not subscribed.
+func (e *Exchange) Broadcast(ctx context.Context, data []byte) error {
+	c, exchange := e.client, e.name
+	if !c.isConnected.Load() {
+		return ErrDisconnected
+	}
+
+	headers := tracing.InjectAMQP(ctx, nil)
+
+	if c.isReal {
+		channel, err := c.connection.Channel()
+		if err != nil {
+			return err
+		}
+		defer channel.Close()
+
+		err = channel.ExchangeDeclare(exchange, broadcastExchangeKind, false, false, false, false, nil)
+		if err != nil {
+			return err
+		}
+
+		return channel.PublishWithContext(ctx, exchange, broadcastRoutingKey, false, false, amqp.Publishing{
+			ContentType: "application/json",
+			Headers:     headers,
+			Body:        data,
+		})
+	}
+
+	channel, err := c.falseConnection.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	err = channel.ExchangeDeclare(exchange, broadcastExchangeKind, nil)
+	if err != nil {
+		return err
+	}
+
+	return channel.Publish(exchange, broadcastRoutingKey, data, wabbit.Option{
+		"contentType": "application/json",
+		"headers":     headers,
+	})
+}
+
+// Subscribe is used to hand the messages broadcast on the exchange over to handle, in a queue of this client only,
+// until ctx is cancelled. It returns ErrDisconnected when the connection drops, so the caller can subscribe again.
+func (e *Exchange) Subscribe(ctx context.Context, handle func(data []byte)) error {
+	c, exchange := e.client, e.name
+	for !c.isConnected.Load() {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(1 * time.Second):
+		}
+	}
+
+	queue := exchange + "." + libUUID.NewString()
+
+	var deliveries <-chan []byte
+	var closeChannel func() error
+	if c.isReal {
+		channel, err := c.connection.Channel()
+		if err != nil {
+			return err
+		}
+		closeChannel = channel.Close
+
+		messages, err := c.subscribeReal(ctx, channel, exchange, queue)
+		if err != nil {
+			return errors.Join(err, channel.Close())
+		}
+		deliveries = messages
+	} else {
+		channel, err := c.falseConnection.Channel()
+		if err != nil {
+			return err
+		}
+		closeChannel = channel.Close
+
+		messages, err := c.subscribeFake(ctx, channel, exchange, queue)
+		if err != nil {
+			return errors.Join(err, channel.Close())
+		}
+		deliveries = messages
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return closeChannel()
+		case data, ok := <-deliveries:
+			if !ok {
+				return ErrDisconnected
+			}
+			handle(data)
+		}
+	}
+}
+
+// subscribeReal is used to consume the messages of exchange in an exclusive queue, dropped with the channel.
+func (c *AMQPClient) subscribeReal(ctx context.Context, channel *amqp.Channel, exchange string, queue string) (<-chan []byte, error) {
+	err := channel.ExchangeDeclare(exchange, broadcastExchangeKind, false, false, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = channel.QueueDeclare(queue, false, true, true, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = channel.QueueBind(queue, broadcastBindingKey, exchange, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := channel.Consume(queue, "", true, true, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	bodies := make(chan []byte)
+	go func() {
+		defer close(bodies)
+		for message := range messages {
+			select {
+			case bodies <- message.Body:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return bodies, nil
+}
+
+// subscribeFake is used to consume the messages of exchange on the fake server, which has no exclusive queues.
+func (c *AMQPClient) subscribeFake(ctx context.Context, channel wabbit.Channel, exchange string, queue string) (<-chan []byte, error) {
+	err := channel.ExchangeDeclare(exchange, broadcastExchangeKind, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = channel.QueueDeclare(queue, wabbit.Option{"durable": false, "autoDelete": true, "exclusive": true})
+	if err != nil {
+		return nil, err
+	}
+
+	err = channel.QueueBind(queue, broadcastBindingKey, exchange, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := channel.Consume(queue, "", wabbit.Option{"noAck": true})
+	if err != nil {
+		return nil, err
+	}
+
+	bodies := make(chan []byte)
+	go func() {
+		defer close(bodies)
+		for message := range messages {
+			select {
+			case bodies <- message.Body():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return bodies, nil
+}
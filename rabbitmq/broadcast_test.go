@@ -0,0 +1,50 @@
+package rabbitmq
+
+import (
+	"context"
+	"github.com/NeowayLabs/wabbit/amqptest/server"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// fakeClient is used to connect a client to the fake server at addr.
+func fakeClient(t *testing.T, addr string) *AMQPClient {
+	client := NewAMQPClient("events", "tasks", addr, zerolog.Nop(), make(chan bool, 1), make(chan []byte), false)
+	assert.Eventually(t, client.IsConnected, time.Second, 10*time.Millisecond)
+	return client
+}
+
+func TestBroadcast(t *testing.T) {
+	addr := "amqp://broadcast:5672/%2f"
+	fakeServer := server.NewServer(addr)
+	assert.NoError(t, fakeServer.Start())
+	defer fakeServer.Stop()
+
+	publisher := fakeClient(t, addr)
+	subscriber := fakeClient(t, addr)
+
+	received := make(chan []byte, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	subscribed := make(chan error)
+	go func() {
+		subscribed <- subscriber.Exchange("invalidations").Subscribe(ctx, func(data []byte) {
+			received <- data
+		})
+	}()
+
+	// Messages broadcast before the queue of the subscriber is bound aren't kept.
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, publisher.Exchange("invalidations").Broadcast(context.Background(), []byte("tenant:1")))
+		select {
+		case data := <-received:
+			return string(data) == "tenant:1"
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-subscribed)
+}
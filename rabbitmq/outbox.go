@@ -0,0 +1,82 @@
+package rabbitmq
+
+import (
+	"context"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog"
+	outboxModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/outbox"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/metrics"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/tracing"
+	"time"
+)
+
+// RunRelay is used to publish the task events of the outbox to the push queue, until ctx is cancelled.
+// It runs every interval and whenever a task event is committed, publishing up to batchSize events at a time,
+// and relays the events left once more when ctx is done. Its queries run on the database client ctx carries.
+func (c *TaskClient) RunRelay(ctx context.Context, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger := logging.Component("outbox")
+
+	for {
+		c.relay(ctx, batchSize, logger)
+
+		select {
+		case <-ctx.Done():
+			c.relay(context.WithoutCancel(ctx), batchSize, logger)
+			return
+		case <-ticker.C:
+		case <-c.wake:
+		}
+	}
+}
+
+// notifyRelay is used to wake the relay up once a task event is committed, without waiting for its interval.
+func (c *TaskClient) notifyRelay() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// relay is used to publish the pending events, a batch at a time, until none is left or the broker is unreachable.
+func (c *TaskClient) relay(ctx context.Context, batchSize int, logger zerolog.Logger) {
+	messageInstance := outboxModel.ModelMessage{}
+
+	for c.amqpClient.IsConnected() {
+		// The messages are claimed for longer than they can take to publish, so no other replica publishes them meanwhile.
+		lease := time.Duration(batchSize+1) * ConfirmTimeout
+		sent, err := messageInstance.WithContext(ctx).Relay(batchSize, lease, func(message outboxModel.ModelMessage) error {
+			return c.publish(ctx, message)
+		})
+		if err != nil {
+			logger.Error().Err(err).Msg("Error relaying the outbox")
+			break
+		}
+
+		// A short batch means the outbox is empty, or publishing failed and is retried on the next run.
+		if sent < batchSize {
+			break
+		}
+	}
+
+	pending, err := messageInstance.WithContext(ctx).CountPending()
+	if err != nil {
+		logger.Error().Err(err).Msg("Error counting the outbox messages")
+		return
+	}
+	metrics.OutboxPending.Set(float64(pending))
+}
+
+// publish is used to push an outbox message and wait for the broker to confirm it,
+// continuing the trace its headers carry.
+func (c *TaskClient) publish(ctx context.Context, message outboxModel.ModelMessage) error {
+	headers := amqp.Table{}
+	for key, value := range message.Headers {
+		headers[key] = value
+	}
+
+	return c.amqpClient.Push(tracing.ExtractAMQP(ctx, headers), message.Body, message.CorrelationID)
+}
@@ -0,0 +1,187 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/NeowayLabs/wabbit"
+	"github.com/NeowayLabs/wabbit/amqptest"
+	"github.com/NeowayLabs/wabbit/amqptest/server"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/config"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	outboxModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/outbox"
+	"testing"
+	"time"
+)
+
+func TestOutboxRelay(t *testing.T) {
+	addr := "amqp://outbox:5672/%2f"
+	fakeServer := server.NewServer(addr)
+	assert.NoError(t, fakeServer.Start())
+	defer fakeServer.Stop()
+
+	// SQLite fails the transactions of a shared cache locking each other, the relay and the test take turns on
+	// a single connection instead, to a file so the database outlives a connection dropped by a cancelled query.
+	db, err := database.Open(config.Database{Driver: config.DriverSQLite, Name: "outbox", DSN: t.TempDir() + "/outbox.db"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	sqlDB, err := db.DB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+	assert.NoError(t, db.AutoMigrate(&outboxModel.ModelMessage{}))
+	ctx := database.NewContext(context.Background(), db)
+
+	taskManager := NewTaskManagerClient(fakeClient(t, addr))
+	task := CreateNewTask([]string{"create", "tenant"}, "Creating tenant", "request-1")
+
+	// Events written in a rolled back transaction are never published.
+	err = database.Transaction(ctx, func(ctx context.Context) error {
+		assert.NoError(t, taskManager.CompleteTask(ctx, task))
+		return errors.New("rolled back")
+	})
+	assert.Error(t, err)
+	assert.NoError(t, taskManager.PushTask(ctx, task))
+
+	connection, err := amqptest.Dial(addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer connection.Close()
+	channel, err := connection.Channel()
+	if !assert.NoError(t, err) {
+		return
+	}
+	deliveries, err := channel.Consume("tasks", "outbox-test", wabbit.Option{"noAck": true})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	relayContext, stopRelay := context.WithCancel(ctx)
+	relayStopped := make(chan struct{})
+	go func() {
+		taskManager.RunRelay(relayContext, time.Hour, 10)
+		close(relayStopped)
+	}()
+
+	// Committed events wake the relay up.
+	err = database.Transaction(ctx, func(ctx context.Context) error {
+		return taskManager.CompleteTask(ctx, task)
+	})
+	assert.NoError(t, err)
+
+	var statuses []string
+	for len(statuses) < 2 {
+		select {
+		case delivery := <-deliveries:
+			var published Task
+			assert.NoError(t, json.Unmarshal(delivery.Body(), &published))
+			assert.Equal(t, task.ID, published.ID)
+			statuses = append(statuses, published.Status)
+		case <-time.After(time.Second):
+			t.Fatal("task events not published")
+		}
+	}
+	assert.Equal(t, []string{"waiting", "completed"}, statuses)
+
+	stopRelay()
+	<-relayStopped
+
+	var messages []outboxModel.ModelMessage
+	assert.NoError(t, db.Order("id").Find(&messages).Error)
+	if assert.Len(t, messages, 2) {
+		assert.NotNil(t, messages[0].SentAt)
+		assert.Equal(t, "request-1", messages[0].CorrelationID)
+		assert.Equal(t, 1, messages[1].Attempts)
+	}
+
+	// Failed publications are kept for the next run, in order.
+	_, err = (&outboxModel.ModelMessage{Body: []byte("{}")}).WithContext(ctx).Save()
+	assert.NoError(t, err)
+	sent, err := (&outboxModel.ModelMessage{}).WithContext(ctx).Relay(10, time.Minute, func(outboxModel.ModelMessage) error {
+		return ErrDisconnected
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	pending, err := (&outboxModel.ModelMessage{}).WithContext(ctx).CountPending()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), pending)
+	var failed outboxModel.ModelMessage
+	assert.NoError(t, db.Where("sent_at IS NULL").First(&failed).Error)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, ErrDisconnected.Error(), failed.LastError)
+
+	// The messages are published without holding the database, claimed so the other relays skip them.
+	sent, err = (&outboxModel.ModelMessage{}).WithContext(ctx).Relay(10, time.Minute, func(outboxModel.ModelMessage) error {
+		skipped, err := (&outboxModel.ModelMessage{}).WithContext(ctx).Relay(10, time.Minute, func(outboxModel.ModelMessage) error {
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Zero(t, skipped)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+}
+
+func TestProgressSkipsOutbox(t *testing.T) {
+	addr := "amqp://progress:5672/%2f"
+	fakeServer := server.NewServer(addr)
+	assert.NoError(t, fakeServer.Start())
+	defer fakeServer.Stop()
+
+	db, err := database.Open(config.Database{Driver: config.DriverSQLite, Name: "progress", DSN: t.TempDir() + "/progress.db"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	sqlDB, err := db.DB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer sqlDB.Close()
+	assert.NoError(t, db.AutoMigrate(&outboxModel.ModelMessage{}))
+	ctx := database.NewContext(context.Background(), db)
+
+	taskManager := NewTaskManagerClient(fakeClient(t, addr))
+	task := CreateNewTask([]string{"batch", "tenant"}, "Running tenant operations", "request-2")
+
+	connection, err := amqptest.Dial(addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer connection.Close()
+	channel, err := connection.Channel()
+	if !assert.NoError(t, err) {
+		return
+	}
+	deliveries, err := channel.Consume("tasks", "progress-test", wabbit.Option{"noAck": true})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Progress is published while the transaction of the task runs, and kept when it is rolled back.
+	err = database.Transaction(ctx, func(ctx context.Context) error {
+		assert.NoError(t, taskManager.UpdateTaskProgress(ctx, task, 0.5))
+
+		select {
+		case delivery := <-deliveries:
+			var published Task
+			assert.NoError(t, json.Unmarshal(delivery.Body(), &published))
+			assert.Equal(t, "running", published.Status)
+			assert.InDelta(t, 0.5, published.Progress, 0.001)
+		case <-time.After(time.Second):
+			t.Fatal("progress not published")
+		}
+		return errors.New("rolled back")
+	})
+	assert.Error(t, err)
+
+	pending, err := (&outboxModel.ModelMessage{}).WithContext(ctx).CountPending()
+	assert.NoError(t, err)
+	assert.Zero(t, pending)
+}
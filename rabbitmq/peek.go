@@ -0,0 +1,49 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// PeekTasks is used to read the task events waiting in queue without consuming them.
+// The messages are fetched unacknowledged and requeued together once read, so their order is kept.
+func PeekTasks(addr string, queue string) ([]Task, error) {
+	connection, err := amqp.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer connection.Close()
+
+	channel, err := connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	defer channel.Close()
+
+	queueState, err := channel.QueueDeclarePassive(queue, true, false, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []Task
+	var lastTag uint64
+	for i := 0; i < queueState.Messages; i++ {
+		message, found, getErr := channel.Get(queue, false)
+		if getErr != nil || !found {
+			err = getErr
+			break
+		}
+
+		lastTag = message.DeliveryTag
+		var task Task
+		if json.Unmarshal(message.Body, &task) == nil {
+			tasks = append(tasks, task)
+		}
+	}
+
+	if lastTag > 0 {
+		err = errors.Join(err, channel.Nack(lastTag, true, true))
+	}
+	return tasks, err
+}
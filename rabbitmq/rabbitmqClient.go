@@ -9,19 +9,39 @@ import (
 	"github.com/NeowayLabs/wabbit/amqptest"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/rs/zerolog"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/metrics"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	// ErrDisconnected the message error for disconnection
 	ErrDisconnected = errors.New("disconnected from rabbitmq, trying to reconnect")
+	// ErrNotConfirmed is returned when the broker rejects a message, or doesn't confirm it in time.
+	ErrNotConfirmed = errors.New("message not confirmed by rabbitmq")
 )
 
 const (
 	// When reconnecting to the server after connection failure
 	reconnectDelay = 5 * time.Second
+
+	// ConfirmTimeout is how long the broker is given to confirm a pushed message.
+	ConfirmTimeout = 5 * time.Second
+
+	// confirmBuffer is the number of confirmations kept while no push waits for them, such as those of the
+	// messages given up on, so the connection isn't blocked delivering them.
+	confirmBuffer = 64
+
+	// HeaderRequestID is the message header with the ID of the request which produced the message,
+	// also sent as the correlation ID.
+	HeaderRequestID = "x-request-id"
 )
 
 // AMQPClient holds necessery information for rabbitMQ
@@ -39,12 +59,18 @@ type AMQPClient struct {
 	notifyConfirm      chan amqp.Confirmation
 	falseNotifyClose   chan wabbit.Error
 	falseNotifyConfirm chan wabbit.Confirmation
-	isConnected        bool
-	alive              bool
-	threads            int
-	wg                 *sync.WaitGroup
-	activeConsumers    []string
-	messagesChannel    chan []byte
+	// isConnected is read by the probes and the relay while the reconnect loop writes it.
+	isConnected atomic.Bool
+	// alive is cleared by Close, to stop the reconnect loop.
+	alive   atomic.Bool
+	threads int
+	wg      *sync.WaitGroup
+	// pushLock serializes the pushes, for each one to wait for its own confirmation, and the channel changes.
+	pushLock sync.Mutex
+	// consumersLock guards activeConsumers, added by Stream and canceled by Close.
+	consumersLock   sync.Mutex
+	activeConsumers []string
+	messagesChannel chan []byte
 }
 
 // NewAMQPClient is a constructor that takes address, push and listen queue names, logger, and a amqpChannel that will notify rabbitmq client on server shutdown. We calculate the number of threads, create the client, and start the connection process. Connect method connects to the rabbitmq server and creates push/listen channels if they don't exist.
@@ -60,12 +86,13 @@ func NewAMQPClient(listenQueue, pushQueue, addr string, l zerolog.Logger, done c
 		threads:         threads,
 		doneChannel:     done,
 		pushQueue:       pushQueue,
-		alive:           true,
 		wg:              &sync.WaitGroup{},
 		messagesChannel: messages,
 		isReal:          isReal,
 	}
 
+	client.alive.Store(true)
+
 	if isReal {
 		client.wg.Add(threads)
 	} else {
@@ -80,29 +107,35 @@ func NewAMQPClient(listenQueue, pushQueue, addr string, l zerolog.Logger, done c
 // notifyClose, and then continuously attempt to reconnect.
 func (c *AMQPClient) handleReconnect(addr string) {
 	if c.isReal {
-		for c.alive {
+		var connections int
+		for c.alive.Load() {
 			var retryCount int
-			c.logger.Printf("Attempting to connect to rabbitMQ: %s", addr)
+			c.logger.Info().Msg("Attempting to connect to rabbitMQ")
 
-			c.isConnected = false
+			c.isConnected.Store(false)
 			t := time.Now()
 
 			for !c.connect(addr) {
-				if !c.alive {
+				if !c.alive.Load() {
 					return
 				}
 
 				select {
 				case <-c.doneChannel:
-					c.logger.Printf("Received something into done amqpChannel")
+					c.logger.Info().Msg("Received something into done amqpChannel")
 					return
 				case <-time.After(reconnectDelay + time.Duration(retryCount)*time.Second):
-					c.logger.Printf("disconnected from rabbitMQ and failed to connect")
+					c.logger.Warn().Int("retries", retryCount).Msg("disconnected from rabbitMQ and failed to connect")
 					retryCount++
 				}
 			}
 
-			c.logger.Printf("Connected to rabbitMQ in: %vms", time.Since(t).Milliseconds())
+			c.logger.Info().Dur("latency", time.Since(t)).Msg("Connected to rabbitMQ")
+			if connections > 0 {
+				metrics.AMQPReconnects.Inc()
+			}
+			connections++
+
 			select {
 			case <-c.doneChannel:
 				return
@@ -110,16 +143,16 @@ func (c *AMQPClient) handleReconnect(addr string) {
 			}
 		}
 	} else {
-		c.logger.Printf("Creating a fake client to rabbitMQ: %s", addr)
-		for c.alive {
-			c.logger.Printf("Attempting to connect to false rabbitMQ: %s", addr)
+		c.logger.Info().Msg("Creating a fake client to rabbitMQ")
+		for c.alive.Load() {
+			c.logger.Info().Msg("Attempting to connect to false rabbitMQ")
 
-			c.isConnected = false
+			c.isConnected.Store(false)
 			t := time.Now()
 
 			c.connect(addr)
 
-			c.logger.Printf("Connected to rabbitMQ in: %vms", time.Since(t).Milliseconds())
+			c.logger.Info().Dur("latency", time.Since(t)).Msg("Connected to rabbitMQ")
 			select {
 			case <-c.doneChannel:
 				return
@@ -135,19 +168,19 @@ func (c *AMQPClient) connect(addr string) bool {
 	if c.isReal {
 		conn, err := amqp.Dial(addr)
 		if err != nil {
-			c.logger.Printf("failed to dial rabbitMQ server: %v", err)
+			c.logger.Error().Err(err).Msg("failed to dial rabbitMQ server")
 			return false
 		}
 
 		ch, err := conn.Channel()
 		if err != nil {
-			c.logger.Printf("failed connecting to amqpChannel: %v", err)
+			c.logger.Error().Err(err).Msg("failed connecting to amqpChannel")
 			return false
 		}
 
 		err = ch.Confirm(false)
 		if err != nil {
-			c.logger.Printf("failed to confirm amqpChannel: %v", err)
+			c.logger.Error().Err(err).Msg("failed to confirm amqpChannel")
 			return false
 		}
 
@@ -160,7 +193,7 @@ func (c *AMQPClient) connect(addr string) bool {
 			nil,   // Arguments
 		)
 		if err != nil {
-			c.logger.Printf("failed to declare listen queue: %v", err)
+			c.logger.Error().Err(err).Msg("failed to declare listen queue")
 			return false
 		}
 
@@ -174,12 +207,12 @@ func (c *AMQPClient) connect(addr string) bool {
 		)
 
 		if err != nil {
-			c.logger.Printf("failed to declare push queue: %v", err)
+			c.logger.Error().Err(err).Msg("failed to declare push queue")
 			return false
 		}
 
 		c.changeRealConnection(conn, ch)
-		c.isConnected = true
+		c.isConnected.Store(true)
 
 		return true
 	}
@@ -188,13 +221,13 @@ func (c *AMQPClient) connect(addr string) bool {
 
 	ch, err := conn.Channel()
 	if err != nil {
-		c.logger.Printf("failed connecting to amqpChannel: %v", err)
+		c.logger.Error().Err(err).Msg("failed connecting to amqpChannel")
 		return false
 	}
 
 	err = ch.Confirm(false)
 	if err != nil {
-		c.logger.Printf("failed to confirm amqpChannel: %v", err)
+		c.logger.Error().Err(err).Msg("failed to confirm amqpChannel")
 		return false
 	}
 
@@ -207,21 +240,21 @@ func (c *AMQPClient) connect(addr string) bool {
 
 	_, err = ch.QueueDeclare(c.listenQueue, options)
 	if err != nil {
-		c.logger.Printf("failed to declare listen queue: %v", err)
+		c.logger.Error().Err(err).Msg("failed to declare listen queue")
 		return false
 	}
 
 	_, err = ch.QueueDeclare(c.pushQueue, options)
 
 	if err != nil {
-		c.logger.Printf("failed to declare push queue: %v", err)
+		c.logger.Error().Err(err).Msg("failed to declare push queue")
 		return false
 	}
 
-	c.logger.Printf("Connected")
+	c.logger.Info().Msg("Connected")
 
 	c.changeConnection(conn, ch)
-	c.isConnected = true
+	c.isConnected.Store(true)
 
 	return true
 }
@@ -229,10 +262,13 @@ func (c *AMQPClient) connect(addr string) bool {
 // changeRealConnection takes a new connection to the queue,
 // and updates the amqpChannel listeners to reflect this.
 func (c *AMQPClient) changeRealConnection(connection *amqp.Connection, channel *amqp.Channel) {
+	c.pushLock.Lock()
+	defer c.pushLock.Unlock()
+
 	c.connection = connection
 	c.amqpChannel = channel
 	c.notifyClose = make(chan *amqp.Error)
-	c.notifyConfirm = make(chan amqp.Confirmation)
+	c.notifyConfirm = make(chan amqp.Confirmation, confirmBuffer)
 
 	c.amqpChannel.NotifyClose(c.notifyClose)
 	c.amqpChannel.NotifyPublish(c.notifyConfirm)
@@ -250,35 +286,50 @@ func (c *AMQPClient) changeConnection(connection *amqptest.Conn, channel wabbit.
 	c.falseChannel.NotifyPublish(c.falseNotifyConfirm)
 }
 
-// Push will push data onto the queue, and wait for a confirmation.
-// If no confirms are received until within the resendTimeout,
-// it continuously resends messages until a confirmation is received.
-// This will block until the server sends a confirm.
-func (c *AMQPClient) Push(data []byte) error {
-	if !c.isConnected {
+// Push will push data onto the queue, and wait for the broker to confirm it within ConfirmTimeout.
+// It returns ErrDisconnected if the connection is lost, ErrNotConfirmed if the broker rejects the message or
+// doesn't confirm it in time, and the error of ctx if it is done first: the message may still be received.
+// correlationID, if not empty, is the ID of the request the message comes from.
+// The trace context of ctx is sent in the message headers.
+func (c *AMQPClient) Push(ctx context.Context, data []byte, correlationID string) error {
+	if !c.isConnected.Load() {
 		return ErrDisconnected
 	}
 
-	for {
-		err := c.UnsafePush(data)
+	c.pushLock.Lock()
+	defer c.pushLock.Unlock()
 
-		if err != nil {
-			if err == ErrDisconnected {
+	if !c.isReal {
+		return c.UnsafePush(ctx, data, correlationID)
+	}
+
+	start := time.Now()
+	deliveryTag := c.amqpChannel.GetNextPublishSeqNo()
+	err := c.UnsafePush(ctx, data, correlationID)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.NewTimer(ConfirmTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case confirm := <-c.notifyConfirm:
+			// The confirmations of the messages given up on are skipped.
+			if confirm.DeliveryTag < deliveryTag {
 				continue
 			}
-			return err
-		}
 
-		if c.isReal {
-			select {
-			case confirm := <-c.notifyConfirm:
-				if confirm.Ack {
-					return nil
-				}
-			case <-time.After(1 * time.Second):
+			if !confirm.Ack {
+				return ErrNotConfirmed
 			}
-		} else {
+			metrics.AMQPPublishDuration.WithLabelValues("confirm").Observe(time.Since(start).Seconds())
 			return nil
+		case <-timeout.C:
+			return ErrNotConfirmed
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 }
@@ -287,11 +338,21 @@ func (c *AMQPClient) Push(data []byte) error {
 // confirmation. It returns an error if it fails to connect.
 // No guarantees are provided for whether the server will
 // receive the message.
-func (c *AMQPClient) UnsafePush(data []byte) error {
-	if !c.isConnected {
+func (c *AMQPClient) UnsafePush(ctx context.Context, data []byte, correlationID string) error {
+	if !c.isConnected.Load() {
 		return ErrDisconnected
 	}
 
+	headers := tracing.InjectAMQP(ctx, nil)
+	if correlationID != "" {
+		headers[HeaderRequestID] = correlationID
+	}
+
+	start := time.Now()
+	defer func() {
+		metrics.AMQPPublishDuration.WithLabelValues("publish").Observe(time.Since(start).Seconds())
+	}()
+
 	if c.isReal {
 		return c.amqpChannel.Publish(
 			"",          // Exchange
@@ -299,32 +360,38 @@ func (c *AMQPClient) UnsafePush(data []byte) error {
 			false,       // Mandatory
 			false,       // Immediate
 			amqp.Publishing{
-				DeliveryMode: amqp.Persistent,
-				ContentType:  "text/plain",
-				Body:         data,
+				DeliveryMode:  amqp.Persistent,
+				ContentType:   "text/plain",
+				CorrelationId: correlationID,
+				Headers:       headers,
+				Body:          data,
 			},
 		)
 	}
 
-	c.logger.Printf("Pushing message for tests")
+	c.logger.Debug().Msg("Pushing message for tests")
 	return c.falseChannel.Publish(
 		"",
 		c.pushQueue,
 		data,
 		wabbit.Option{
-			"deliveryMode": 2,
-			"contentType":  "text/plain",
+			"deliveryMode":  2,
+			"contentType":   "text/plain",
+			"correlationId": correlationID,
+			"headers":       headers,
 		},
 	)
 }
 
 // Stream is used to listen on queue and parse the messages.
+// Once cancelCtx is done, the consumers finish the message they are parsing and it returns.
 func (c *AMQPClient) Stream(cancelCtx context.Context) error {
-	for {
-		if c.isConnected {
-			break
+	for !c.isConnected.Load() {
+		select {
+		case <-cancelCtx.Done():
+			return nil
+		case <-time.After(1 * time.Second):
 		}
-		time.Sleep(1 * time.Second)
 	}
 
 	err := c.amqpChannel.Qos(1, 0, false)
@@ -334,7 +401,7 @@ func (c *AMQPClient) Stream(cancelCtx context.Context) error {
 
 	var connectionDropped bool
 
-	c.logger.Printf("Starting to wait for rabbitmq events ...")
+	c.logger.Info().Msg("Starting to wait for rabbitmq events ...")
 	for i := 1; i <= c.threads; i++ {
 		messages, err := c.amqpChannel.Consume(
 			c.listenQueue,
@@ -349,7 +416,9 @@ func (c *AMQPClient) Stream(cancelCtx context.Context) error {
 			return err
 		}
 
+		c.consumersLock.Lock()
 		c.activeConsumers = append(c.activeConsumers, consumerName(i))
+		c.consumersLock.Unlock()
 
 		go func() {
 			defer c.wg.Done()
@@ -378,24 +447,48 @@ func (c *AMQPClient) Stream(cancelCtx context.Context) error {
 	return nil
 }
 
+// parseEvent is used to handle a consumed message in a consumer span, continuing the trace sent in its headers.
 func (c *AMQPClient) parseEvent(msg amqp.Delivery) {
 	var evt Task
 
-	l := c.logger.Log().Timestamp()
+	logger := c.logger
 	startTime := time.Now()
 
-	go func() {
-		c.messagesChannel <- msg.Body
-	}()
+	ctx, span := tracing.Tracer().Start(tracing.ExtractAMQP(context.Background(), msg.Headers), "process "+c.listenQueue,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitMQ,
+			semconv.MessagingOperationTypeProcess,
+			semconv.MessagingDestinationName(c.listenQueue),
+		),
+	)
+	defer span.End()
 
 	err := json.Unmarshal(msg.Body, &evt)
 	if err != nil {
-		logAndNack(msg, l, startTime, "unmarshalling body: %s - %s", string(msg.Body), err.Error())
+		c.forwardEvent(msg.Body)
+		logAndNack(ctx, msg, logger, startTime, "unmarshalling body: %s - %s", string(msg.Body), err.Error())
 		return
 	}
 
+	// Events from other producers carry the request ID in the message properties only.
+	if evt.RequestID == "" {
+		evt.RequestID = messageRequestID(msg)
+	}
+
+	if evt.RequestID != "" {
+		logger = logger.With().Str("requestId", evt.RequestID).Logger()
+	}
+	span.SetAttributes(attribute.String("task.id", evt.ID.String()), attribute.String("task.status", evt.Status))
+
+	event, err := taskToBytes(evt)
+	if err != nil {
+		event = msg.Body
+	}
+	c.forwardEvent(event)
+
 	if evt.Status == "" {
-		logAndNack(msg, l, startTime, "received event without data")
+		logAndNack(ctx, msg, logger, startTime, "received event without data")
 		return
 	}
 
@@ -408,53 +501,82 @@ func (c *AMQPClient) parseEvent(msg amqp.Delivery) {
 	default:
 		err = msg.Reject(false)
 		if err != nil {
-			logAndNack(msg, l, startTime, err.Error())
+			logAndNack(ctx, msg, logger, startTime, "%s", err.Error())
 			return
 		}
+		metrics.AMQPConsumedMessages.WithLabelValues("reject").Inc()
 		return
 	}
 
-	l.Str("level", "info").Int64("took-ms", time.Since(startTime).Milliseconds()).Msgf("%s parsed successfully", evt.Description)
+	logger.Info().Int64("took-ms", time.Since(startTime).Milliseconds()).Msgf("%s parsed successfully", evt.Description)
 
 	err = msg.Ack(false)
 	if err != nil {
-		logAndNack(msg, l, startTime, err.Error())
+		logAndNack(ctx, msg, logger, startTime, "%s", err.Error())
 		return
 	}
+	metrics.AMQPConsumedMessages.WithLabelValues("ack").Inc()
+}
+
+// forwardEvent is used to hand an event over to the websocket clients without blocking the consumer.
+func (c *AMQPClient) forwardEvent(event []byte) {
+	go func() {
+		c.messagesChannel <- event
+	}()
+}
+
+// messageRequestID is used to find the ID of the request a message comes from, in its correlation ID or headers.
+func messageRequestID(msg amqp.Delivery) string {
+	if msg.CorrelationId != "" {
+		return msg.CorrelationId
+	}
+
+	requestID, _ := msg.Headers[HeaderRequestID].(string)
+	return requestID
 }
 
-func logAndNack(msg amqp.Delivery, l *zerolog.Event, t time.Time, errorMessage string, args ...interface{}) {
+func logAndNack(ctx context.Context, msg amqp.Delivery, logger zerolog.Logger, t time.Time, errorMessage string, args ...interface{}) {
 	err := msg.Nack(false, false)
 	if err != nil {
 		panic(err)
-		return
 	}
-	l.Int64("took-ms", time.Since(t).Milliseconds()).Str("level", "error").Msg(fmt.Sprintf(errorMessage, args...))
+	metrics.AMQPConsumedMessages.WithLabelValues("nack").Inc()
+	trace.SpanFromContext(ctx).SetStatus(codes.Error, fmt.Sprintf(errorMessage, args...))
+	logger.Error().Int64("took-ms", time.Since(t).Milliseconds()).Msgf(errorMessage, args...)
+}
+
+// IsConnected is used to know if the client is connected to rabbitmq, it is false while reconnecting.
+func (c *AMQPClient) IsConnected() bool {
+	return c.isConnected.Load()
 }
 
 // Close is used to destroy all tcp connection to rabbitmq.
 func (c *AMQPClient) Close() error {
-	if !c.isConnected {
+	if !c.isConnected.Load() {
 		return nil
 	}
 
-	c.alive = false
-	c.logger.Printf("Waiting for current messages to be processed...")
+	c.alive.Store(false)
+	c.logger.Info().Msg("Waiting for current messages to be processed...")
+
+	// The consumers are canceled in background from a copy, as the list is cleared right away.
+	c.consumersLock.Lock()
+	consumers := c.activeConsumers
+	c.activeConsumers = nil
+	c.consumersLock.Unlock()
 
 	go func() {
 		if c.threads == 0 {
 			defer c.wg.Done()
 		}
-		for i := 1; i <= len(c.activeConsumers); i++ {
-			err := c.amqpChannel.Cancel(consumerName(i), false)
+		for _, consumer := range consumers {
+			err := c.amqpChannel.Cancel(consumer, false)
 			if err != nil {
-				c.logger.Printf("error canceling consumer %s: %v", consumerName(i), err)
+				c.logger.Error().Err(err).Str("consumer", consumer).Msg("error canceling consumer")
 			}
 		}
 	}()
 
-	c.activeConsumers = nil
-
 	if c.isReal {
 		err := c.amqpChannel.Close()
 		if err != nil {
@@ -477,8 +599,8 @@ func (c *AMQPClient) Close() error {
 		}
 	}
 
-	c.isConnected = false
-	c.logger.Printf("gracefully stopped rabbitMQ connection")
+	c.isConnected.Store(false)
+	c.logger.Info().Msg("gracefully stopped rabbitMQ connection")
 	return nil
 }
 
@@ -1,9 +1,10 @@
 package rabbitmq
 
 import (
+	"os"
 	"testing"
 )
 
 func TestMain(m *testing.M) {
-
+	os.Exit(m.Run())
 }
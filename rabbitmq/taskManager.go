@@ -1,9 +1,17 @@
 package rabbitmq
 
 import (
+	"context"
 	"encoding/json"
 	libUuid "github.com/google/uuid"
-	"log"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	outboxModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/outbox"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/metrics"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Task is a task info description.
@@ -13,59 +21,137 @@ type Task struct {
 	Tags        []string     `json:"tags"`
 	Status      string       `json:"status"`
 	Progress    float32      `json:"progress"`
+	Result      interface{}  `json:"result,omitempty"`
+	// RequestID is the ID of the HTTP request which started the task.
+	RequestID string `json:"requestId,omitempty"`
 }
 
 // TaskClient is a Task manager.
+// The task events are written to the outbox, and published by RunRelay.
 type TaskClient struct {
 	amqpClient *AMQPClient
+	// wake is signalled when a task event is committed, for the relay to publish it.
+	wake chan struct{}
 }
 
 // NewTaskManagerClient is used to create the Task manager client.
 func NewTaskManagerClient(client *AMQPClient) *TaskClient {
 	taskManagerClient := TaskClient{
 		amqpClient: client,
+		wake:       make(chan struct{}, 1),
 	}
 
 	return &taskManagerClient
 }
 
-func taskToBytes(task Task) []byte {
-	taskJSON, err := json.Marshal(task)
+func taskToBytes(task Task) ([]byte, error) {
+	return json.Marshal(task)
+}
+
+// startSpan is used to start the producer span of a task event, whose trace context is sent in the message headers.
+func (c *TaskClient) startSpan(ctx context.Context, task Task) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "task "+task.Status,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitMQ,
+			semconv.MessagingOperationTypeSend,
+			semconv.MessagingDestinationName(c.amqpClient.pushQueue),
+			attribute.String("task.id", task.ID.String()),
+			attribute.String("task.status", task.Status),
+		),
+	)
+}
+
+// pushTask is used to write the task to the outbox with its request ID as correlation ID, in the transaction
+// ctx carries if any, and count the transition to its status once committed.
+// The write runs in a producer span, whose trace context is sent in the message headers.
+func (c *TaskClient) pushTask(ctx context.Context, task Task) error {
+	ctx, span := c.startSpan(ctx, task)
+	defer span.End()
+
+	taskJSON, err := taskToBytes(task)
 	if err != nil {
-		log.Fatal(err)
-		return nil
+		return err
 	}
 
-	return taskJSON
+	headers := map[string]string{}
+	for key, value := range tracing.InjectAMQP(ctx, nil) {
+		if header, ok := value.(string); ok {
+			headers[key] = header
+		}
+	}
+
+	message := outboxModel.ModelMessage{Body: taskJSON, CorrelationID: task.RequestID, Headers: headers}
+	_, err = message.WithContext(ctx).Save()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	database.AfterCommit(ctx, func() {
+		metrics.TaskTransitions.WithLabelValues(task.Status).Inc()
+		c.notifyRelay()
+	})
+	return nil
 }
 
 // CreateNewTask is used to create a new Task into bytes.
-func CreateNewTask(tags []string, description string) Task {
+// requestID is the ID of the request starting the task, carried by all its events.
+func CreateNewTask(tags []string, description string, requestID string) Task {
 	newTask := Task{
 		ID:          libUuid.New(),
 		Tags:        tags,
 		Status:      "waiting",
 		Progress:    .01,
 		Description: description,
+		RequestID:   requestID,
 	}
 
 	return newTask
 }
 
-// PushTask is used to push a taks into pushQueue.
-func (c *TaskClient) PushTask(task Task) error {
-	err := c.amqpClient.Push(taskToBytes(task))
+// PushTask is used to push a taks into pushQueue, ctx carrying the trace the task belongs to.
+// Like the other task events, it is written to the outbox in the transaction ctx carries, if any.
+func (c *TaskClient) PushTask(ctx context.Context, task Task) error {
+	err := c.pushTask(ctx, task)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateTaskProgress is to update task status as running with the given progress.
+// Unlike the other task events, progress is published right away without the outbox, so it is seen while the
+// task runs in its transaction: it isn't retried, and is lost while RabbitMQ is down.
+func (c *TaskClient) UpdateTaskProgress(ctx context.Context, task Task, progress float32) error {
+	task.Status = "running"
+	task.Progress = progress
+
+	ctx, span := c.startSpan(ctx, task)
+	defer span.End()
+
+	taskJSON, err := taskToBytes(task)
+	if err != nil {
+		return err
+	}
+
+	err = c.amqpClient.Push(ctx, taskJSON, task.RequestID)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
+	metrics.TaskTransitions.WithLabelValues(task.Status).Inc()
 	return nil
 }
 
 // CompleteTask is to update task status as completed.
-func (c *TaskClient) CompleteTask(task Task) error {
+func (c *TaskClient) CompleteTask(ctx context.Context, task Task) error {
 	task.Status = "completed"
-	err := c.amqpClient.Push(taskToBytes(task))
+	err := c.pushTask(ctx, task)
 	if err != nil {
 		return err
 	}
@@ -74,9 +160,9 @@ func (c *TaskClient) CompleteTask(task Task) error {
 }
 
 // FailTask is to update task status as failed.
-func (c *TaskClient) FailTask(task Task) error {
+func (c *TaskClient) FailTask(ctx context.Context, task Task) error {
 	task.Status = "failed"
-	err := c.amqpClient.Push(taskToBytes(task))
+	err := c.pushTask(ctx, task)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,110 @@
+// Package ratelimit limits the requests of each client with token buckets, kept in memory or in the database
+// so the replicas share them.
+package ratelimit
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/metrics"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	// HeaderLimit is the number of requests the client can make at once.
+	HeaderLimit = "RateLimit-Limit"
+	// HeaderRemaining is the number of requests the client can still make right away.
+	HeaderRemaining = "RateLimit-Remaining"
+	// HeaderReset is the number of seconds until the client can make HeaderLimit requests again.
+	HeaderReset = "RateLimit-Reset"
+	// HeaderRetryAfter is the number of seconds to wait before retrying a denied request.
+	HeaderRetryAfter = "Retry-After"
+)
+
+type (
+	// Config is the configuration of the rate limiter middleware.
+	Config struct {
+		// Skipper defines a function to skip the middleware.
+		Skipper middleware.Skipper
+		Store   Store
+		// Default is the limit of the requests with no route nor plan limit.
+		Default Limit
+		// Plans holds the limits of the tenants, by plan.
+		Plans map[string]Limit
+		// Routes holds the limits of routes, by method and route path, counted apart from the other routes.
+		Routes map[string]Limit
+		// Identify is used to name the client of a request, its bucket being shared by all its requests.
+		Identify func(c echo.Context) string
+		// Plan is used to get the plan of the tenant the request is made for, empty when there is none.
+		Plan func(c echo.Context) string
+	}
+)
+
+// RouteKey is used to name a route in Config.Routes.
+func RouteKey(method string, path string) string {
+	return method + " " + path
+}
+
+// limitOf is used to get the limit of a request and the key of its bucket.
+func (config Config) limitOf(c echo.Context) (Limit, string) {
+	key := config.Identify(c)
+
+	route := RouteKey(c.Request().Method, c.Path())
+	if limit, exists := config.Routes[route]; exists {
+		return limit, key + "|" + route
+	}
+
+	if config.Plan != nil {
+		if limit, exists := config.Plans[config.Plan(c)]; exists {
+			return limit, key
+		}
+	}
+	return config.Default, key
+}
+
+// seconds is used to write a duration as whole seconds, rounded up.
+func seconds(duration time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(duration.Seconds())))
+}
+
+// Middleware takes a token from the bucket of the client for each request, and answers 429 when there is none left.
+// The quota is sent in the RateLimit headers, limits with no rate are unlimited.
+// When the store fails, the request is let through rather than denying every client.
+func Middleware(config Config) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			limit, key := config.limitOf(c)
+			if limit.Rate <= 0 {
+				return next(c)
+			}
+
+			result, err := config.Store.Take(c.Request().Context(), key, limit, time.Now())
+			if err != nil {
+				c.Logger().Error("rate limiter store: " + err.Error())
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set(HeaderLimit, strconv.Itoa(limit.Burst))
+			header.Set(HeaderRemaining, strconv.Itoa(result.Remaining))
+			header.Set(HeaderReset, seconds(result.Reset))
+
+			if !result.Allowed {
+				metrics.RateLimitDenials.Inc()
+				header.Set(HeaderRetryAfter, seconds(result.RetryAfter))
+				return problem.TooManyRequests("rate limit exceeded")
+			}
+			return next(c)
+		}
+	}
+}
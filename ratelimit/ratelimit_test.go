@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	ratelimitModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/ratelimit"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/problem"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	err := database.ConnectForTests().AutoMigrate(&ratelimitModel.ModelBucket{})
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+
+	os.Exit(m.Run())
+}
+
+// testStore is used to check a store refills and empties its buckets the same way.
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Now()
+
+	result, err := store.Take(ctx, "client", limit, now)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Remaining: 1, Reset: time.Second}, result)
+
+	result, err = store.Take(ctx, "client", limit, now)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Remaining: 0, Reset: 2 * time.Second}, result)
+
+	result, err = store.Take(ctx, "client", limit, now)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Allowed: false, Remaining: 0, Reset: 2 * time.Second, RetryAfter: time.Second}, result)
+
+	// Other clients have their own bucket.
+	result, err = store.Take(ctx, "other", limit, now)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// Refilled at the rate, never beyond the burst.
+	result, err = store.Take(ctx, "client", limit, now.Add(1500*time.Millisecond))
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result, err = store.Take(ctx, "client", limit, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Remaining: 1, Reset: time.Second}, result)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(time.Minute))
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	limit := Limit{Rate: 1, Burst: 2}
+
+	_, err := store.Take(context.Background(), "client", limit, time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, store.buckets, 1)
+
+	_, err = store.Take(context.Background(), "other", limit, time.Now().Add(2*time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, store.buckets, 1)
+	assert.Contains(t, store.buckets, "other")
+}
+
+func TestDatabaseStore(t *testing.T) {
+	testStore(t, NewDatabaseStore())
+
+	purged, err := (&ratelimitModel.ModelBucket{}).PurgeIdle(time.Now().Add(2 * time.Hour))
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2), purged)
+	}
+}
+
+// limitedServer is used to serve a route limited with config, the client being named by the X-Client header.
+func limitedServer(config Config) *echo.Echo {
+	config.Store = NewMemoryStore(time.Minute)
+	config.Identify = func(c echo.Context) string {
+		return c.Request().Header.Get("X-Client")
+	}
+	config.Plan = func(c echo.Context) string {
+		return c.Request().Header.Get("X-Plan")
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	e.Use(Middleware(config))
+	ok := func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}
+	e.GET("/tenants", ok)
+	e.POST("/tenants", ok)
+	return e
+}
+
+func request(e *echo.Echo, method string, client string, plan string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/tenants", nil)
+	req.Header.Set("X-Client", client)
+	req.Header.Set("X-Plan", plan)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	e := limitedServer(Config{Default: Limit{Rate: 0.5, Burst: 1}})
+
+	rec := request(e, http.MethodGet, "acme", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get(HeaderLimit))
+	assert.Equal(t, "0", rec.Header().Get(HeaderRemaining))
+	assert.Equal(t, "2", rec.Header().Get(HeaderReset))
+	assert.Empty(t, rec.Header().Get(HeaderRetryAfter))
+
+	rec = request(e, http.MethodGet, "acme", "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, problem.MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+	assert.Contains(t, rec.Body.String(), `"type":"/problems/too-many-requests"`)
+	assert.Equal(t, "0", rec.Header().Get(HeaderRemaining))
+	assert.Equal(t, "2", rec.Header().Get(HeaderRetryAfter))
+
+	rec = request(e, http.MethodGet, "globex", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestPlanAndRouteLimits(t *testing.T) {
+	e := limitedServer(Config{
+		Default: Limit{Rate: 1, Burst: 1},
+		Plans:   map[string]Limit{"pro": {Rate: 1, Burst: 5}, "enterprise": {}},
+		Routes:  map[string]Limit{RouteKey(http.MethodPost, "/tenants"): {Rate: 1, Burst: 2}},
+	})
+
+	rec := request(e, http.MethodGet, "acme", "pro")
+	assert.Equal(t, "5", rec.Header().Get(HeaderLimit))
+	assert.Equal(t, "4", rec.Header().Get(HeaderRemaining))
+
+	// Limited routes have their own bucket, whatever the plan.
+	rec = request(e, http.MethodPost, "acme", "pro")
+	assert.Equal(t, "2", rec.Header().Get(HeaderLimit))
+	assert.Equal(t, "1", rec.Header().Get(HeaderRemaining))
+
+	rec = request(e, http.MethodGet, "acme", "pro")
+	assert.Equal(t, "3", rec.Header().Get(HeaderRemaining))
+
+	// No rate is unlimited.
+	for range 3 {
+		rec = request(e, http.MethodGet, "initech", "enterprise")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Empty(t, rec.Header().Get(HeaderLimit))
+	}
+}
@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	ratelimitModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/ratelimit"
+	"math"
+	"sync"
+	"time"
+)
+
+type (
+	// Limit is a token bucket quota: Burst requests at once, refilled at Rate requests per second.
+	Limit struct {
+		Rate  float64
+		Burst int
+	}
+
+	// Result is the outcome of taking a token from a bucket.
+	Result struct {
+		Allowed bool
+		// Remaining is the number of requests which can be made right away.
+		Remaining int
+		// Reset is the time left until the bucket is full again.
+		Reset time.Duration
+		// RetryAfter is the time left until a token is available, zero when allowed.
+		RetryAfter time.Duration
+	}
+
+	// Store holds the token buckets, by key.
+	Store interface {
+		// Take is used to take a token from the bucket of key at now, the bucket starting full.
+		Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+	}
+
+	// memoryBucket is a token bucket of the memory store.
+	memoryBucket struct {
+		tokens    float64
+		updatedAt time.Time
+		// fullAt is when the bucket is full again, it can be dropped from then on.
+		fullAt time.Time
+	}
+
+	// MemoryStore holds the buckets in memory, they aren't shared with the other replicas.
+	MemoryStore struct {
+		mutex     sync.Mutex
+		buckets   map[string]*memoryBucket
+		sweptAt   time.Time
+		sweepTime time.Duration
+	}
+
+	// DatabaseStore holds the buckets in the database, they are shared with the other replicas.
+	DatabaseStore struct{}
+)
+
+// take is used to refill tokens counted at updatedAt up to now, then take one if there is one.
+// It returns the tokens left, and the outcome.
+func (limit Limit) take(tokens float64, updatedAt time.Time, now time.Time) (float64, Result) {
+	burst := float64(limit.Burst)
+	elapsed := now.Sub(updatedAt).Seconds()
+	if elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*limit.Rate)
+	}
+
+	result := Result{}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = limit.duration(1 - tokens)
+	}
+
+	result.Remaining = int(math.Max(0, math.Floor(tokens)))
+	result.Reset = limit.duration(burst - tokens)
+	return tokens, result
+}
+
+// duration is used to get the time taken to refill tokens.
+func (limit Limit) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / limit.Rate * float64(time.Second))
+}
+
+// NewMemoryStore is used to create a store keeping the buckets in memory,
+// the full ones being dropped every sweepTime.
+func NewMemoryStore(sweepTime time.Duration) *MemoryStore {
+	return &MemoryStore{buckets: map[string]*memoryBucket{}, sweptAt: time.Now(), sweepTime: sweepTime}
+}
+
+// Take is used to take a token from the bucket of key at now, the bucket starting full.
+func (store *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if now.Sub(store.sweptAt) >= store.sweepTime {
+		store.sweep(now)
+	}
+
+	bucket, exists := store.buckets[key]
+	if !exists {
+		bucket = &memoryBucket{tokens: float64(limit.Burst), updatedAt: now}
+		store.buckets[key] = bucket
+	}
+
+	tokens, result := limit.take(bucket.tokens, bucket.updatedAt, now)
+	bucket.tokens = tokens
+	bucket.updatedAt = now
+	bucket.fullAt = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep is used to drop the buckets which are full again, they are the same as new ones.
+func (store *MemoryStore) sweep(now time.Time) {
+	for key, bucket := range store.buckets {
+		if !bucket.fullAt.After(now) {
+			delete(store.buckets, key)
+		}
+	}
+	store.sweptAt = now
+}
+
+// NewDatabaseStore is used to create a store keeping the buckets in the database the context of the requests carries.
+func NewDatabaseStore() *DatabaseStore {
+	return &DatabaseStore{}
+}
+
+// Take is used to take a token from the bucket of key at now, the bucket starting full.
+func (store *DatabaseStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	var result Result
+	err := (&ratelimitModel.ModelBucket{Key: key}).WithContext(ctx).Update(float64(limit.Burst), now, func(tokens float64, updatedAt time.Time) float64 {
+		var left float64
+		left, result = limit.take(tokens, updatedAt, now)
+		return left
+	})
+	return result, err
+}
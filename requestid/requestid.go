@@ -0,0 +1,70 @@
+// Package requestid gives every request an ID, sent back in X-Request-ID and carried by its logs, tasks and events.
+package requestid
+
+import (
+	"context"
+	libUUID "github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+)
+
+// maxLength is the longest request ID accepted from clients, longer ones are replaced.
+const maxLength = 128
+
+const echoKey = "requestId"
+
+type contextKey struct{}
+
+// Middleware is used to accept the X-Request-ID of the client or generate one, and attach it to the request.
+// The ID is set on the response, the echo context, the request context and the logger of the request,
+// which is also carried by the request context for zerolog.Ctx.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(echo.HeaderXRequestID)
+			if !valid(id) {
+				id = libUUID.NewString()
+			}
+
+			logger := logging.FromEcho(c.Logger()).With().Str("requestId", id).Logger()
+
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			c.Set(echoKey, id)
+			c.SetRequest(c.Request().WithContext(logger.WithContext(NewContext(c.Request().Context(), id))))
+			c.SetLogger(logging.NewEchoLogger(logger))
+
+			return next(c)
+		}
+	}
+}
+
+// Get is used to find the request ID of an echo context, empty outside the middleware.
+func Get(c echo.Context) string {
+	id, _ := c.Get(echoKey).(string)
+	return id
+}
+
+// NewContext is used to carry a request ID in a context, such as the one of a background task.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext is used to find the request ID carried by a context, empty when there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// valid is used to reject the client request IDs which would garble the logs or headers.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+
+	for _, character := range id {
+		if character < '!' || character > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	libUUID "github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serve(e *echo.Echo, requestID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/tenants", nil)
+	if requestID != "" {
+		req.Header.Set(echo.HeaderXRequestID, requestID)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	var output bytes.Buffer
+	e := echo.New()
+	e.Logger = logging.NewEchoLogger(zerolog.New(&output))
+	e.Use(Middleware())
+	e.GET("/tenants", func(c echo.Context) error {
+		c.Logger().Infof("listing %s", "tenants")
+		zerolog.Ctx(c.Request().Context()).Info().Msg("from the context")
+		return c.String(http.StatusOK, Get(c)+" "+FromContext(c.Request().Context()))
+	})
+
+	rec := serve(e, "client-request-1")
+
+	// Assertions
+	assert.Equal(t, "client-request-1", rec.Header().Get(echo.HeaderXRequestID))
+	assert.Equal(t, "client-request-1 client-request-1", rec.Body.String())
+	assert.Contains(t, output.String(), `{"level":"info","requestId":"client-request-1","message":"listing tenants"}`)
+	assert.Contains(t, output.String(), `{"level":"info","requestId":"client-request-1","message":"from the context"}`)
+
+	for _, invalidID := range []string{"", "with spaces", "line\nbreak", strings.Repeat("a", maxLength+1)} {
+		rec = serve(e, invalidID)
+
+		// Assertions
+		_, err := libUUID.Parse(rec.Header().Get(echo.HeaderXRequestID))
+		assert.NoError(t, err, invalidID)
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := NewContext(context.Background(), "task-request")
+
+	// Assertions
+	assert.Equal(t, "task-request", FromContext(ctx))
+	assert.Empty(t, FromContext(context.Background()))
+	assert.Empty(t, Get(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())))
+}
@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"context"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+)
+
+// amqpCarrier adapts the headers of an AMQP message to carry the trace context.
+type amqpCarrier amqp.Table
+
+func (carrier amqpCarrier) Get(key string) string {
+	value, _ := carrier[key].(string)
+	return value
+}
+
+func (carrier amqpCarrier) Set(key string, value string) {
+	carrier[key] = value
+}
+
+func (carrier amqpCarrier) Keys() []string {
+	keys := make([]string, 0, len(carrier))
+	for key := range carrier {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// InjectAMQP is used to write the trace context of ctx into the headers of a message, which are created when nil.
+func InjectAMQP(ctx context.Context, headers amqp.Table) amqp.Table {
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+
+	otel.GetTextMapPropagator().Inject(ctx, amqpCarrier(headers))
+	return headers
+}
+
+// ExtractAMQP is used to continue in ctx the trace carried by the headers of a message.
+func ExtractAMQP(ctx context.Context, headers amqp.Table) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, amqpCarrier(headers))
+}
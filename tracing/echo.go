@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"github.com/labstack/echo/v4"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Middleware is used to run every request in a server span, continuing the trace of the traceparent header if any.
+// The span is carried by the request context, and its trace ID added to the logger of the request.
+// Errors are answered here, as the access log does, so the status recorded is the one sent.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+			ctx, span := Tracer().Start(ctx, request.Method+" "+c.Path(),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(request.Method),
+					semconv.HTTPRoute(c.Path()),
+					semconv.URLPath(request.URL.Path),
+					semconv.ClientAddress(c.RealIP()),
+				),
+			)
+			defer span.End()
+
+			if span.SpanContext().IsValid() {
+				logger := logging.FromEcho(c.Logger()).With().Str("traceId", span.SpanContext().TraceID().String()).Logger()
+				ctx = logger.WithContext(ctx)
+				c.SetLogger(logging.NewEchoLogger(logger))
+			}
+			c.SetRequest(request.WithContext(ctx))
+
+			if err := next(c); err != nil {
+				span.RecordError(err)
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "tracing:span"
+
+// gormPlugin runs the queries of a gorm client in child spans.
+type gormPlugin struct{}
+
+// InstrumentDB is used to run the queries of a gorm client in child spans of the span carried by their context.
+// Queries run without a span in their context, such as the purge ones, aren't traced.
+func InstrumentDB(db *gorm.DB) error {
+	return db.Use(gormPlugin{})
+}
+
+func (gormPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize is used by gorm to register the callbacks tracing each kind of operation.
+func (gormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register("tracing:before_create", startSpan("create")),
+		callbacks.Create().After("gorm:create").Register("tracing:after_create", endSpan),
+		callbacks.Query().Before("gorm:query").Register("tracing:before_query", startSpan("query")),
+		callbacks.Query().After("gorm:query").Register("tracing:after_query", endSpan),
+		callbacks.Update().Before("gorm:update").Register("tracing:before_update", startSpan("update")),
+		callbacks.Update().After("gorm:update").Register("tracing:after_update", endSpan),
+		callbacks.Delete().Before("gorm:delete").Register("tracing:before_delete", startSpan("delete")),
+		callbacks.Delete().After("gorm:delete").Register("tracing:after_delete", endSpan),
+		callbacks.Row().Before("gorm:row").Register("tracing:before_row", startSpan("row")),
+		callbacks.Row().After("gorm:row").Register("tracing:after_row", endSpan),
+		callbacks.Raw().Before("gorm:raw").Register("tracing:before_raw", startSpan("raw")),
+		callbacks.Raw().After("gorm:raw").Register("tracing:after_raw", endSpan),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startSpan(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			return
+		}
+
+		ctx, span := Tracer().Start(ctx, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.DBSystemNameKey.String(db.Dialector.Name()),
+				semconv.DBOperationName(operation),
+				semconv.DBCollectionName(db.Statement.Table),
+			),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func endSpan(db *gorm.DB) {
+	value, found := db.InstanceGet(spanKey)
+	if !found {
+		return
+	}
+
+	span := value.(trace.Span)
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.DBQueryText(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
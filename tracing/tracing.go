@@ -0,0 +1,91 @@
+// Package tracing provides the OpenTelemetry tracer of the app, and the propagation of its traces over HTTP, AMQP and gorm.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"os"
+)
+
+const (
+	// ExporterOTLP sends the spans to an OpenTelemetry collector over OTLP/HTTP.
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes the spans as JSON, to a file or to stdout.
+	ExporterStdout = "stdout"
+	// ExporterNone drops the spans, traces are still propagated.
+	ExporterNone = "none"
+)
+
+const instrumentationName = "gitlab.com/s0j0hn/go-rest-boilerplate-echo"
+
+// Config is the tracing configuration.
+type Config struct {
+	ServiceName string
+	// Exporter is one of ExporterOTLP, ExporterStdout or ExporterNone.
+	Exporter string
+	// Endpoint is the host:port of the collector for ExporterOTLP.
+	Endpoint string
+	// File is the file ExporterStdout writes to, stdout when empty.
+	File string
+}
+
+// Configure is used to install the tracer provider and the W3C trace context propagator.
+// The returned function flushes the spans left and stops the exporter, it should be called on shutdown.
+func Configure(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var closer io.Closer
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpoint(config.Endpoint), otlptracehttp.WithInsecure())
+	case ExporterStdout:
+		var output io.Writer = os.Stdout
+		if config.File != "" {
+			file, openErr := os.OpenFile(config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+			if openErr != nil {
+				return nil, fmt.Errorf("tracing file: %w", openErr)
+			}
+			output, closer = file, file
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(output))
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", config.Exporter)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("tracing exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(config.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			return errors.Join(err, closer.Close())
+		}
+		return err
+	}, nil
+}
+
+// Tracer is used to get the tracer of the app, from the installed provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const parentTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+// record is used to install a tracer provider keeping the ended spans in memory.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	_, err := Configure(context.Background(), Config{Exporter: ExporterNone})
+	assert.NoError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/tenants/:id", func(c echo.Context) error {
+		if c.Param("id") == "broken" {
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		return c.String(http.StatusOK, trace.SpanContextFromContext(c.Request().Context()).TraceID().String())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/tenants/1", nil)
+	req.Header.Set("traceparent", "00-"+parentTraceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/tenants/broken", nil))
+
+	spans := recorder.Ended()
+
+	// Assertions
+	assert.Equal(t, parentTraceID, rec.Body.String())
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "GET /tenants/:id", spans[0].Name())
+		assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+		assert.Equal(t, parentTraceID, spans[0].Parent().TraceID().String())
+		assert.Equal(t, codes.Unset, spans[0].Status().Code)
+		assert.Equal(t, codes.Error, spans[1].Status().Code)
+		assert.NotEqual(t, parentTraceID, spans[1].SpanContext().TraceID().String())
+	}
+}
+
+func TestAMQPPropagation(t *testing.T) {
+	record(t)
+	ctx, span := Tracer().Start(context.Background(), "publish")
+	defer span.End()
+
+	headers := InjectAMQP(ctx, nil)
+	extracted := trace.SpanContextFromContext(ExtractAMQP(context.Background(), headers))
+
+	// Assertions
+	assert.Contains(t, headers, "traceparent")
+	assert.Equal(t, span.SpanContext().TraceID(), extracted.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), extracted.SpanID())
+	assert.False(t, trace.SpanContextFromContext(ExtractAMQP(context.Background(), nil)).IsValid())
+}
+
+func TestInstrumentDB(t *testing.T) {
+	recorder := record(t)
+	db, err := gorm.Open(sqlite.Open("file:tracing?mode=memory"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, InstrumentDB(db))
+
+	type sample struct {
+		ID   uint
+		Name string
+	}
+	assert.NoError(t, db.AutoMigrate(&sample{}))
+
+	// Queries without a span in their context aren't traced.
+	assert.NoError(t, db.Create(&sample{Name: "first"}).Error)
+
+	ctx, span := Tracer().Start(context.Background(), "handler")
+	assert.NoError(t, db.WithContext(ctx).Find(&[]sample{}).Error)
+	span.End()
+
+	spans := recorder.Ended()
+
+	// Assertions
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "gorm.query", spans[0].Name())
+		assert.Equal(t, span.SpanContext().SpanID(), spans[0].Parent().SpanID())
+		assert.Contains(t, spans[0].Attributes(), semconv.DBQueryText("SELECT * FROM `samples`"))
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Configure(context.Background(), Config{ServiceName: "tests", Exporter: ExporterStdout, File: file})
+	assert.NoError(t, err)
+
+	_, span := Tracer().Start(context.Background(), "exported")
+	span.End()
+	assert.NoError(t, shutdown(context.Background()))
+
+	written, err := os.ReadFile(file)
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Contains(t, string(written), `"Name":"exported"`)
+	assert.Contains(t, string(written), `"Value":"tests"`)
+
+	_, err = Configure(context.Background(), Config{Exporter: "zipkin"})
+	assert.Error(t, err)
+}
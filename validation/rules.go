@@ -0,0 +1,114 @@
+package validation
+
+import (
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	"regexp"
+	"strings"
+)
+
+// rule is a custom validation rule, with its message in every supported language.
+type rule struct {
+	tag   string
+	check validator.Func
+	// messages are keyed by locale, {0} is the field name.
+	messages map[string]string
+}
+
+var (
+	tenantNamePattern = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} .'&-]{1,99}$`)
+	slugPattern       = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// reservedNames can't be used as tenant names or slugs, as they clash with routes, hostnames or system accounts.
+var reservedNames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"api":           true,
+	"root":          true,
+	"system":        true,
+	"support":       true,
+	"www":           true,
+	"tenants":       true,
+	"swagger":       true,
+	"null":          true,
+	"undefined":     true,
+}
+
+var rules = []rule{
+	{
+		tag: "tenantname",
+		check: func(field validator.FieldLevel) bool {
+			return tenantNamePattern.MatchString(field.Field().String())
+		},
+		messages: map[string]string{
+			"en": "{0} must be 2 to 100 letters, digits, spaces or . ' & - characters, starting with a letter or digit",
+			"fr": "{0} doit contenir de 2 à 100 lettres, chiffres, espaces ou caractères . ' & - et commencer par une lettre ou un chiffre",
+			"es": "{0} debe tener de 2 a 100 letras, dígitos, espacios o caracteres . ' & - y empezar por una letra o un dígito",
+		},
+	},
+	{
+		tag: "slug",
+		check: func(field validator.FieldLevel) bool {
+			return slugPattern.MatchString(field.Field().String())
+		},
+		messages: map[string]string{
+			"en": "{0} must only contain lowercase letters, digits and dashes",
+			"fr": "{0} ne doit contenir que des lettres minuscules, des chiffres et des tirets",
+			"es": "{0} solo debe contener letras minúsculas, dígitos y guiones",
+		},
+	},
+	{
+		tag: "notreserved",
+		check: func(field validator.FieldLevel) bool {
+			return !isReserved(field.Field().String())
+		},
+		messages: map[string]string{
+			"en": "{0} is a reserved name",
+			"fr": "{0} est un nom réservé",
+			"es": "{0} es un nombre reservado",
+		},
+	},
+}
+
+// isReserved is used to know if a name is reserved, ignoring its case and surrounding spaces.
+func isReserved(name string) bool {
+	return reservedNames[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// Message is used to get the English message of a custom rule without the field name, such as "is a reserved name",
+// for the errors written without a translator.
+func Message(tag string) (string, bool) {
+	for _, customRule := range rules {
+		if customRule.tag == tag {
+			return strings.TrimPrefix(customRule.messages["en"], "{0} "), true
+		}
+	}
+	return "", false
+}
+
+// registerRuleMessages is used to add the messages of the custom rules to a language.
+func registerRuleMessages(validate *validator.Validate, translator ut.Translator) error {
+	for _, customRule := range rules {
+		message, found := customRule.messages[translator.Locale()]
+		if !found {
+			message = customRule.messages["en"]
+		}
+
+		err := validate.RegisterTranslation(customRule.tag, translator,
+			func(translator ut.Translator) error {
+				return translator.Add(customRule.tag, message, true)
+			},
+			func(translator ut.Translator, validationError validator.FieldError) string {
+				translated, err := translator.T(validationError.Tag(), validationError.Field())
+				if err != nil {
+					return validationError.Error()
+				}
+				return translated
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
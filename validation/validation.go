@@ -0,0 +1,134 @@
+// Package validation validates the request bodies and writes the failed rules in the language of the request.
+package validation
+
+import (
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	"github.com/go-playground/locales/fr"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+	esTranslations "github.com/go-playground/validator/v10/translations/es"
+	frTranslations "github.com/go-playground/validator/v10/translations/fr"
+	"github.com/labstack/echo/v4"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// language is a supported language, with the validator messages for the built-in rules.
+type language struct {
+	locale   locales.Translator
+	register func(validate *validator.Validate, translator ut.Translator) error
+}
+
+// languages are the supported languages, the first one is used when the request accepts none of them.
+var languages = []language{
+	{en.New(), enTranslations.RegisterDefaultTranslations},
+	{fr.New(), frTranslations.RegisterDefaultTranslations},
+	{es.New(), esTranslations.RegisterDefaultTranslations},
+}
+
+// Validator is the echo request validator, naming the fields after their JSON names.
+type Validator struct {
+	validate   *validator.Validate
+	translator *ut.UniversalTranslator
+}
+
+// New is used to create the request validator, with the custom rules and the messages of every supported language.
+func New() (*Validator, error) {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	for _, customRule := range rules {
+		if err := validate.RegisterValidation(customRule.tag, customRule.check); err != nil {
+			return nil, err
+		}
+	}
+
+	supportedLocales := make([]locales.Translator, len(languages))
+	for i, supported := range languages {
+		supportedLocales[i] = supported.locale
+	}
+	universalTranslator := ut.New(languages[0].locale, supportedLocales...)
+
+	for _, supported := range languages {
+		translator, _ := universalTranslator.GetTranslator(supported.locale.Locale())
+		if err := supported.register(validate, translator); err != nil {
+			return nil, err
+		}
+
+		if err := registerRuleMessages(validate, translator); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Validator{validate: validate, translator: universalTranslator}, nil
+}
+
+// Validate is used by echo, the validation errors are turned into problems by the error handler.
+func (v *Validator) Validate(i interface{}) error {
+	return v.validate.Struct(i)
+}
+
+// Translator is used to find the best supported language of an Accept-Language header value.
+func (v *Validator) Translator(acceptLanguage string) ut.Translator {
+	translator, _ := v.translator.FindTranslator(acceptedLocales(acceptLanguage)...)
+	return translator
+}
+
+// Translate is used by the error handler to write a failed rule in the language of the request.
+func (v *Validator) Translate(c echo.Context, validationError validator.FieldError) string {
+	return validationError.Translate(v.Translator(c.Request().Header.Get("Accept-Language")))
+}
+
+// acceptedLocales is used to list the locales of an Accept-Language header value, most preferred first.
+// A regional locale such as fr-CA is followed by its language, fr, as the regions aren't all supported.
+func acceptedLocales(acceptLanguage string) []string {
+	type accepted struct {
+		locale  string
+		quality float64
+	}
+
+	var acceptedLanguages []accepted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, parameters, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(parameters), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		if quality > 0 {
+			acceptedLanguages = append(acceptedLanguages, accepted{strings.ReplaceAll(tag, "-", "_"), quality})
+		}
+	}
+
+	sort.SliceStable(acceptedLanguages, func(i, j int) bool {
+		return acceptedLanguages[i].quality > acceptedLanguages[j].quality
+	})
+
+	localeNames := make([]string, 0, len(acceptedLanguages)*2)
+	for _, acceptedLanguage := range acceptedLanguages {
+		localeNames = append(localeNames, acceptedLanguage.locale)
+		if base, _, regional := strings.Cut(acceptedLanguage.locale, "_"); regional {
+			localeNames = append(localeNames, base)
+		}
+	}
+	return localeNames
+}
@@ -0,0 +1,103 @@
+package validation
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type tenantRequest struct {
+	Name string `json:"name" validate:"required,tenantname,notreserved"`
+	Slug string `json:"slug,omitempty" validate:"omitempty,slug,notreserved"`
+}
+
+func validationErrors(t *testing.T, requestValidator *Validator, request tenantRequest) validator.ValidationErrors {
+	err := requestValidator.Validate(request)
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+	return validationErrors
+}
+
+func TestCustomRules(t *testing.T) {
+	requestValidator, err := New()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Assertions
+	assert.NoError(t, requestValidator.Validate(tenantRequest{Name: "Café de l'Europe & Co", Slug: "cafe-de-l-europe"}))
+
+	invalidRequests := map[tenantRequest][]string{
+		{Name: "x"}:                      {"tenantname"},
+		{Name: "-Dash"}:                  {"tenantname"},
+		{Name: "Semi;colon"}:             {"tenantname"},
+		{Name: " Admin "}:                {"tenantname", "notreserved"},
+		{Name: "ROOT"}:                   {"notreserved"},
+		{Name: "Good", Slug: "Bad Slug"}: {"slug"},
+		{Name: "Good", Slug: "api"}:      {"notreserved"},
+	}
+
+	for request, rules := range invalidRequests {
+		var failed []string
+		for _, validationError := range validationErrors(t, requestValidator, request) {
+			failed = append(failed, validationError.Tag())
+		}
+
+		// Assertions
+		assert.Subset(t, rules, failed, request.Name)
+		assert.NotEmpty(t, failed, request.Name)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	requestValidator, err := New()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	messages := map[string]string{
+		"":                        "name is a required field",
+		"fr-CA,fr;q=0.9,en;q=0.8": "name est un champ obligatoire",
+		"de, es;q=0.5":            "name es un campo requerido",
+		"en;q=0.1, fr":            "name est un champ obligatoire",
+		"*":                       "name is a required field",
+	}
+
+	for acceptLanguage, message := range messages {
+		req := httptest.NewRequest(http.MethodPost, "/tenants", nil)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+
+		// Assertions
+		assert.Equal(t, message, requestValidator.Translate(c, validationErrors(t, requestValidator, tenantRequest{})[0]), acceptLanguage)
+	}
+
+	reserved := validationErrors(t, requestValidator, tenantRequest{Name: "admin"})[0]
+
+	// Assertions
+	assert.Equal(t, "name is a reserved name", reserved.Translate(requestValidator.Translator("en-US")))
+	assert.Equal(t, "name est un nom réservé", reserved.Translate(requestValidator.Translator("fr")))
+	assert.Equal(t, "name es un nombre reservado", reserved.Translate(requestValidator.Translator("es-MX")))
+}
+
+func TestMessage(t *testing.T) {
+	message, found := Message("notreserved")
+
+	// Assertions
+	assert.True(t, found)
+	assert.Equal(t, "is a reserved name", message)
+	_, found = Message("required")
+	assert.False(t, found)
+}
+
+func TestAcceptedLocales(t *testing.T) {
+	// Assertions
+	assert.Equal(t, []string{"fr_CA", "fr", "en"}, acceptedLocales("en;q=0.5, fr-CA"))
+	assert.Equal(t, []string{"es"}, acceptedLocales("de;q=0, es, *;q=0.1"))
+	assert.Empty(t, acceptedLocales(""))
+}
@@ -0,0 +1,96 @@
+// Package versioning serves the API under one route group per version and flags the deprecated versions.
+package versioning
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderDeprecation is the RFC 9745 header with the date a version was deprecated on.
+	HeaderDeprecation = "Deprecation"
+	// HeaderSunset is the RFC 8594 header with the date a version stops being served.
+	HeaderSunset = "Sunset"
+	// HeaderLink is the header pointing deprecated requests to their successor-version route.
+	HeaderLink = "Link"
+)
+
+const contextKey = "apiVersion"
+
+// Version is a version of the API, served under the /<Name> route group.
+type Version struct {
+	Name string
+	// Deprecation is when the version was deprecated, zero while it is supported.
+	Deprecation time.Time
+	// Sunset is when the version stops being served, zero while it isn't planned.
+	Sunset time.Time
+	// Successor is the name of the version clients should move to.
+	Successor string
+}
+
+// Prefix is the path of the route group of the version.
+func (v Version) Prefix() string {
+	return "/" + v.Name
+}
+
+// Deprecated is used to know if clients should move to another version.
+func (v Version) Deprecated() bool {
+	return !v.Deprecation.IsZero()
+}
+
+// Group is used to create the route group of the version, with its middleware applied first.
+func Group(e *echo.Echo, version Version, middlewares ...echo.MiddlewareFunc) *echo.Group {
+	return e.Group(version.Prefix(), append([]echo.MiddlewareFunc{Middleware(version)}, middlewares...)...)
+}
+
+// Middleware stores the version of the request in its context and flags the deprecated versions.
+// Past its sunset, a version is answered with 410 Gone.
+func Middleware(version Version) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(contextKey, version.Name)
+			if !version.Deprecated() {
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set(HeaderDeprecation, "@"+strconv.FormatInt(version.Deprecation.Unix(), 10))
+			if version.Successor != "" {
+				successorPath := "/" + version.Successor + strings.TrimPrefix(c.Request().URL.Path, version.Prefix())
+				header.Add(HeaderLink, "<"+successorPath+">; rel=\"successor-version\"")
+			}
+
+			if !version.Sunset.IsZero() {
+				header.Set(HeaderSunset, version.Sunset.UTC().Format(http.TimeFormat))
+				if !time.Now().Before(version.Sunset) {
+					return echo.NewHTTPError(http.StatusGone, "API "+version.Name+" was retired on "+version.Sunset.UTC().Format(time.DateOnly))
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// Redirect is used to send the requests on the unversioned routes of resource, such as /tenants, to the same route
+// of version with a 308 Permanent Redirect, keeping their method and body, for the clients predating the versions.
+func Redirect(resource string, version Version) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			path := c.Request().URL.Path
+			if path != resource && !strings.HasPrefix(path, resource+"/") && !strings.HasPrefix(path, resource+":") {
+				return next(c)
+			}
+			return c.Redirect(http.StatusPermanentRedirect, version.Prefix()+c.Request().URL.RequestURI())
+		}
+	}
+}
+
+// FromContext is used to find the version name of the request, empty outside the versioned route groups.
+func FromContext(c echo.Context) string {
+	name, _ := c.Get(contextKey).(string)
+	return name
+}
@@ -0,0 +1,93 @@
+package versioning
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func serve(versions []Version, path string) *httptest.ResponseRecorder {
+	e := echo.New()
+	for _, version := range versions {
+		Group(e, version).GET("/tenants/:id", func(c echo.Context) error {
+			return c.String(http.StatusOK, FromContext(c))
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestSupportedVersion(t *testing.T) {
+	rec := serve([]Version{{Name: "v2"}}, "/v2/tenants/42")
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "v2", rec.Body.String())
+	assert.Empty(t, rec.Header().Get(HeaderDeprecation))
+	assert.Empty(t, rec.Header().Get(HeaderSunset))
+	assert.Empty(t, rec.Header().Get(HeaderLink))
+}
+
+func TestDeprecatedVersion(t *testing.T) {
+	deprecation := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	sunset := time.Now().Add(24 * time.Hour)
+	versions := []Version{
+		{Name: "v1", Deprecation: deprecation, Sunset: sunset, Successor: "v2"},
+		{Name: "v2"},
+	}
+
+	rec := serve(versions, "/v1/tenants/42")
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "v1", rec.Body.String())
+	assert.Equal(t, "@1792368000", rec.Header().Get(HeaderDeprecation))
+	assert.Equal(t, sunset.UTC().Format(http.TimeFormat), rec.Header().Get(HeaderSunset))
+	assert.Equal(t, `</v2/tenants/42>; rel="successor-version"`, rec.Header().Get(HeaderLink))
+
+	versions[0].Sunset = time.Now().Add(-time.Hour)
+	rec = serve(versions, "/v1/tenants/42")
+
+	// Assertions
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get(HeaderSunset))
+}
+
+func TestRedirect(t *testing.T) {
+	e := echo.New()
+	e.Use(Redirect("/tenants", Version{Name: "v1"}))
+	e.GET("/tenantsettings", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for path, location := range map[string]string{
+		"/tenants":              "/v1/tenants",
+		"/tenants/42?hard=true": "/v1/tenants/42?hard=true",
+		"/tenants:batch":        "/v1/tenants:batch",
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+
+		// Assertions
+		assert.Equal(t, http.StatusPermanentRedirect, rec.Code, path)
+		assert.Equal(t, location, rec.Header().Get(echo.HeaderLocation), path)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tenantsettings", nil))
+
+	// Assertions
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestUnversionedRequest(t *testing.T) {
+	e := echo.New()
+
+	// Assertions
+	assert.Empty(t, FromContext(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())))
+}
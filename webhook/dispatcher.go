@@ -0,0 +1,193 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	webhookModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/webhook"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/metrics"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// maxResponseBody is the size of the response bodies read, so the connections can be reused.
+const maxResponseBody = 64 << 10
+
+// ErrForbiddenAddress is returned when a subscription resolves to an address deliveries must not reach.
+var ErrForbiddenAddress = errors.New("webhook address is not public")
+
+// Dispatcher sends the pending deliveries to their subscription.
+type Dispatcher struct {
+	client *http.Client
+	// maxAttempts is the number of attempts after which a delivery is given up.
+	maxAttempts int
+	// backoff is the delay before the second attempt, doubled on each of the next ones up to maxBackoff.
+	backoff    time.Duration
+	maxBackoff time.Duration
+	batchSize  int
+}
+
+// NewDispatcher is used to create a dispatcher giving the subscriptions timeout to answer each delivery.
+// Unless allowPrivate is set, the deliveries only reach public addresses, so subscriptions can't be used to call
+// the internal services. Redirects are never followed, they fail the attempt.
+func NewDispatcher(timeout time.Duration, maxAttempts int, backoff time.Duration, maxBackoff time.Duration, batchSize int, allowPrivate bool) *Dispatcher {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		// The address is checked once resolved, and a proxy would make the connection in its place.
+		dialer.Control = checkPublicAddress
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+
+	return &Dispatcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		maxBackoff:  maxBackoff,
+		batchSize:   batchSize,
+	}
+}
+
+// Run is used to send the deliveries due every interval, until ctx is cancelled.
+// Its queries run on the database client ctx carries.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger := logging.Component("webhook")
+
+	for {
+		d.dispatch(ctx, logger)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch is used to send the deliveries due, a batch at a time, until none is left or ctx is cancelled.
+func (d *Dispatcher) dispatch(ctx context.Context, logger zerolog.Logger) {
+	deliveryInstance := webhookModel.ModelDelivery{}
+
+	for ctx.Err() == nil {
+		// The claimed deliveries are postponed for longer than they can take, so no other replica sends them meanwhile.
+		deliveries, err := deliveryInstance.WithContext(ctx).Claim(d.batchSize, time.Duration(d.batchSize+1)*d.client.Timeout)
+		if err != nil {
+			logger.Error().Err(err).Msg("Error claiming the webhook deliveries")
+			return
+		}
+
+		for i := range deliveries {
+			d.deliver(ctx, &deliveries[i], logger)
+		}
+
+		if len(deliveries) < d.batchSize {
+			return
+		}
+	}
+}
+
+// deliver is used to post a delivery to its subscription and record the outcome,
+// scheduling the next attempt when it failed and attempts are left.
+func (d *Dispatcher) deliver(ctx context.Context, delivery *webhookModel.ModelDelivery, logger zerolog.Logger) {
+	responseCode, err := d.post(ctx, delivery)
+
+	var nextAttempt *time.Time
+	outcome := "succeeded"
+	if err != nil {
+		outcome = "failed"
+		if delivery.Attempts+1 < d.maxAttempts {
+			next := time.Now().Add(d.delay(delivery.Attempts + 1))
+			nextAttempt = &next
+			outcome = "retried"
+		}
+
+		logger.Warn().Err(err).
+			Str("delivery", delivery.UUID.String()).
+			Str("event", delivery.Event).
+			Int("attempt", delivery.Attempts+1).
+			Msg("Webhook delivery failed")
+	}
+	metrics.WebhookDeliveries.WithLabelValues(outcome).Inc()
+
+	// The outcome is recorded even if ctx is cancelled meanwhile, or the delivery would be sent again.
+	err = delivery.WithContext(context.WithoutCancel(ctx)).RecordAttempt(responseCode, err, nextAttempt)
+	if err != nil {
+		logger.Error().Err(err).Str("delivery", delivery.UUID.String()).Msg("Error recording the webhook delivery")
+	}
+}
+
+// post is used to send the signed payload of the delivery, and get the response code,
+// zero if no response was received. A response code other than 2xx is an error.
+func (d *Dispatcher) post(ctx context.Context, delivery *webhookModel.ModelDelivery) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "go-rest-boilerplate-echo-webhook")
+	request.Header.Set(HeaderEvent, delivery.Event)
+	request.Header.Set(HeaderDelivery, delivery.UUID.String())
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(HeaderSignature, Sign(delivery.Subscription.Secret, timestamp, delivery.Payload))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseBody))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// checkPublicAddress is used to refuse the connections to loopback, private, link-local (such as the
+// 169.254.169.254 metadata service), multicast and unspecified addresses.
+func checkPublicAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+	}
+	return nil
+}
+
+// delay is used to get the time to wait after the given number of failed attempts.
+func (d *Dispatcher) delay(attempts int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.maxBackoff)
+}
@@ -0,0 +1,73 @@
+// Package webhook sends the events queued for the webhook subscriptions, signed with their secret,
+// retrying the failed deliveries with an exponential backoff.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderEvent is the name of the event delivered.
+	HeaderEvent = "X-Webhook-Event"
+	// HeaderDelivery is the ID of the delivery, a redelivery having an ID of its own.
+	HeaderDelivery = "X-Webhook-Delivery"
+	// HeaderTimestamp is the Unix time the delivery was signed at.
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// HeaderSignature is the HMAC-SHA256 of the timestamp and body, as "sha256=<hex>".
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// signaturePrefix is the scheme of the signatures.
+const signaturePrefix = "sha256="
+
+var (
+	// ErrInvalidSignature is returned when the signature doesn't match the body and secret.
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrExpiredTimestamp is returned when the delivery was signed too long ago, or in the future.
+	ErrExpiredTimestamp = errors.New("webhook timestamp outside of the tolerance")
+)
+
+// Sign is used to get the signature of the body sent at timestamp, the HMAC-SHA256 with the secret
+// of "<timestamp>.<body>". Signing the timestamp prevents a delivery from being replayed later on.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify is used by receivers to check the signature and timestamp headers of a delivery,
+// the timestamp being at most tolerance away from now.
+func Verify(secret string, signature string, timestamp string, body []byte, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrExpiredTimestamp
+	}
+
+	age := time.Since(time.Unix(unix, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrExpiredTimestamp
+	}
+
+	if !strings.HasPrefix(signature, signaturePrefix) || !hmac.Equal([]byte(signature), []byte(Sign(secret, unix, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// NewSecret is used to generate the secret of a subscription created without one.
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
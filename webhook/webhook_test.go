@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/database"
+	webhookModel "gitlab.com/s0j0hn/go-rest-boilerplate-echo/database/models/webhook"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"event":"tenant.created"}`)
+	now := time.Now().Unix()
+	signature := Sign("secret", now, body)
+
+	assert.NoError(t, Verify("secret", signature, strconv.FormatInt(now, 10), body, time.Minute))
+	assert.ErrorIs(t, Verify("other", signature, strconv.FormatInt(now, 10), body, time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", signature, strconv.FormatInt(now, 10), []byte("{}"), time.Minute), ErrInvalidSignature)
+
+	// The timestamp is signed, a delivery can't be replayed later on with another one.
+	assert.ErrorIs(t, Verify("secret", signature, strconv.FormatInt(now+1, 10), body, time.Minute), ErrInvalidSignature)
+	old := now - 3600
+	assert.ErrorIs(t, Verify("secret", Sign("secret", old, body), strconv.FormatInt(old, 10), body, time.Minute), ErrExpiredTimestamp)
+}
+
+func TestDelay(t *testing.T) {
+	dispatcher := NewDispatcher(time.Second, 10, time.Second, 10*time.Second, 10, false)
+	assert.Equal(t, time.Second, dispatcher.delay(1))
+	assert.Equal(t, 2*time.Second, dispatcher.delay(2))
+	assert.Equal(t, 8*time.Second, dispatcher.delay(4))
+	assert.Equal(t, 10*time.Second, dispatcher.delay(5))
+	assert.Equal(t, 10*time.Second, dispatcher.delay(50))
+}
+
+func TestDispatch(t *testing.T) {
+	db := database.ConnectForTests()
+	assert.NoError(t, db.Migrator().DropTable(&webhookModel.ModelDelivery{}, &webhookModel.ModelSubscription{}))
+	assert.NoError(t, db.AutoMigrate(&webhookModel.ModelSubscription{}, &webhookModel.ModelDelivery{}))
+	ctx := database.NewContext(context.Background(), db)
+
+	// The receiver fails the first attempt, then checks the signature of the retry.
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		assert.Equal(t, webhookModel.EventTenantCreated, r.Header.Get(HeaderEvent))
+		assert.NotEmpty(t, r.Header.Get(HeaderDelivery))
+		assert.NoError(t, Verify("receiver-secret", r.Header.Get(HeaderSignature), r.Header.Get(HeaderTimestamp), body, time.Minute))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	subscription := webhookModel.ModelSubscription{URL: receiver.URL, Secret: "receiver-secret", Events: []string{"tenant.*"}, Active: true}
+	_, err := subscription.WithContext(ctx).Save()
+	assert.NoError(t, err)
+	unreachable := webhookModel.ModelSubscription{URL: "http://127.0.0.1:1", Secret: "secret", Events: []string{"*"}, Active: true}
+	_, err = unreachable.WithContext(ctx).Save()
+	assert.NoError(t, err)
+
+	// Each event is queued for the subscriptions it matches: both for the tenant event, one for the task event.
+	assert.NoError(t, webhookModel.Enqueue(db, webhookModel.EventTenantCreated, map[string]string{"name": "Hooked"}))
+	assert.NoError(t, webhookModel.Enqueue(db, webhookModel.EventTaskCompleted, map[string]string{"status": "completed"}))
+
+	dispatcher := NewDispatcher(time.Second, 2, time.Millisecond, time.Millisecond, 10, true)
+	dispatcher.dispatch(ctx, zerolog.Nop())
+	time.Sleep(5 * time.Millisecond)
+	dispatcher.dispatch(ctx, zerolog.Nop())
+
+	deliveries, err := (&webhookModel.ModelDelivery{}).WithContext(ctx).Find(subscription.ID, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, webhookModel.StatusSucceeded, deliveries[0].Status)
+		assert.Equal(t, 2, deliveries[0].Attempts)
+		assert.Equal(t, http.StatusNoContent, deliveries[0].ResponseCode)
+		assert.NotNil(t, deliveries[0].DeliveredAt)
+	}
+
+	// Given up after the last attempt, with the error kept in the delivery log.
+	deliveries, err = (&webhookModel.ModelDelivery{}).WithContext(ctx).Find(unreachable.ID, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 2) {
+		for _, delivery := range deliveries {
+			assert.Equal(t, webhookModel.StatusFailed, delivery.Status)
+			assert.Equal(t, 2, delivery.Attempts)
+			assert.Zero(t, delivery.ResponseCode)
+			assert.NotEmpty(t, delivery.LastError)
+		}
+	}
+
+	purged, err := (&webhookModel.ModelDelivery{}).WithContext(ctx).PurgeFinishedBefore(time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, purged)
+}
+
+func TestCheckPublicAddress(t *testing.T) {
+	for _, address := range []string{"127.0.0.1:80", "[::1]:80", "10.0.0.1:80", "172.16.0.1:80", "192.168.1.1:443",
+		"169.254.169.254:80", "[fe80::1]:80", "[fd00:ec2::254]:80", "0.0.0.0:80", "[::ffff:127.0.0.1]:80", "224.0.0.1:80"} {
+		assert.ErrorIs(t, checkPublicAddress("tcp", address, nil), ErrForbiddenAddress, address)
+	}
+
+	assert.NoError(t, checkPublicAddress("tcp", "93.184.216.34:443", nil))
+	assert.NoError(t, checkPublicAddress("tcp", "[2606:2800:220:1::]:443", nil))
+}
+
+func TestPrivateDelivery(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Redirect(w, r, "/elsewhere", http.StatusTemporaryRedirect)
+	}))
+	defer receiver.Close()
+
+	delivery := &webhookModel.ModelDelivery{Subscription: webhookModel.ModelSubscription{URL: receiver.URL, Secret: "secret"}}
+
+	// The receiver listens on a loopback address, refused unless private addresses are allowed.
+	_, err := NewDispatcher(time.Second, 1, time.Second, time.Second, 1, false).post(context.Background(), delivery)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+	assert.Zero(t, calls.Load())
+
+	// The redirect is answered as is, it is not followed.
+	responseCode, err := NewDispatcher(time.Second, 1, time.Second, time.Second, 1, true).post(context.Background(), delivery)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusTemporaryRedirect, responseCode)
+	assert.EqualValues(t, 1, calls.Load())
+}
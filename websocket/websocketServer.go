@@ -1,18 +1,35 @@
 package websocket
 
 import (
+	"context"
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	golog "github.com/labstack/gommon/log"
-	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/config"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/lifecycle"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/logging"
+	"gitlab.com/s0j0hn/go-rest-boilerplate-echo/metrics"
 	"net/http"
+	"sync"
+	"time"
 )
 
+// closeTimeout is the longest the close frame takes to be sent to a client.
+const closeTimeout = time.Second
+
 type (
 	// Handler is a default handler as there is no generics.
 	Handler struct {
 		amqpMessages chan []byte
+		server       *Server
+	}
+
+	// Server forwards the task events to the connected clients.
+	Server struct {
+		echo *echo.Echo
+		// closing is closed on shutdown, for every client to be sent a close frame.
+		closing     chan struct{}
+		closeOnce   sync.Once
+		connections sync.WaitGroup
 	}
 )
 
@@ -20,8 +37,8 @@ var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool {
 	return true
 }}
 
-func createHandler(amqpMessages chan []byte) *Handler {
-	return &Handler{amqpMessages}
+func createHandler(amqpMessages chan []byte, server *Server) *Handler {
+	return &Handler{amqpMessages, server}
 }
 
 func (h Handler) getTaskEvents(c echo.Context) error {
@@ -31,34 +48,64 @@ func (h Handler) getTaskEvents(c echo.Context) error {
 	}
 	defer ws.Close()
 
+	h.server.connections.Add(1)
+	defer h.server.connections.Done()
+
+	metrics.WebSocketConnections.Inc()
+	defer metrics.WebSocketConnections.Dec()
+
 	for {
 		select {
 		case message := <-h.amqpMessages:
 			err := ws.WriteMessage(websocket.TextMessage, message)
 			if err != nil {
+				// The client is gone, its connection is no longer counted.
 				c.Logger().Error(err)
+				return nil
 			}
+		case <-h.server.closing:
+			closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			err := ws.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(closeTimeout))
+			if err != nil {
+				c.Logger().Error(err)
+			}
+			return nil
 		}
 	}
 }
 
-// CreateServer Creates a web socket server
-func CreateServer(amqpMessages chan []byte) {
-	e := echo.New()
+// NewServer is used to create a web socket server forwarding amqpMessages to its clients.
+func NewServer(amqpMessages chan []byte) *Server {
+	server := &Server{echo: echo.New(), closing: make(chan struct{})}
 
 	// For more customizations: https://echo.labstack.com/guide/customization
-	if l, ok := e.Logger.(*golog.Logger); ok {
-		l.SetHeader("${time_rfc3339} ${level}")
-	}
+	server.echo.Logger = logging.NewEchoLogger(logging.Component("websocket"))
+	server.echo.Use(logging.AccessLog())
 
-	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Format: "method=${method}  uri=${uri}  status=${status}\n",
-	}))
+	server.echo.Use(middleware.Recover())
 
-	e.Use(middleware.Recover())
+	handler := createHandler(amqpMessages, server)
+	server.echo.GET("/", handler.getTaskEvents)
 
-	handler := createHandler(amqpMessages)
-	e.GET("/", handler.getTaskEvents)
+	return server
+}
+
+// Echo is used to get the echo server of the websocket.
+func (server *Server) Echo() *echo.Echo {
+	return server.echo
+}
+
+// Start is used to listen on address and serve the clients, it blocks until the server is shut down.
+func (server *Server) Start(address string) error {
+	return server.echo.Start(address)
+}
+
+// Shutdown is used to stop accepting clients, and close the connected ones with a close frame, until ctx is done.
+func (server *Server) Shutdown(ctx context.Context) error {
+	if err := server.echo.Shutdown(ctx); err != nil {
+		return err
+	}
 
-	e.Logger.Fatal(e.Start(config.GetWebSocketAddress()))
+	server.closeOnce.Do(func() { close(server.closing) })
+	return lifecycle.WaitGroup(ctx, &server.connections)
 }